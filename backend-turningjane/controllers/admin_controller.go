@@ -3,6 +3,7 @@ package controllers
 import (
 	"database/sql"
 	"net/http"
+	"time"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
@@ -18,10 +19,108 @@ func NewAdminController(db *sql.DB) *AdminController {
 	return &AdminController{DB: db}
 }
 
+// Permission adalah hak akses yang dicek oleh middleware PermissionRequired
+type Permission string
+
+const (
+	PermContentWrite Permission = "content:write"
+	PermAdminsManage Permission = "admins:manage"
+	PermUsersManage  Permission = "users:manage"
+	PermStatsRead    Permission = "stats:read"
+)
+
+// Role admin, disimpan di kolom admins.role
+const (
+	RoleOwner  = "owner"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+)
+
+// rolePermissions adalah matriks hak akses setiap role admin
+var rolePermissions = map[string][]Permission{
+	RoleOwner:  {PermContentWrite, PermAdminsManage, PermUsersManage, PermStatsRead},
+	RoleEditor: {PermContentWrite, PermStatsRead},
+	RoleViewer: {PermStatsRead},
+}
+
+// RolePermissions returns the permissions granted to the role
+func RolePermissions(role string) []Permission {
+	permissions := rolePermissions[role]
+	if permissions == nil {
+		return []Permission{}
+	}
+	return permissions
+}
+
+// HasPermission reports whether the role grants the permission
+func HasPermission(role string, permission Permission) bool {
+	for _, p := range rolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
 // Admin represents an admin user
 type Admin struct {
 	ID    uuid.UUID `json:"id"`
 	Email string    `json:"email"`
+	Role  string    `json:"role"`
+}
+
+// CreateAdminRequest for creating an admin, role defaults to editor
+type CreateAdminRequest struct {
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required,min=6"`
+	Role     string `json:"role" binding:"omitempty,oneof=owner editor viewer"`
+}
+
+// Helper function to check whether the admin is the only owner left. Owner
+// rows are locked so two concurrent requests cannot remove the last two
+// owners at the same time.
+func isLastOwner(tx *sql.Tx, id uuid.UUID) (bool, error) {
+	rows, err := tx.Query("SELECT id FROM admins WHERE role = $1 FOR UPDATE", RoleOwner)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	owners := 0
+	isOwner := false
+	for rows.Next() {
+		var ownerID uuid.UUID
+		if err := rows.Scan(&ownerID); err != nil {
+			return false, err
+		}
+		owners++
+		if ownerID == id {
+			isOwner = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return false, err
+	}
+
+	return isOwner && owners == 1, nil
+}
+
+// sessionAdminID returns the ID of the logged in admin set by AuthRequired.
+// User sessions are rejected because their IDs belong to the users table.
+func sessionAdminID(c *gin.Context) (uuid.UUID, bool) {
+	if userType, _ := c.Get("user_type"); userType != "admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+		return uuid.Nil, false
+	}
+
+	adminIDStr, _ := c.Get("user_id")
+	value, _ := adminIDStr.(string)
+	adminID, err := uuid.Parse(value)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return uuid.Nil, false
+	}
+	return adminID, true
 }
 
 // === ADMIN CRUD OPERATIONS ===
@@ -36,15 +135,17 @@ func (ac *AdminController) AdminLogin(c *gin.Context) {
 
 	// Get admin by email from admins table
 	var admin struct {
-		ID       uuid.UUID
-		Email    string
-		Password string
+		ID          uuid.UUID
+		Email       string
+		Password    string
+		Role        string
+		TwoFactorOn bool
 	}
 
 	err := ac.DB.QueryRow(
-		"SELECT id, email, password FROM admins WHERE email = $1",
+		"SELECT id, email, password, role, totp_secret IS NOT NULL FROM admins WHERE email = $1",
 		req.Email,
-	).Scan(&admin.ID, &admin.Email, &admin.Password)
+	).Scan(&admin.ID, &admin.Email, &admin.Password, &admin.Role, &admin.TwoFactorOn)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -62,8 +163,27 @@ func (ac *AdminController) AdminLogin(c *gin.Context) {
 		return
 	}
 
-	// Create session
+	// Create session. Isi session lama (misalnya login 2FA yang tertunda atau
+	// session akun lain) dibuang dulu agar tidak terbawa ke session baru.
 	session := sessions.Default(c)
+	session.Clear()
+
+	// Admin dengan 2FA baru mendapat session admin setelah POST /admin/login/verify
+	if admin.TwoFactorOn {
+		session.Set(pendingAdminKey, admin.ID.String())
+		session.Set(pendingAdminExpiresKey, time.Now().Add(pendingAdminTTL).Unix())
+		if err := session.Save(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":             "Two-factor code required",
+			"two_factor_required": true,
+		})
+		return
+	}
+
 	session.Set("user_id", admin.ID.String())
 	session.Set("user_type", "admin")
 	if err := session.Save(); err != nil {
@@ -76,13 +196,15 @@ func (ac *AdminController) AdminLogin(c *gin.Context) {
 		"admin": Admin{
 			ID:    admin.ID,
 			Email: admin.Email,
+			Role:  admin.Role,
 		},
+		"permissions": RolePermissions(admin.Role),
 	})
 }
 
 // ListAdmins returns all admin users
 func (ac *AdminController) ListAdmins(c *gin.Context) {
-	rows, err := ac.DB.Query("SELECT id, email FROM admins ORDER BY email ASC")
+	rows, err := ac.DB.Query("SELECT id, email, role FROM admins ORDER BY email ASC")
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
@@ -92,7 +214,7 @@ func (ac *AdminController) ListAdmins(c *gin.Context) {
 	var admins []Admin
 	for rows.Next() {
 		var admin Admin
-		if err := rows.Scan(&admin.ID, &admin.Email); err != nil {
+		if err := rows.Scan(&admin.ID, &admin.Email, &admin.Role); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Scan error"})
 			return
 		}
@@ -104,11 +226,14 @@ func (ac *AdminController) ListAdmins(c *gin.Context) {
 
 // CreateAdmin creates a new admin user
 func (ac *AdminController) CreateAdmin(c *gin.Context) {
-	var req RegisterRequest
+	var req CreateAdminRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if req.Role == "" {
+		req.Role = RoleEditor
+	}
 
 	// Check if email already exists in admins table
 	var exists bool
@@ -133,8 +258,8 @@ func (ac *AdminController) CreateAdmin(c *gin.Context) {
 	// Insert new admin
 	var adminID uuid.UUID
 	err = ac.DB.QueryRow(
-		"INSERT INTO admins (email, password) VALUES ($1, $2) RETURNING id",
-		req.Email, string(hashedPassword),
+		"INSERT INTO admins (email, password, role) VALUES ($1, $2, $3) RETURNING id",
+		req.Email, string(hashedPassword), req.Role,
 	).Scan(&adminID)
 
 	if err != nil {
@@ -147,6 +272,7 @@ func (ac *AdminController) CreateAdmin(c *gin.Context) {
 		"admin": Admin{
 			ID:    adminID,
 			Email: req.Email,
+			Role:  req.Role,
 		},
 	})
 }
@@ -167,9 +293,9 @@ func (ac *AdminController) GetAdminProfile(c *gin.Context) {
 
 	var admin Admin
 	err = ac.DB.QueryRow(
-		"SELECT id, email FROM admins WHERE id = $1",
+		"SELECT id, email, role FROM admins WHERE id = $1",
 		adminID,
-	).Scan(&admin.ID, &admin.Email)
+	).Scan(&admin.ID, &admin.Email, &admin.Role)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -180,7 +306,7 @@ func (ac *AdminController) GetAdminProfile(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"admin": admin})
+	c.JSON(http.StatusOK, gin.H{"admin": admin, "permissions": RolePermissions(admin.Role)})
 }
 
 // UpdateAdmin updates admin information
@@ -195,6 +321,7 @@ func (ac *AdminController) UpdateAdmin(c *gin.Context) {
 	var req struct {
 		Email    string `json:"email" binding:"required,email"`
 		Password string `json:"password,omitempty"`
+		Role     string `json:"role" binding:"omitempty,oneof=owner editor viewer"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -215,6 +342,40 @@ func (ac *AdminController) UpdateAdmin(c *gin.Context) {
 		return
 	}
 
+	tx, err := ac.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	var currentRole string
+	err = tx.QueryRow("SELECT role FROM admins WHERE id = $1 FOR UPDATE", id).Scan(&currentRole)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Admin not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	// Owner terakhir tidak boleh diturunkan ke role lain
+	if req.Role == "" {
+		req.Role = currentRole
+	}
+	if currentRole == RoleOwner && req.Role != RoleOwner {
+		lastOwner, err := isLastOwner(tx, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if lastOwner {
+			c.JSON(http.StatusConflict, gin.H{"error": "Cannot change the role of the last owner"})
+			return
+		}
+	}
+
 	// Update admin
 	if req.Password != "" {
 		// Update with password
@@ -224,20 +385,25 @@ func (ac *AdminController) UpdateAdmin(c *gin.Context) {
 			return
 		}
 
-		_, err = ac.DB.Exec("UPDATE admins SET email = $1, password = $2 WHERE id = $3", req.Email, string(hashedPassword), id)
+		_, err = tx.Exec("UPDATE admins SET email = $1, password = $2, role = $3 WHERE id = $4", req.Email, string(hashedPassword), req.Role, id)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update admin"})
 			return
 		}
 	} else {
 		// Update without password
-		_, err = ac.DB.Exec("UPDATE admins SET email = $1 WHERE id = $2", req.Email, id)
+		_, err = tx.Exec("UPDATE admins SET email = $1, role = $2 WHERE id = $3", req.Email, req.Role, id)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update admin"})
 			return
 		}
 	}
 
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update admin"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Admin updated successfully"})
 }
 
@@ -250,33 +416,57 @@ func (ac *AdminController) DeleteAdmin(c *gin.Context) {
 		return
 	}
 
-	// Check if admin exists
-	var exists bool
-	err = ac.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM admins WHERE id = $1)", id).Scan(&exists)
+	// Don't allow deleting yourself
+	currentUserID := c.GetString("user_id")
+	if currentUserID == adminID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot delete your own account"})
+		return
+	}
+
+	tx, err := ac.DB.Begin()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
+	defer tx.Rollback()
 
-	if !exists {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Admin not found"})
+	// Check if admin exists
+	var role string
+	err = tx.QueryRow("SELECT role FROM admins WHERE id = $1 FOR UPDATE", id).Scan(&role)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Admin not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
 
-	// Don't allow deleting yourself
-	currentUserID := c.GetString("user_id")
-	if currentUserID == adminID {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot delete your own account"})
-		return
+	// Harus selalu ada minimal satu owner
+	if role == RoleOwner {
+		lastOwner, err := isLastOwner(tx, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if lastOwner {
+			c.JSON(http.StatusConflict, gin.H{"error": "Cannot delete the last owner"})
+			return
+		}
 	}
 
 	// Delete admin
-	_, err = ac.DB.Exec("DELETE FROM admins WHERE id = $1", id)
+	_, err = tx.Exec("DELETE FROM admins WHERE id = $1", id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete admin"})
 		return
 	}
 
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete admin"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Admin deleted successfully"})
 }
 
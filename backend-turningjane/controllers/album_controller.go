@@ -0,0 +1,583 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"backend-turningjane/models"
+	"backend-turningjane/utils"
+)
+
+// albumCoverFolder adalah folder storage untuk cover album
+const albumCoverFolder = "album_covers"
+
+// upcPattern menerima UPC-A (12 digit) dan EAN-13
+var upcPattern = regexp.MustCompile(`^[0-9]{12,13}$`)
+
+// albumColumns adalah kolom yang dibaca oleh scanAlbum, termasuk jumlah lagu
+const albumColumns = `
+	a.album_id, a.title, a.album_type, a.release_date, a.cover_image_path, a.cover_image_variants, a.label, a.upc,
+	(SELECT COUNT(*) FROM songs t WHERE t.album_id = a.album_id)
+`
+
+// albumMutationQuery membungkus INSERT/UPDATE ... RETURNING * agar hasilnya
+// memiliki kolom yang sama dengan albumColumns
+func albumMutationQuery(statement string) string {
+	return `WITH a AS (` + statement + `) SELECT ` + albumColumns + ` FROM a`
+}
+
+type AlbumController struct {
+	DB      *sql.DB
+	Storage utils.Storage
+	Outbox  *utils.DeletionOutbox
+}
+
+func NewAlbumController(db *sql.DB, storage utils.Storage, outbox *utils.DeletionOutbox) *AlbumController {
+	return &AlbumController{
+		DB:      db,
+		Storage: storage,
+		Outbox:  outbox,
+	}
+}
+
+// Helper function to scan a row selected with albumColumns
+func scanAlbum(row rowScanner) (models.Album, error) {
+	var album models.Album
+	var releaseDate sql.NullTime
+	var coverImagePath sql.NullString
+	var coverImageVariants []byte
+	var label sql.NullString
+	var upc sql.NullString
+
+	err := row.Scan(
+		&album.AlbumID,
+		&album.Title,
+		&album.AlbumType,
+		&releaseDate,
+		&coverImagePath,
+		&coverImageVariants,
+		&label,
+		&upc,
+		&album.TrackCount,
+	)
+	if err != nil {
+		return album, err
+	}
+
+	if releaseDate.Valid {
+		value := releaseDate.Time.Format(time.DateOnly)
+		album.ReleaseDate = &value
+	}
+	if coverImagePath.Valid {
+		album.CoverImagePath = &coverImagePath.String
+	}
+	album.CoverImageVariants = decodeImageVariants(coverImageVariants)
+	if label.Valid {
+		album.Label = &label.String
+	}
+	if upc.Valid {
+		album.UPC = &upc.String
+	}
+
+	return album, nil
+}
+
+// Helper function to check that no other album uses the UPC
+func (c *AlbumController) upcTaken(upc string, albumID uuid.UUID) (bool, error) {
+	var exists bool
+	err := c.DB.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM albums WHERE upc = $1 AND album_id <> $2)",
+		upc, albumID,
+	).Scan(&exists)
+	return exists, err
+}
+
+// Helper function to load an album with its ordered tracklist
+func (c *AlbumController) albumDetail(id uuid.UUID) (models.AlbumDetailResponse, error) {
+	var detail models.AlbumDetailResponse
+
+	album, err := scanAlbum(c.DB.QueryRow("SELECT "+albumColumns+" FROM albums a WHERE a.album_id = $1", id))
+	if err != nil {
+		return detail, err
+	}
+	detail.Album = album
+
+	rows, err := c.DB.Query(songSelectQuery+" WHERE s.album_id = $1 ORDER BY s.disc_number, s.track_number, s.title", id)
+	if err != nil {
+		return detail, err
+	}
+	defer rows.Close()
+
+	detail.Tracks = []models.SongResponse{}
+	for rows.Next() {
+		song, err := scanSong(rows)
+		if err != nil {
+			return detail, err
+		}
+		detail.Tracks = append(detail.Tracks, song)
+	}
+
+	return detail, rows.Err()
+}
+
+// ListAlbums mengambil daftar album, rilisan terbaru lebih dulu
+func (c *AlbumController) ListAlbums(ctx *gin.Context) {
+	rows, err := c.DB.Query("SELECT " + albumColumns + " FROM albums a ORDER BY a.release_date DESC NULLS LAST, a.title")
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	defer rows.Close()
+
+	albums := []models.Album{}
+	for rows.Next() {
+		album, err := scanAlbum(rows)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Scan error: %v", err)})
+			return
+		}
+		albums = append(albums, album)
+	}
+
+	if err = rows.Err(); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Rows error: %v", err)})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, albums)
+}
+
+// GetAlbum mengambil detail album beserta tracklist
+func (c *AlbumController) GetAlbum(ctx *gin.Context) {
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid UUID format"})
+		return
+	}
+
+	detail, err := c.albumDetail(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Album not found"})
+		} else {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, detail)
+}
+
+// CreateAlbum menambahkan album baru
+func (c *AlbumController) CreateAlbum(ctx *gin.Context) {
+	var req models.CreateAlbumRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid request: %v", err)})
+		return
+	}
+
+	if req.UPC != nil {
+		taken, err := c.upcTaken(*req.UPC, uuid.Nil)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+			return
+		}
+		if taken {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "UPC already exists"})
+			return
+		}
+	}
+
+	query := albumMutationQuery(`
+		INSERT INTO albums (title, album_type, release_date, cover_image_path, label, upc)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING *
+	`)
+
+	album, err := scanAlbum(c.DB.QueryRow(
+		query,
+		req.Title,
+		req.AlbumType,
+		req.ReleaseDate,
+		req.CoverImagePath,
+		req.Label,
+		req.UPC,
+	))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, album)
+}
+
+// UpdateAlbum memperbarui album, hanya field yang dikirim yang diubah
+func (c *AlbumController) UpdateAlbum(ctx *gin.Context) {
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid UUID format"})
+		return
+	}
+
+	var req models.UpdateAlbumRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid request: %v", err)})
+		return
+	}
+
+	// String kosong berarti menghapus nilai, selain itu formatnya harus valid
+	if req.ReleaseDate != nil && *req.ReleaseDate != "" {
+		if _, err := time.Parse(time.DateOnly, *req.ReleaseDate); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "release_date must be formatted as YYYY-MM-DD"})
+			return
+		}
+	}
+	if req.UPC != nil && *req.UPC != "" {
+		if !upcPattern.MatchString(*req.UPC) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "upc must be 12 or 13 digits"})
+			return
+		}
+
+		taken, err := c.upcTaken(*req.UPC, id)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+			return
+		}
+		if taken {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "UPC already exists"})
+			return
+		}
+	}
+
+	tx, err := c.DB.Begin()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	defer tx.Rollback()
+
+	// Kunci album dan ambil cover lama
+	var currentCover sql.NullString
+	var currentVariants []byte
+	err = tx.QueryRow(
+		"SELECT cover_image_path, cover_image_variants FROM albums WHERE album_id = $1 FOR UPDATE",
+		id,
+	).Scan(&currentCover, &currentVariants)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Album not found"})
+		} else {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		}
+		return
+	}
+
+	query := albumMutationQuery(`
+		UPDATE albums
+		SET
+			title = COALESCE($1, title),
+			album_type = COALESCE($2, album_type),
+			release_date = CASE WHEN $3::text IS NULL THEN release_date ELSE NULLIF($3, '')::date END,
+			cover_image_path = CASE WHEN $4::text IS NULL THEN cover_image_path ELSE NULLIF($4, '') END,
+			cover_image_variants = CASE WHEN $4::text IS NULL OR $4 = cover_image_path THEN cover_image_variants ELSE NULL END,
+			label = CASE WHEN $5::text IS NULL THEN label ELSE NULLIF($5, '') END,
+			upc = CASE WHEN $6::text IS NULL THEN upc ELSE NULLIF($6, '') END
+		WHERE album_id = $7
+		RETURNING *
+	`)
+
+	album, err := scanAlbum(tx.QueryRow(
+		query,
+		req.Title,
+		req.AlbumType,
+		req.ReleaseDate,
+		req.CoverImagePath,
+		req.Label,
+		req.UPC,
+		id,
+	))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	// Cover lama yang diganti dihapus setelah commit
+	if currentCover.Valid && (album.CoverImagePath == nil || *album.CoverImagePath != currentCover.String) {
+		if err := c.Outbox.Enqueue(tx, imageFiles(currentCover.String, decodeImageVariants(currentVariants))...); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	c.Outbox.Notify()
+
+	ctx.JSON(http.StatusOK, album)
+}
+
+// UploadAlbumCover mengganti cover album dengan file yang diupload
+func (c *AlbumController) UploadAlbumCover(ctx *gin.Context) {
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid UUID format"})
+		return
+	}
+
+	var req models.AlbumCoverFormRequest
+	if err := ctx.ShouldBind(&req); err != nil {
+		ctx.JSON(bindErrorStatus(err), gin.H{"error": fmt.Sprintf("Invalid form request: %v", err)})
+		return
+	}
+
+	// Periksa tipe dan ukuran file sebelum diupload
+	if _, err := utils.AlbumCoverRule().Validate(req.CoverFile); err != nil {
+		var fieldErr *utils.FieldError
+		if errors.As(err, &fieldErr) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file upload", "fields": gin.H{fieldErr.Field: fieldErr.Message}})
+		} else {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to read uploaded file: %v", err)})
+		}
+		return
+	}
+
+	// Album yang tidak ada tidak perlu menerima upload
+	var exists bool
+	err = c.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM albums WHERE album_id = $1)", id).Scan(&exists)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	if !exists {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Album not found"})
+		return
+	}
+
+	// Cover diupload sebelum transaksi dibuka agar baris album tidak
+	// terkunci selama upload
+	coverPath, variants, err := c.Storage.UploadImage(req.CoverFile, albumCoverFolder)
+	if err != nil {
+		ctx.JSON(storageErrorStatus(err), gin.H{"error": fmt.Sprintf("Failed to upload cover file: %v", err)})
+		return
+	}
+
+	// File yang baru diupload dihapus lagi jika transaksi gagal
+	uploaded := imageFiles(coverPath, variants)
+	defer func() {
+		if uploaded != nil {
+			c.Outbox.Discard(uploaded...)
+		}
+	}()
+
+	tx, err := c.DB.Begin()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	defer tx.Rollback()
+
+	// Kunci album dan ambil cover lama
+	var currentCover sql.NullString
+	var currentVariants []byte
+	err = tx.QueryRow(
+		"SELECT cover_image_path, cover_image_variants FROM albums WHERE album_id = $1 FOR UPDATE",
+		id,
+	).Scan(&currentCover, &currentVariants)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Album not found"})
+		} else {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		}
+		return
+	}
+
+	query := albumMutationQuery(`
+		UPDATE albums
+		SET cover_image_path = $1, cover_image_variants = $2
+		WHERE album_id = $3
+		RETURNING *
+	`)
+
+	album, err := scanAlbum(tx.QueryRow(query, coverPath, encodeImageVariants(variants), id))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	// Cover lama dihapus setelah commit berhasil
+	if currentCover.Valid {
+		if err := c.Outbox.Enqueue(tx, imageFiles(currentCover.String, decodeImageVariants(currentVariants))...); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	uploaded = nil
+	c.Outbox.Notify()
+
+	ctx.JSON(http.StatusOK, album)
+}
+
+// SetAlbumTracks menggantikan tracklist album. Lagu yang tidak disebut lagi
+// dilepas dari album, lagu dari album lain dipindahkan.
+func (c *AlbumController) SetAlbumTracks(ctx *gin.Context) {
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid UUID format"})
+		return
+	}
+
+	var req models.SetAlbumTracksRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid request: %v", err)})
+		return
+	}
+
+	// Setiap lagu dan posisi hanya boleh muncul sekali
+	songs := map[uuid.UUID]bool{}
+	positions := map[[2]int]bool{}
+	for i := range req.Tracks {
+		track := &req.Tracks[i]
+		if track.DiscNumber == 0 {
+			track.DiscNumber = 1
+		}
+
+		position := [2]int{track.DiscNumber, track.TrackNumber}
+		if songs[track.SongID] {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Song %s is listed more than once", track.SongID)})
+			return
+		}
+		if positions[position] {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Disc %d track %d is used more than once", track.DiscNumber, track.TrackNumber)})
+			return
+		}
+		songs[track.SongID] = true
+		positions[position] = true
+	}
+
+	tx, err := c.DB.Begin()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	defer tx.Rollback()
+
+	var albumID uuid.UUID
+	err = tx.QueryRow("SELECT album_id FROM albums WHERE album_id = $1 FOR UPDATE", id).Scan(&albumID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Album not found"})
+		} else {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		}
+		return
+	}
+
+	// Kosongkan tracklist lama dulu agar nomor track bisa ditukar
+	_, err = tx.Exec("UPDATE songs SET album_id = NULL, disc_number = NULL, track_number = NULL WHERE album_id = $1", id)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	for _, track := range req.Tracks {
+		result, err := tx.Exec(
+			"UPDATE songs SET album_id = $1, disc_number = $2, track_number = $3 WHERE song_id = $4",
+			id, track.DiscNumber, track.TrackNumber, track.SongID,
+		)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+			return
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+			return
+		}
+		if rowsAffected == 0 {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Song %s not found", track.SongID)})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	detail, err := c.albumDetail(id)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, detail)
+}
+
+// DeleteAlbum menghapus album, lagu di dalamnya tetap ada tanpa album
+func (c *AlbumController) DeleteAlbum(ctx *gin.Context) {
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid UUID format"})
+		return
+	}
+
+	tx, err := c.DB.Begin()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE songs SET album_id = NULL, disc_number = NULL, track_number = NULL WHERE album_id = $1", id)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	var coverImagePath sql.NullString
+	var coverImageVariants []byte
+	err = tx.QueryRow(
+		"DELETE FROM albums WHERE album_id = $1 RETURNING cover_image_path, cover_image_variants",
+		id,
+	).Scan(&coverImagePath, &coverImageVariants)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Album not found"})
+		} else {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		}
+		return
+	}
+
+	// Cover dihapus dari storage setelah commit
+	if coverImagePath.Valid {
+		if err := c.Outbox.Enqueue(tx, imageFiles(coverImagePath.String, decodeImageVariants(coverImageVariants))...); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	c.Outbox.Notify()
+
+	ctx.Status(http.StatusNoContent)
+}
@@ -0,0 +1,586 @@
+package controllers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	_ "time/tzdata" // Zona waktu tetap tersedia di server tanpa /usr/share/zoneinfo
+
+	ics "github.com/arran4/golang-ical"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"backend-turningjane/models"
+)
+
+const (
+	// eventLocalTimeLayout adalah format starts_at dan ends_at pada request
+	eventLocalTimeLayout = "2006-01-02T15:04"
+	// eventDefaultDuration dipakai sebagai DTEND di iCalendar jika ends_at kosong
+	eventDefaultDuration = 2 * time.Hour
+	// eventFeedHistory: konser yang sudah lewat tetap ada di feed selama ini,
+	// agar pembatalan dan perubahan terakhir sampai ke kalender pelanggan
+	eventFeedHistory = 90 * 24 * time.Hour
+	// eventUIDDomain membuat UID iCalendar unik secara global
+	eventUIDDomain = "turningjane"
+)
+
+// eventColumns adalah kolom yang dibaca oleh scanEvent
+const eventColumns = `
+	e.event_id, e.title, e.venue, e.city, e.country, e.starts_at, e.ends_at, e.time_zone,
+	e.ticket_url, e.status, e.description, e.sequence, e.created_at, e.updated_at
+`
+
+// eventMutationQuery membungkus INSERT/UPDATE ... RETURNING * agar hasilnya
+// memiliki kolom yang sama dengan eventColumns
+func eventMutationQuery(statement string) string {
+	return `WITH e AS (` + statement + `) SELECT ` + eventColumns + ` FROM e`
+}
+
+type EventController struct {
+	DB *sql.DB
+}
+
+func NewEventController(db *sql.DB) *EventController {
+	return &EventController{DB: db}
+}
+
+// Helper function to scan a row selected with eventColumns. The sequence
+// number is only needed for the iCalendar feed and returned separately.
+func scanEvent(row rowScanner) (models.Event, int, error) {
+	var event models.Event
+	var country, ticketURL, description sql.NullString
+	var endsAt sql.NullTime
+	var sequence int
+
+	err := row.Scan(
+		&event.EventID,
+		&event.Title,
+		&event.Venue,
+		&event.City,
+		&country,
+		&event.StartsAt,
+		&endsAt,
+		&event.TimeZone,
+		&ticketURL,
+		&event.Status,
+		&description,
+		&sequence,
+		&event.CreatedAt,
+		&event.UpdatedAt,
+	)
+	if err != nil {
+		return event, 0, err
+	}
+
+	// Tampilkan waktu konser dalam zona waktu lokasi konser
+	location, err := time.LoadLocation(event.TimeZone)
+	if err != nil {
+		location = time.UTC
+	}
+	event.StartsAt = event.StartsAt.In(location)
+	if endsAt.Valid {
+		value := endsAt.Time.In(location)
+		event.EndsAt = &value
+	}
+	if country.Valid {
+		event.Country = &country.String
+	}
+	if ticketURL.Valid {
+		event.TicketURL = &ticketURL.String
+	}
+	if description.Valid {
+		event.Description = &description.String
+	}
+	event.Setlist = []models.EventSetlistSong{}
+
+	return event, sequence, nil
+}
+
+// Helper function to load the setlists of the given events in one query
+func (c *EventController) loadSetlists(events []models.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(events))
+	index := map[uuid.UUID]int{}
+	for i, event := range events {
+		ids[i] = event.EventID.String()
+		index[event.EventID] = i
+	}
+
+	rows, err := c.DB.Query(`
+		SELECT es.event_id, es.position, s.song_id, s.title, s.artist
+		FROM event_setlist es
+		JOIN songs s ON s.song_id = es.song_id
+		WHERE es.event_id = ANY($1::uuid[])
+		ORDER BY es.event_id, es.position
+	`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var eventID uuid.UUID
+		var song models.EventSetlistSong
+		if err := rows.Scan(&eventID, &song.Position, &song.SongID, &song.Title, &song.Artist); err != nil {
+			return err
+		}
+		i := index[eventID]
+		events[i].Setlist = append(events[i].Setlist, song)
+	}
+
+	return rows.Err()
+}
+
+// Helper function to load one event with its setlist
+func (c *EventController) eventDetail(id uuid.UUID) (models.Event, error) {
+	event, _, err := scanEvent(c.DB.QueryRow("SELECT "+eventColumns+" FROM events e WHERE e.event_id = $1", id))
+	if err != nil {
+		return event, err
+	}
+
+	events := []models.Event{event}
+	err = c.loadSetlists(events)
+	return events[0], err
+}
+
+// Helper function to resolve an IANA time zone name
+func eventLocation(name string) (*time.Location, error) {
+	// "" dan "Local" diterima LoadLocation tetapi bergantung pada server
+	if name == "" || name == "Local" {
+		return nil, fmt.Errorf("unknown time zone %q", name)
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q", name)
+	}
+	return location, nil
+}
+
+// Helper function to replace the setlist of an event inside a transaction.
+// Returns a message for the client when a song does not exist.
+func replaceSetlist(tx *sql.Tx, eventID uuid.UUID, songIDs []uuid.UUID) (string, error) {
+	if _, err := tx.Exec("DELETE FROM event_setlist WHERE event_id = $1", eventID); err != nil {
+		return "", err
+	}
+	if len(songIDs) == 0 {
+		return "", nil
+	}
+
+	// Lagu yang sama boleh dimainkan lebih dari sekali, misalnya encore
+	unique := map[uuid.UUID]bool{}
+	ids := make([]string, len(songIDs))
+	for i, songID := range songIDs {
+		unique[songID] = true
+		ids[i] = songID.String()
+	}
+
+	var found int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM songs WHERE song_id = ANY($1::uuid[])", pq.Array(ids)).Scan(&found); err != nil {
+		return "", err
+	}
+	if found != len(unique) {
+		return "Setlist contains songs that do not exist", nil
+	}
+
+	_, err := tx.Exec(`
+		INSERT INTO event_setlist (event_id, position, song_id)
+		SELECT $1, o.ord, o.song_id FROM unnest($2::uuid[]) WITH ORDINALITY AS o(song_id, ord)
+	`, eventID, pq.Array(ids))
+	return "", err
+}
+
+// ListEvents mengambil jadwal konser. scope=upcoming (default) diurutkan dari
+// yang terdekat, scope=past dari yang terbaru.
+func (c *EventController) ListEvents(ctx *gin.Context) {
+	var req models.ListEventsQuery
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid query: %v", err)})
+		return
+	}
+
+	query := "SELECT " + eventColumns + " FROM events e"
+	switch req.Scope {
+	case "", "upcoming":
+		query += " WHERE COALESCE(e.ends_at, e.starts_at) >= NOW() ORDER BY e.starts_at, e.event_id"
+	case "past":
+		query += " WHERE COALESCE(e.ends_at, e.starts_at) < NOW() ORDER BY e.starts_at DESC, e.event_id"
+	default:
+		query += " ORDER BY e.starts_at DESC, e.event_id"
+	}
+
+	rows, err := c.DB.Query(query)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	defer rows.Close()
+
+	events := []models.Event{}
+	for rows.Next() {
+		event, _, err := scanEvent(rows)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+			return
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	if err := c.loadSetlists(events); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, events)
+}
+
+// GetEvent mengambil detail konser beserta setlist
+func (c *EventController) GetEvent(ctx *gin.Context) {
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid UUID format"})
+		return
+	}
+
+	event, err := c.eventDetail(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+		} else {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, event)
+}
+
+// CreateEvent menambahkan jadwal konser baru
+func (c *EventController) CreateEvent(ctx *gin.Context) {
+	var req models.CreateEventRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid request: %v", err)})
+		return
+	}
+
+	location, err := eventLocation(req.TimeZone)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	startsAt, _ := time.ParseInLocation(eventLocalTimeLayout, req.StartsAt, location)
+	var endsAt *time.Time
+	if req.EndsAt != nil {
+		value, _ := time.ParseInLocation(eventLocalTimeLayout, *req.EndsAt, location)
+		if !value.After(startsAt) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "ends_at must be after starts_at"})
+			return
+		}
+		endsAt = &value
+	}
+
+	if req.Status == "" {
+		req.Status = "announced"
+	}
+
+	tx, err := c.DB.Begin()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	defer tx.Rollback()
+
+	event, _, err := scanEvent(tx.QueryRow(eventMutationQuery(`
+		INSERT INTO events (title, venue, city, country, starts_at, ends_at, time_zone, ticket_url, status, description)
+		VALUES ($1, $2, $3, NULLIF($4::text, ''), $5, $6, $7, $8, $9, NULLIF($10::text, ''))
+		RETURNING *
+	`), req.Title, req.Venue, req.City, req.Country, startsAt, endsAt, req.TimeZone, req.TicketURL, req.Status, req.Description))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	message, err := replaceSetlist(tx, event.EventID, req.Setlist)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	if message != "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": message})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	event, err = c.eventDetail(event.EventID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, event)
+}
+
+// UpdateEvent memperbarui jadwal konser. Setiap perubahan menaikkan sequence
+// agar aplikasi kalender pelanggan ikut memperbarui acaranya.
+func (c *EventController) UpdateEvent(ctx *gin.Context) {
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid UUID format"})
+		return
+	}
+
+	var req models.UpdateEventRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid request: %v", err)})
+		return
+	}
+
+	// ends_at dan ticket_url boleh string kosong untuk menghapus, jadi divalidasi di sini
+	if req.EndsAt != nil && *req.EndsAt != "" {
+		if _, err := time.Parse(eventLocalTimeLayout, *req.EndsAt); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "ends_at must use the YYYY-MM-DDTHH:MM format"})
+			return
+		}
+	}
+	if req.TicketURL != nil && *req.TicketURL != "" && !strings.HasPrefix(*req.TicketURL, "http://") && !strings.HasPrefix(*req.TicketURL, "https://") {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "ticket_url must be an http or https URL"})
+		return
+	}
+
+	tx, err := c.DB.Begin()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	defer tx.Rollback()
+
+	var currentStartsAt time.Time
+	var currentEndsAt sql.NullTime
+	var currentTimeZone string
+	err = tx.QueryRow(
+		"SELECT starts_at, ends_at, time_zone FROM events WHERE event_id = $1 FOR UPDATE",
+		id,
+	).Scan(&currentStartsAt, &currentEndsAt, &currentTimeZone)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+		} else {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		}
+		return
+	}
+
+	timeZone := currentTimeZone
+	if req.TimeZone != nil {
+		timeZone = *req.TimeZone
+	}
+	location, err := eventLocation(timeZone)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	currentLocation, err := time.LoadLocation(currentTimeZone)
+	if err != nil {
+		currentLocation = time.UTC
+	}
+
+	// Waktu yang tidak diganti mempertahankan jam lokalnya di zona waktu baru
+	localTime := func(value *string, current time.Time) time.Time {
+		if value != nil {
+			parsed, _ := time.ParseInLocation(eventLocalTimeLayout, *value, location)
+			return parsed
+		}
+		parsed, _ := time.ParseInLocation(eventLocalTimeLayout, current.In(currentLocation).Format(eventLocalTimeLayout), location)
+		return parsed
+	}
+
+	startsAt := localTime(req.StartsAt, currentStartsAt)
+	var endsAt *time.Time
+	if req.EndsAt != nil && *req.EndsAt != "" {
+		value := localTime(req.EndsAt, time.Time{})
+		endsAt = &value
+	} else if req.EndsAt == nil && currentEndsAt.Valid {
+		value := localTime(nil, currentEndsAt.Time)
+		endsAt = &value
+	}
+	if endsAt != nil && !endsAt.After(startsAt) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "ends_at must be after starts_at"})
+		return
+	}
+
+	_, _, err = scanEvent(tx.QueryRow(eventMutationQuery(`
+		UPDATE events
+		SET
+			title = COALESCE($2, title),
+			venue = COALESCE($3, venue),
+			city = COALESCE($4, city),
+			country = CASE WHEN $5::text IS NULL THEN country ELSE NULLIF($5, '') END,
+			starts_at = $6,
+			ends_at = $7,
+			time_zone = $8,
+			ticket_url = CASE WHEN $9::text IS NULL THEN ticket_url ELSE NULLIF($9, '') END,
+			status = COALESCE($10, status),
+			description = CASE WHEN $11::text IS NULL THEN description ELSE NULLIF($11, '') END,
+			sequence = sequence + 1,
+			updated_at = NOW()
+		WHERE event_id = $1
+		RETURNING *
+	`), id, req.Title, req.Venue, req.City, req.Country, startsAt, endsAt, timeZone, req.TicketURL, req.Status, req.Description))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	if req.Setlist != nil {
+		message, err := replaceSetlist(tx, id, *req.Setlist)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+			return
+		}
+		if message != "" {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": message})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	event, err := c.eventDetail(id)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, event)
+}
+
+// DeleteEvent menghapus jadwal konser. Untuk konser yang batal lebih baik
+// ubah status menjadi cancelled agar pelanggan kalender ikut diberi tahu.
+func (c *EventController) DeleteEvent(ctx *gin.Context) {
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid UUID format"})
+		return
+	}
+
+	result, err := c.DB.Exec("DELETE FROM events WHERE event_id = $1", id)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	if rowsAffected == 0 {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Event deleted successfully"})
+}
+
+// EventsCalendar menyajikan jadwal konser sebagai feed iCalendar (RFC 5545)
+// yang bisa di-subscribe dari aplikasi kalender
+func (c *EventController) EventsCalendar(ctx *gin.Context) {
+	rows, err := c.DB.Query(
+		"SELECT "+eventColumns+" FROM events e WHERE COALESCE(e.ends_at, e.starts_at) >= NOW() - $1 * INTERVAL '1 second' ORDER BY e.starts_at, e.event_id",
+		int64(eventFeedHistory/time.Second),
+	)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	defer rows.Close()
+
+	generatedAt := time.Now()
+	cal := ics.NewCalendarFor("Turning Jane")
+	cal.SetMethod(ics.MethodPublish)
+	cal.SetName("Turning Jane Tour Dates")
+	cal.SetXWRCalName("Turning Jane Tour Dates")
+	cal.SetRefreshInterval("PT12H")
+
+	for rows.Next() {
+		event, sequence, err := scanEvent(rows)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+			return
+		}
+		addCalendarEvent(cal, event, sequence, generatedAt)
+	}
+	if err := rows.Err(); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	ctx.Header("Content-Disposition", `inline; filename="events.ics"`)
+	ctx.Data(http.StatusOK, "text/calendar; charset=utf-8", []byte(cal.Serialize()))
+}
+
+// Helper function to add an event to the iCalendar feed
+func addCalendarEvent(cal *ics.Calendar, event models.Event, sequence int, generatedAt time.Time) {
+	vevent := cal.AddEvent(event.EventID.String() + "@" + eventUIDDomain)
+	vevent.SetDtStampTime(generatedAt)
+	vevent.SetCreatedTime(event.CreatedAt)
+	vevent.SetModifiedAt(event.UpdatedAt)
+	vevent.SetSequence(sequence)
+	vevent.SetStartAt(event.StartsAt)
+	if event.EndsAt != nil {
+		vevent.SetEndAt(*event.EndsAt)
+	} else {
+		vevent.SetEndAt(event.StartsAt.Add(eventDefaultDuration))
+	}
+
+	summary := event.Title
+	switch event.Status {
+	case "sold_out":
+		summary += " (Sold out)"
+	case "cancelled":
+		summary += " (Cancelled)"
+	}
+	vevent.SetSummary(summary)
+
+	if event.Status == "cancelled" {
+		vevent.SetStatus(ics.ObjectStatusCancelled)
+	} else {
+		vevent.SetStatus(ics.ObjectStatusConfirmed)
+	}
+
+	location := []string{event.Venue, event.City}
+	if event.Country != nil {
+		location = append(location, *event.Country)
+	}
+	vevent.SetLocation(strings.Join(location, ", "))
+
+	var description []string
+	if event.Description != nil {
+		description = append(description, *event.Description)
+	}
+	if event.TicketURL != nil {
+		vevent.SetURL(*event.TicketURL)
+		description = append(description, "Tickets: "+*event.TicketURL)
+	}
+	if len(description) > 0 {
+		vevent.SetDescription(strings.Join(description, "\n\n"))
+	}
+}
@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"backend-turningjane/models"
+)
+
+type FavoriteController struct {
+	DB *sql.DB
+}
+
+func NewFavoriteController(db *sql.DB) *FavoriteController {
+	return &FavoriteController{DB: db}
+}
+
+// ListFavorites mengambil lagu favorit user yang sedang login, terbaru lebih dulu
+func (c *FavoriteController) ListFavorites(ctx *gin.Context) {
+	userID, ok := sessionUserID(ctx)
+	if !ok {
+		return
+	}
+
+	rows, err := c.DB.Query(`
+		SELECT `+songColumns+`, f.created_at
+		FROM favorites f
+		JOIN songs s ON s.song_id = f.song_id
+		LEFT JOIN genres g ON s.genre_id = g.genre_id
+		WHERE f.user_id = $1
+		ORDER BY f.created_at DESC, s.song_id
+	`, userID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	defer rows.Close()
+
+	favorites := []models.FavoriteSong{}
+	for rows.Next() {
+		var favorite models.FavoriteSong
+		favorite.SongResponse, err = scanSong(extraColumnsScanner{rows: rows, extra: []interface{}{&favorite.FavoritedAt}})
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+			return
+		}
+		favorites = append(favorites, favorite)
+	}
+
+	if err := rows.Err(); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, favorites)
+}
+
+// AddFavorite menandai lagu sebagai favorit, aman dipanggil berulang kali
+func (c *FavoriteController) AddFavorite(ctx *gin.Context) {
+	userID, ok := sessionUserID(ctx)
+	if !ok {
+		return
+	}
+
+	songID, err := uuid.Parse(ctx.Param("song_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid UUID format"})
+		return
+	}
+
+	result, err := c.DB.Exec(`
+		INSERT INTO favorites (user_id, song_id)
+		SELECT $1, song_id FROM songs WHERE song_id = $2
+		ON CONFLICT (user_id, song_id) DO NOTHING
+	`, userID, songID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	if rowsAffected == 0 {
+		// Tidak ada baris baru: lagu sudah favorit atau memang tidak ada
+		var exists bool
+		if err := c.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM songs WHERE song_id = $1)", songID).Scan(&exists); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+			return
+		}
+		if !exists {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Song not found"})
+			return
+		}
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"song_id": songID, "favorited": true})
+}
+
+// RemoveFavorite menghapus lagu dari daftar favorit
+func (c *FavoriteController) RemoveFavorite(ctx *gin.Context) {
+	userID, ok := sessionUserID(ctx)
+	if !ok {
+		return
+	}
+
+	songID, err := uuid.Parse(ctx.Param("song_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid UUID format"})
+		return
+	}
+
+	_, err = c.DB.Exec("DELETE FROM favorites WHERE user_id = $1 AND song_id = $2", userID, songID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"song_id": songID, "favorited": false})
+}
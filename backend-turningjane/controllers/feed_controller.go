@@ -0,0 +1,359 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/feeds"
+
+	"backend-turningjane/utils"
+)
+
+const (
+	// feedTitle dan feedDescription tampil di aplikasi pembaca feed
+	feedTitle       = "Turning Jane"
+	feedDescription = "Rilisan lagu dan berita terbaru dari Turning Jane"
+	// feedItemLimit adalah jumlah entri terbaru di dalam feed
+	feedItemLimit = 50
+	// enclosureRetryDelay adalah jeda sebelum StatFile yang gagal dicoba lagi
+	enclosureRetryDelay = time.Minute
+)
+
+type FeedController struct {
+	DB      *sql.DB
+	Storage utils.Storage
+
+	// enclosures menyimpan ukuran dan tipe file media per URL. File yang
+	// diupload tidak pernah ditimpa, jadi hasil StatFile tidak akan basi.
+	// StatFile yang gagal juga disimpan sebentar agar storage yang sedang
+	// bermasalah tidak dipanggil untuk setiap item di setiap request.
+	enclosures sync.Map
+}
+
+// cachedEnclosure adalah hasil StatFile, expires kosong jika berhasil
+type cachedEnclosure struct {
+	enclosure *feeds.Enclosure
+	expires   time.Time
+}
+
+func NewFeedController(db *sql.DB, storage utils.Storage) *FeedController {
+	return &FeedController{DB: db, Storage: storage}
+}
+
+// feedEntry adalah lagu atau berita yang akan menjadi satu item feed
+type feedEntry struct {
+	item  *feeds.Item
+	image *feeds.Enclosure
+}
+
+// Atom menyajikan lagu dan berita terbaru sebagai feed Atom
+func (c *FeedController) Atom(ctx *gin.Context) {
+	c.serveFeed(ctx, "atom")
+}
+
+// RSS menyajikan lagu dan berita terbaru sebagai feed RSS 2.0
+func (c *FeedController) RSS(ctx *gin.Context) {
+	c.serveFeed(ctx, "rss")
+}
+
+// Helper function to render a feed, answering conditional requests with
+// 304 Not Modified before the feed is built
+func (c *FeedController) serveFeed(ctx *gin.Context, format string) {
+	site := siteURL(ctx)
+
+	etag, lastModified, err := c.feedVersion(format, site)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	ctx.Header("ETag", etag)
+	if !lastModified.IsZero() {
+		ctx.Header("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+	ctx.Header("Cache-Control", "public, max-age=300")
+	if notModified(ctx.Request, etag, lastModified) {
+		ctx.Status(http.StatusNotModified)
+		return
+	}
+
+	entries, err := c.feedEntries(site)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	feed := &feeds.Feed{
+		Title:       feedTitle,
+		Link:        &feeds.Link{Href: site},
+		Description: feedDescription,
+		Updated:     lastModified,
+	}
+	if feed.Updated.IsZero() {
+		// Feed kosong tetap membutuhkan tanggal updated yang valid
+		feed.Updated = time.Now()
+	}
+	for _, entry := range entries {
+		feed.Add(entry.item)
+	}
+
+	var body string
+	var contentType string
+	if format == "atom" {
+		atom := (&feeds.Atom{Feed: feed}).AtomFeed()
+		for i, entry := range entries {
+			atom.Entries[i].Published = entry.item.Created.UTC().Format(time.RFC3339)
+			// Atom boleh punya lebih dari satu enclosure, cover lagu ikut disertakan
+			if entry.image != nil && entry.image != entry.item.Enclosure {
+				atom.Entries[i].Links = append(atom.Entries[i].Links, feeds.AtomLink{
+					Href:   entry.image.Url,
+					Rel:    "enclosure",
+					Type:   entry.image.Type,
+					Length: entry.image.Length,
+				})
+			}
+		}
+		body, err = feeds.ToXML(atom)
+		contentType = "application/atom+xml; charset=utf-8"
+	} else {
+		body, err = feed.ToRss()
+		contentType = "application/rss+xml; charset=utf-8"
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to render feed: %v", err)})
+		return
+	}
+
+	ctx.Data(http.StatusOK, contentType, []byte(body))
+}
+
+// Helper function to compute the validators of a feed. Adding, changing or
+// removing a song or published post changes the count or the newest
+// updated_at, so the ETag changes with the feed content.
+func (c *FeedController) feedVersion(format, site string) (string, time.Time, error) {
+	var songCount, postCount int
+	var songsUpdated, postsUpdated sql.NullTime
+	err := c.DB.QueryRow(`
+		SELECT
+			(SELECT COUNT(*) FROM songs),
+			(SELECT MAX(updated_at) FROM songs),
+			(SELECT COUNT(*) FROM posts WHERE status = 'published'),
+			(SELECT MAX(updated_at) FROM posts WHERE status = 'published')
+	`).Scan(&songCount, &songsUpdated, &postCount, &postsUpdated)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	var lastModified time.Time
+	if songsUpdated.Valid {
+		lastModified = songsUpdated.Time
+	}
+	if postsUpdated.Valid && postsUpdated.Time.After(lastModified) {
+		lastModified = postsUpdated.Time
+	}
+
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%d\x00%d\x00%d", format, site, songCount, postCount, lastModified.UnixNano())))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`, lastModified, nil
+}
+
+// Helper function to load the newest songs and published posts, newest first
+func (c *FeedController) feedEntries(site string) ([]feedEntry, error) {
+	var entries []feedEntry
+
+	rows, err := c.DB.Query(`
+		SELECT s.song_id, s.title, s.artist, g.genre_name, s.release_year, s.audio_file_path, s.image_path, s.created_at, s.updated_at
+		FROM songs s
+		LEFT JOIN genres g ON s.genre_id = g.genre_id
+		ORDER BY s.created_at DESC, s.song_id
+		LIMIT $1
+	`, feedItemLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var songID uuid.UUID
+		var title, artist string
+		var genreName, audioFilePath, imagePath sql.NullString
+		var releaseYear sql.NullInt64
+		var createdAt, updatedAt time.Time
+		if err := rows.Scan(&songID, &title, &artist, &genreName, &releaseYear, &audioFilePath, &imagePath, &createdAt, &updatedAt); err != nil {
+			return nil, err
+		}
+
+		details := []string{}
+		if genreName.Valid {
+			details = append(details, genreName.String)
+		}
+		if releaseYear.Valid {
+			details = append(details, strconv.FormatInt(releaseYear.Int64, 10))
+		}
+		description := html.EscapeString(fmt.Sprintf("%s oleh %s", title, artist))
+		if len(details) > 0 {
+			description += html.EscapeString(" (" + strings.Join(details, ", ") + ")")
+		}
+
+		entry := feedEntry{item: &feeds.Item{
+			Title:       fmt.Sprintf("%s - %s", artist, title),
+			Link:        &feeds.Link{Href: site + "/songs/" + songID.String()},
+			Description: description,
+			Id:          "urn:uuid:" + songID.String(),
+			Created:     createdAt,
+			Updated:     updatedAt,
+		}}
+		if imagePath.Valid && imagePath.String != "" {
+			entry.image = c.enclosure(imagePath.String)
+		}
+		// RSS hanya mengizinkan satu enclosure, audio lebih diutamakan
+		if audioFilePath.Valid && audioFilePath.String != "" {
+			entry.item.Enclosure = c.enclosure(audioFilePath.String)
+		} else {
+			entry.item.Enclosure = entry.image
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	postRows, err := c.DB.Query(`
+		SELECT p.post_id, p.title, p.slug, p.excerpt, p.body_html, p.cover_image_path, p.publish_at, p.updated_at
+		FROM posts p
+		WHERE p.status = 'published'
+		ORDER BY p.publish_at DESC, p.post_id DESC
+		LIMIT $1
+	`, feedItemLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer postRows.Close()
+
+	for postRows.Next() {
+		var postID uuid.UUID
+		var title, slug, bodyHTML string
+		var excerpt, coverImagePath sql.NullString
+		var publishAt, updatedAt time.Time
+		if err := postRows.Scan(&postID, &title, &slug, &excerpt, &bodyHTML, &coverImagePath, &publishAt, &updatedAt); err != nil {
+			return nil, err
+		}
+
+		summary := excerpt.String
+		if !excerpt.Valid {
+			summary = utils.MarkdownExcerpt(bodyHTML, postExcerptLength)
+		}
+
+		entry := feedEntry{item: &feeds.Item{
+			Title:       title,
+			Link:        &feeds.Link{Href: site + "/posts/" + slug},
+			Description: html.EscapeString(summary),
+			Content:     bodyHTML,
+			Id:          "urn:uuid:" + postID.String(),
+			Created:     publishAt,
+			Updated:     updatedAt,
+		}}
+		if coverImagePath.Valid && coverImagePath.String != "" {
+			entry.image = c.enclosure(coverImagePath.String)
+			entry.item.Enclosure = entry.image
+		}
+		entries = append(entries, entry)
+	}
+	if err := postRows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].item.Created.After(entries[j].item.Created)
+	})
+	if len(entries) > feedItemLimit {
+		entries = entries[:feedItemLimit]
+	}
+	return entries, nil
+}
+
+// Helper function to describe a media file as an enclosure. When the storage
+// cannot be reached the length is reported as 0, as RSS readers expect for
+// an unknown size, and the lookup is retried after enclosureRetryDelay.
+func (c *FeedController) enclosure(url string) *feeds.Enclosure {
+	if value, ok := c.enclosures.Load(url); ok {
+		cached := value.(cachedEnclosure)
+		if cached.expires.IsZero() || time.Now().Before(cached.expires) {
+			return cached.enclosure
+		}
+	}
+
+	enclosure := &feeds.Enclosure{Url: url, Length: "0", Type: mime.TypeByExtension(path.Ext(url))}
+	if enclosure.Type == "" {
+		enclosure.Type = "application/octet-stream"
+	}
+
+	info, err := c.Storage.StatFile(url)
+	if err != nil {
+		c.enclosures.Store(url, cachedEnclosure{enclosure: enclosure, expires: time.Now().Add(enclosureRetryDelay)})
+		return enclosure
+	}
+	enclosure.Length = strconv.FormatInt(info.Size, 10)
+	if info.ContentType != "" {
+		enclosure.Type = info.ContentType
+	}
+	c.enclosures.Store(url, cachedEnclosure{enclosure: enclosure})
+	return enclosure
+}
+
+// Helper function to build the public site URL used for links in feeds.
+// SITE_URL is used when set, otherwise the URL of the request.
+func siteURL(ctx *gin.Context) string {
+	if site := configuredSiteURL(); site != "" {
+		return site
+	}
+	return requestBaseURL(ctx)
+}
+
+// Helper function to read SITE_URL without a trailing slash. Links sent by
+// email must use it instead of the request, whose Host header the client
+// controls.
+func configuredSiteURL() string {
+	return strings.TrimRight(os.Getenv("SITE_URL"), "/")
+}
+
+// Helper function to build the scheme and host the request was sent to
+func requestBaseURL(ctx *gin.Context) string {
+	scheme := "http"
+	if ctx.Request.TLS != nil || ctx.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + ctx.Request.Host
+}
+
+// Helper function to evaluate If-None-Match and If-Modified-Since. As in
+// RFC 9110, If-Modified-Since is ignored when If-None-Match is present.
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == "*" || candidate == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !lastModified.IsZero() {
+		return !lastModified.Truncate(time.Second).After(since)
+	}
+	return false
+}
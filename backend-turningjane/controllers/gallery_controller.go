@@ -0,0 +1,793 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"backend-turningjane/models"
+	"backend-turningjane/utils"
+)
+
+// galleryPhotoFolder adalah folder storage untuk foto galeri
+const galleryPhotoFolder = "gallery_photos"
+
+// galleryPhotoColumns adalah kolom yang dibaca oleh scanGalleryPhoto
+const galleryPhotoColumns = `
+	p.photo_id, p.album_id, p.image_path, p.image_variants, p.caption, p.photographer, p.position, p.created_at
+`
+
+// galleryAlbumQuery memilih album beserta jumlah foto dan cover-nya. Cover
+// adalah cover_photo_id jika dipilih, selain itu foto pertama album.
+const galleryAlbumQuery = `
+	SELECT
+		a.album_id, a.title, a.slug, a.description, a.position, a.created_at, a.updated_at,
+		(SELECT COUNT(*) FROM gallery_photos cp WHERE cp.album_id = a.album_id),
+		p.photo_id, p.album_id, p.image_path, p.image_variants, p.caption, p.photographer, p.position, p.created_at
+	FROM gallery_albums a
+	LEFT JOIN LATERAL (
+		SELECT *
+		FROM gallery_photos lp
+		WHERE lp.album_id = a.album_id
+		ORDER BY (lp.photo_id = a.cover_photo_id) IS TRUE DESC, lp.position, lp.created_at
+		LIMIT 1
+	) p ON TRUE
+`
+
+// galleryAlbumOrder adalah urutan album di galeri
+const galleryAlbumOrder = ` ORDER BY a.position, a.created_at DESC`
+
+type GalleryController struct {
+	DB      *sql.DB
+	Storage utils.Storage
+	Outbox  *utils.DeletionOutbox
+}
+
+func NewGalleryController(db *sql.DB, storage utils.Storage, outbox *utils.DeletionOutbox) *GalleryController {
+	return &GalleryController{
+		DB:      db,
+		Storage: storage,
+		Outbox:  outbox,
+	}
+}
+
+// Helper function to scan a row selected with galleryPhotoColumns
+func scanGalleryPhoto(row rowScanner) (models.GalleryPhoto, error) {
+	var photo models.GalleryPhoto
+	var imageVariants []byte
+	var caption, photographer sql.NullString
+
+	err := row.Scan(
+		&photo.PhotoID,
+		&photo.AlbumID,
+		&photo.ImagePath,
+		&imageVariants,
+		&caption,
+		&photographer,
+		&photo.Position,
+		&photo.CreatedAt,
+	)
+	if err != nil {
+		return photo, err
+	}
+
+	photo.ImageVariants = decodeImageVariants(imageVariants)
+	if caption.Valid {
+		photo.Caption = &caption.String
+	}
+	if photographer.Valid {
+		photo.Photographer = &photographer.String
+	}
+	return photo, nil
+}
+
+// Helper function to scan a row selected with galleryAlbumQuery
+func scanGalleryAlbum(row rowScanner) (models.GalleryAlbum, error) {
+	var album models.GalleryAlbum
+	var description sql.NullString
+	var coverID, coverAlbumID uuid.NullUUID
+	var coverPath, coverCaption, coverPhotographer sql.NullString
+	var coverVariants []byte
+	var coverPosition sql.NullInt64
+	var coverCreatedAt sql.NullTime
+
+	err := row.Scan(
+		&album.AlbumID,
+		&album.Title,
+		&album.Slug,
+		&description,
+		&album.Position,
+		&album.CreatedAt,
+		&album.UpdatedAt,
+		&album.PhotoCount,
+		&coverID,
+		&coverAlbumID,
+		&coverPath,
+		&coverVariants,
+		&coverCaption,
+		&coverPhotographer,
+		&coverPosition,
+		&coverCreatedAt,
+	)
+	if err != nil {
+		return album, err
+	}
+
+	if description.Valid {
+		album.Description = &description.String
+	}
+	if coverID.Valid {
+		cover := &models.GalleryPhoto{
+			PhotoID:       coverID.UUID,
+			AlbumID:       coverAlbumID.UUID,
+			ImagePath:     coverPath.String,
+			ImageVariants: decodeImageVariants(coverVariants),
+			Position:      int(coverPosition.Int64),
+			CreatedAt:     coverCreatedAt.Time,
+		}
+		if coverCaption.Valid {
+			cover.Caption = &coverCaption.String
+		}
+		if coverPhotographer.Valid {
+			cover.Photographer = &coverPhotographer.String
+		}
+		album.CoverPhoto = cover
+	}
+	return album, nil
+}
+
+// Helper function to list albums, albums without photos are only included
+// for admins
+func (c *GalleryController) listAlbums(includeEmpty bool) ([]models.GalleryAlbum, error) {
+	query := galleryAlbumQuery
+	if !includeEmpty {
+		query += ` WHERE p.photo_id IS NOT NULL`
+	}
+
+	rows, err := c.DB.Query(query + galleryAlbumOrder)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	albums := []models.GalleryAlbum{}
+	for rows.Next() {
+		album, err := scanGalleryAlbum(rows)
+		if err != nil {
+			return nil, err
+		}
+		albums = append(albums, album)
+	}
+	return albums, rows.Err()
+}
+
+// Helper function to load an album with all of its photos in order
+func (c *GalleryController) albumDetail(where string, arg interface{}) (models.GalleryAlbumDetailResponse, error) {
+	var detail models.GalleryAlbumDetailResponse
+
+	album, err := scanGalleryAlbum(c.DB.QueryRow(galleryAlbumQuery+" WHERE "+where, arg))
+	if err != nil {
+		return detail, err
+	}
+	detail.GalleryAlbum = album
+
+	rows, err := c.DB.Query(
+		"SELECT "+galleryPhotoColumns+" FROM gallery_photos p WHERE p.album_id = $1 ORDER BY p.position, p.created_at",
+		album.AlbumID,
+	)
+	if err != nil {
+		return detail, err
+	}
+	defer rows.Close()
+
+	detail.Photos = []models.GalleryPhoto{}
+	for rows.Next() {
+		photo, err := scanGalleryPhoto(rows)
+		if err != nil {
+			return detail, err
+		}
+		detail.Photos = append(detail.Photos, photo)
+	}
+	return detail, rows.Err()
+}
+
+// Helper function to respond with an album after a change
+func (c *GalleryController) respondAlbumDetail(ctx *gin.Context, albumID uuid.UUID) {
+	detail, err := c.albumDetail("a.album_id = $1", albumID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	ctx.JSON(http.StatusOK, detail)
+}
+
+// Helper function to lock an album inside a transaction. It writes a 404 or
+// 500 response and returns false when the album cannot be locked.
+func lockGalleryAlbum(ctx *gin.Context, tx *sql.Tx, albumID uuid.UUID) bool {
+	var id uuid.UUID
+	err := tx.QueryRow("SELECT album_id FROM gallery_albums WHERE album_id = $1 FOR UPDATE", albumID).Scan(&id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Album not found"})
+		} else {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		}
+		return false
+	}
+	return true
+}
+
+// Helper function to check that no album uses the slug
+func (c *GalleryController) slugTaken(slug string) (bool, error) {
+	var exists bool
+	err := c.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM gallery_albums WHERE slug = $1)", slug).Scan(&exists)
+	return exists, err
+}
+
+// Helper function to parse the album and photo ids of a photo route
+func galleryPhotoParams(ctx *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	albumID, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid UUID format"})
+		return uuid.Nil, uuid.Nil, false
+	}
+	photoID, err := uuid.Parse(ctx.Param("photo_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid UUID format"})
+		return uuid.Nil, uuid.Nil, false
+	}
+	return albumID, photoID, true
+}
+
+// ListGalleryAlbums mengambil album galeri yang sudah memiliki foto untuk publik
+func (c *GalleryController) ListGalleryAlbums(ctx *gin.Context) {
+	albums, err := c.listAlbums(false)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	ctx.JSON(http.StatusOK, albums)
+}
+
+// GetGalleryAlbum mengambil album galeri beserta fotonya berdasarkan slug
+func (c *GalleryController) GetGalleryAlbum(ctx *gin.Context) {
+	detail, err := c.albumDetail("a.slug = $1", ctx.Param("slug"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Album not found"})
+		} else {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		}
+		return
+	}
+	ctx.JSON(http.StatusOK, detail)
+}
+
+// ListAdminGalleryAlbums mengambil semua album galeri termasuk yang masih kosong
+func (c *GalleryController) ListAdminGalleryAlbums(ctx *gin.Context) {
+	albums, err := c.listAlbums(true)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	ctx.JSON(http.StatusOK, albums)
+}
+
+// GetAdminGalleryAlbum mengambil album galeri beserta fotonya berdasarkan ID
+func (c *GalleryController) GetAdminGalleryAlbum(ctx *gin.Context) {
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid UUID format"})
+		return
+	}
+
+	detail, err := c.albumDetail("a.album_id = $1", id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Album not found"})
+		} else {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		}
+		return
+	}
+	ctx.JSON(http.StatusOK, detail)
+}
+
+// CreateGalleryAlbum membuat album galeri baru di urutan paling atas. Slug
+// dibuat dari judul dan tidak berubah saat judul diganti.
+func (c *GalleryController) CreateGalleryAlbum(ctx *gin.Context) {
+	var req models.CreateGalleryAlbumRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid request: %v", err)})
+		return
+	}
+
+	slug, err := utils.UniqueSlug(req.Title, c.slugTaken)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to generate slug: %v", err)})
+		return
+	}
+
+	var albumID uuid.UUID
+	err = c.DB.QueryRow(`
+		INSERT INTO gallery_albums (title, slug, description, position)
+		VALUES ($1, $2, NULLIF($3::text, ''), (SELECT COALESCE(MIN(position), 1) - 1 FROM gallery_albums))
+		RETURNING album_id
+	`, req.Title, slug, req.Description).Scan(&albumID)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			ctx.JSON(http.StatusConflict, gin.H{"error": "Slug already exists"})
+		} else {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		}
+		return
+	}
+
+	detail, err := c.albumDetail("a.album_id = $1", albumID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	ctx.JSON(http.StatusCreated, detail)
+}
+
+// UpdateGalleryAlbum memperbarui album galeri, hanya field yang dikirim yang
+// diubah. cover_photo_id harus foto dari album ini, string kosong kembali ke
+// foto pertama.
+func (c *GalleryController) UpdateGalleryAlbum(ctx *gin.Context) {
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid UUID format"})
+		return
+	}
+
+	var req models.UpdateGalleryAlbumRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid request: %v", err)})
+		return
+	}
+
+	var coverPhotoID uuid.NullUUID
+	if req.CoverPhotoID != nil && *req.CoverPhotoID != "" {
+		coverPhotoID.UUID, err = uuid.Parse(*req.CoverPhotoID)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cover_photo_id format"})
+			return
+		}
+		coverPhotoID.Valid = true
+	}
+
+	tx, err := c.DB.Begin()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	defer tx.Rollback()
+
+	if !lockGalleryAlbum(ctx, tx, id) {
+		return
+	}
+
+	if coverPhotoID.Valid {
+		var exists bool
+		err := tx.QueryRow(
+			"SELECT EXISTS (SELECT 1 FROM gallery_photos WHERE photo_id = $1 AND album_id = $2)",
+			coverPhotoID.UUID, id,
+		).Scan(&exists)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+			return
+		}
+		if !exists {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "cover_photo_id must be a photo of this album"})
+			return
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE gallery_albums
+		SET
+			title = COALESCE($1, title),
+			description = CASE WHEN $2::text IS NULL THEN description ELSE NULLIF($2, '') END,
+			cover_photo_id = CASE WHEN $3 THEN $4 ELSE cover_photo_id END,
+			updated_at = NOW()
+		WHERE album_id = $5
+	`, req.Title, req.Description, req.CoverPhotoID != nil, coverPhotoID, id)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	c.respondAlbumDetail(ctx, id)
+}
+
+// DeleteGalleryAlbum menghapus album galeri beserta semua fotonya
+func (c *GalleryController) DeleteGalleryAlbum(ctx *gin.Context) {
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid UUID format"})
+		return
+	}
+
+	tx, err := c.DB.Begin()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	defer tx.Rollback()
+
+	if !lockGalleryAlbum(ctx, tx, id) {
+		return
+	}
+
+	rows, err := tx.Query("DELETE FROM gallery_photos WHERE album_id = $1 RETURNING image_path, image_variants", id)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	var files []string
+	for rows.Next() {
+		var imagePath string
+		var imageVariants []byte
+		if err := rows.Scan(&imagePath, &imageVariants); err != nil {
+			rows.Close()
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+			return
+		}
+		files = append(files, imageFiles(imagePath, decodeImageVariants(imageVariants))...)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	if _, err := tx.Exec("DELETE FROM gallery_albums WHERE album_id = $1", id); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	// Foto dihapus dari storage setelah commit
+	if len(files) > 0 {
+		if err := c.Outbox.Enqueue(tx, files...); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	c.Outbox.Notify()
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// ReorderGalleryAlbums menyusun ulang album galeri. album_ids harus berisi
+// setiap album tepat satu kali.
+func (c *GalleryController) ReorderGalleryAlbums(ctx *gin.Context) {
+	var req models.ReorderGalleryAlbumsRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid request: %v", err)})
+		return
+	}
+
+	tx, err := c.DB.Begin()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	defer tx.Rollback()
+
+	current, err := lockedIDs(tx, "SELECT album_id FROM gallery_albums FOR UPDATE")
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	albumIDs, ok := permutation(req.AlbumIDs, current)
+	if !ok {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "album_ids must list every album exactly once"})
+		return
+	}
+
+	_, err = tx.Exec(`
+		UPDATE gallery_albums a
+		SET position = o.ord - 1
+		FROM unnest($1::uuid[]) WITH ORDINALITY AS o(album_id, ord)
+		WHERE a.album_id = o.album_id
+	`, pq.Array(albumIDs))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	c.ListAdminGalleryAlbums(ctx)
+}
+
+// UploadGalleryPhoto mengupload foto baru ke akhir album galeri
+func (c *GalleryController) UploadGalleryPhoto(ctx *gin.Context) {
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid UUID format"})
+		return
+	}
+
+	var req models.GalleryPhotoFormRequest
+	if err := ctx.ShouldBind(&req); err != nil {
+		ctx.JSON(bindErrorStatus(err), gin.H{"error": fmt.Sprintf("Invalid form request: %v", err)})
+		return
+	}
+
+	// Periksa tipe dan ukuran file sebelum diupload
+	if _, err := utils.GalleryPhotoRule().Validate(req.PhotoFile); err != nil {
+		var fieldErr *utils.FieldError
+		if errors.As(err, &fieldErr) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file upload", "fields": gin.H{fieldErr.Field: fieldErr.Message}})
+		} else {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to read uploaded file: %v", err)})
+		}
+		return
+	}
+
+	// Album yang tidak ada tidak perlu menerima upload
+	var exists bool
+	err = c.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM gallery_albums WHERE album_id = $1)", id).Scan(&exists)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	if !exists {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Album not found"})
+		return
+	}
+
+	// Foto diupload sebelum transaksi dibuka agar album tidak terkunci
+	// selama upload
+	imagePath, variants, err := c.Storage.UploadImage(req.PhotoFile, galleryPhotoFolder)
+	if err != nil {
+		ctx.JSON(storageErrorStatus(err), gin.H{"error": fmt.Sprintf("Failed to upload photo file: %v", err)})
+		return
+	}
+
+	// File yang baru diupload dihapus lagi jika transaksi gagal
+	uploaded := imageFiles(imagePath, variants)
+	defer func() {
+		if uploaded != nil {
+			c.Outbox.Discard(uploaded...)
+		}
+	}()
+
+	tx, err := c.DB.Begin()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	defer tx.Rollback()
+
+	// Album dikunci agar dua upload bersamaan tidak mendapat posisi yang sama
+	if !lockGalleryAlbum(ctx, tx, id) {
+		return
+	}
+
+	photo, err := scanGalleryPhoto(tx.QueryRow(`
+		WITH p AS (
+			INSERT INTO gallery_photos (album_id, image_path, image_variants, caption, photographer, position)
+			VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''),
+				(SELECT COALESCE(MAX(position) + 1, 0) FROM gallery_photos WHERE album_id = $1))
+			RETURNING *
+		)
+		SELECT `+galleryPhotoColumns+` FROM p
+	`, id, imagePath, encodeImageVariants(variants), req.Caption, req.Photographer))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE gallery_albums SET updated_at = NOW() WHERE album_id = $1", id); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	uploaded = nil
+
+	ctx.JSON(http.StatusCreated, photo)
+}
+
+// UpdateGalleryPhoto memperbarui caption dan kredit fotografer sebuah foto
+func (c *GalleryController) UpdateGalleryPhoto(ctx *gin.Context) {
+	albumID, photoID, ok := galleryPhotoParams(ctx)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateGalleryPhotoRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid request: %v", err)})
+		return
+	}
+
+	photo, err := scanGalleryPhoto(c.DB.QueryRow(`
+		WITH p AS (
+			UPDATE gallery_photos
+			SET
+				caption = CASE WHEN $1::text IS NULL THEN caption ELSE NULLIF($1, '') END,
+				photographer = CASE WHEN $2::text IS NULL THEN photographer ELSE NULLIF($2, '') END
+			WHERE photo_id = $3 AND album_id = $4
+			RETURNING *
+		)
+		SELECT `+galleryPhotoColumns+` FROM p
+	`, req.Caption, req.Photographer, photoID, albumID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Photo not found"})
+		} else {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, photo)
+}
+
+// DeleteGalleryPhoto menghapus foto dari album galeri. Jika foto tersebut
+// adalah cover, album kembali memakai foto pertama sebagai cover.
+func (c *GalleryController) DeleteGalleryPhoto(ctx *gin.Context) {
+	albumID, photoID, ok := galleryPhotoParams(ctx)
+	if !ok {
+		return
+	}
+
+	tx, err := c.DB.Begin()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	defer tx.Rollback()
+
+	var imagePath string
+	var imageVariants []byte
+	err = tx.QueryRow(
+		"DELETE FROM gallery_photos WHERE photo_id = $1 AND album_id = $2 RETURNING image_path, image_variants",
+		photoID, albumID,
+	).Scan(&imagePath, &imageVariants)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Photo not found"})
+		} else {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		}
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE gallery_albums SET updated_at = NOW() WHERE album_id = $1", albumID); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	// Foto dihapus dari storage setelah commit
+	if err := c.Outbox.Enqueue(tx, imageFiles(imagePath, decodeImageVariants(imageVariants))...); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	c.Outbox.Notify()
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// ReorderGalleryPhotos menyusun ulang foto album. photo_ids harus berisi
+// setiap foto album tepat satu kali.
+func (c *GalleryController) ReorderGalleryPhotos(ctx *gin.Context) {
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid UUID format"})
+		return
+	}
+
+	var req models.ReorderGalleryPhotosRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid request: %v", err)})
+		return
+	}
+
+	tx, err := c.DB.Begin()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	defer tx.Rollback()
+
+	if !lockGalleryAlbum(ctx, tx, id) {
+		return
+	}
+
+	current, err := lockedIDs(tx, "SELECT photo_id FROM gallery_photos WHERE album_id = $1", id)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	photoIDs, ok := permutation(req.PhotoIDs, current)
+	if !ok {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "photo_ids must list every photo of the album exactly once"})
+		return
+	}
+
+	_, err = tx.Exec(`
+		UPDATE gallery_photos p
+		SET position = o.ord - 1
+		FROM unnest($2::uuid[]) WITH ORDINALITY AS o(photo_id, ord)
+		WHERE p.album_id = $1 AND p.photo_id = o.photo_id
+	`, id, pq.Array(photoIDs))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE gallery_albums SET updated_at = NOW() WHERE album_id = $1", id); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	c.respondAlbumDetail(ctx, id)
+}
+
+// Helper function to read a set of ids inside a transaction
+func lockedIDs(tx *sql.Tx, query string, args ...interface{}) (map[uuid.UUID]bool, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := map[uuid.UUID]bool{}
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+	return ids, rows.Err()
+}
+
+// Helper function to check that ids lists every id of current exactly once.
+// It returns the ids as strings for pq.Array.
+func permutation(ids []uuid.UUID, current map[uuid.UUID]bool) ([]string, bool) {
+	seen := map[uuid.UUID]bool{}
+	ordered := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if !current[id] || seen[id] {
+			return nil, false
+		}
+		seen[id] = true
+		ordered = append(ordered, id.String())
+	}
+	return ordered, len(seen) == len(current)
+}
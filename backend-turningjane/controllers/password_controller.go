@@ -0,0 +1,310 @@
+package controllers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	"backend-turningjane/utils"
+)
+
+const (
+	// defaultPasswordResetTTL adalah masa berlaku token jika PASSWORD_RESET_TTL kosong
+	defaultPasswordResetTTL = time.Hour
+	// passwordResetEmailLimit dan passwordResetIPLimit adalah jumlah permintaan
+	// reset per jam untuk satu email dan satu alamat IP
+	passwordResetEmailLimit = 3
+	passwordResetIPLimit    = 10
+)
+
+// forgotPasswordMessage sama untuk email terdaftar maupun tidak, agar
+// endpoint tidak bisa dipakai menebak email yang terdaftar
+const forgotPasswordMessage = "If the email is registered, a password reset link has been sent"
+
+type PasswordController struct {
+	DB     *sql.DB
+	Mailer utils.Mailer
+	TTL    time.Duration
+	// ResetURL adalah halaman reset password, kosong jika belum dikonfigurasi
+	ResetURL string
+
+	emailLimiter *utils.RateLimiter
+	ipLimiter    *utils.RateLimiter
+}
+
+func NewPasswordController(db *sql.DB, mailer utils.Mailer) *PasswordController {
+	ttl := defaultPasswordResetTTL
+	if value := os.Getenv("PASSWORD_RESET_TTL"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			log.Printf("Invalid PASSWORD_RESET_TTL %q, using %s", value, defaultPasswordResetTTL)
+		} else {
+			ttl = parsed
+		}
+	}
+
+	// Link reset tidak pernah dibangun dari header Host request, tanpa URL
+	// yang dikonfigurasi email reset tidak dikirim
+	resetURL := passwordResetURL()
+	if resetURL == "" {
+		log.Printf("ERROR: PASSWORD_RESET_URL and SITE_URL are not set, password reset emails are disabled")
+	}
+
+	return &PasswordController{
+		DB:           db,
+		Mailer:       mailer,
+		TTL:          ttl,
+		ResetURL:     resetURL,
+		emailLimiter: utils.NewRateLimiter(passwordResetEmailLimit, time.Hour),
+		ipLimiter:    utils.NewRateLimiter(passwordResetIPLimit, time.Hour),
+	}
+}
+
+// ForgotPasswordRequest for requesting a password reset email
+type ForgotPasswordRequest struct {
+	Email       string `json:"email" binding:"required,email"`
+	AccountType string `json:"account_type" binding:"omitempty,oneof=user admin"`
+}
+
+// ResetPasswordRequest for setting a new password with a reset token
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=6"`
+}
+
+// Helper function to pick the table that stores accounts of the given type
+func accountTable(accountType string) string {
+	if accountType == "admin" {
+		return "admins"
+	}
+	return "users"
+}
+
+// Helper function to pick the page the reset email links to. It is
+// PASSWORD_RESET_URL, or /reset-password on SITE_URL, or empty when neither
+// is set.
+func passwordResetURL() string {
+	if base := os.Getenv("PASSWORD_RESET_URL"); base != "" {
+		return base
+	}
+	if site := configuredSiteURL(); site != "" {
+		return site + "/reset-password"
+	}
+	return ""
+}
+
+// Helper function to append a token to a link as the token query parameter
+func tokenLink(base, token string) string {
+	separator := "?"
+	if strings.Contains(base, "?") {
+		separator = "&"
+	}
+	return base + separator + "token=" + url.QueryEscape(token)
+}
+
+// Helper function to describe a token lifetime in the email, e.g. "1 jam"
+func formatTTL(ttl time.Duration) string {
+	if ttl >= time.Hour && ttl%time.Hour == 0 {
+		return fmt.Sprintf("%d jam", ttl/time.Hour)
+	}
+	if ttl >= time.Minute {
+		return fmt.Sprintf("%d menit", ttl/time.Minute)
+	}
+	return ttl.String()
+}
+
+// Helper function to reject a request over a rate limit with 429
+func rateLimited(ctx *gin.Context, limiter *utils.RateLimiter, key string) bool {
+	allowed, retryAfter := limiter.Allow(key)
+	if allowed {
+		return false
+	}
+
+	ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	ctx.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many password reset requests, try again later"})
+	return true
+}
+
+// ForgotPassword mengirim link reset password ke email user atau admin.
+// Respons selalu sama baik email terdaftar maupun tidak.
+func (c *PasswordController) ForgotPassword(ctx *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid request: %v", err)})
+		return
+	}
+	if req.AccountType == "" {
+		req.AccountType = "user"
+	}
+
+	if c.ResetURL == "" {
+		log.Printf("Password reset for %s refused: PASSWORD_RESET_URL and SITE_URL are not set", req.Email)
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": "Password reset is not available"})
+		return
+	}
+
+	if rateLimited(ctx, c.ipLimiter, ctx.ClientIP()) {
+		return
+	}
+	if rateLimited(ctx, c.emailLimiter, strings.ToLower(strings.TrimSpace(req.Email))) {
+		return
+	}
+
+	var accountID uuid.UUID
+	err := c.DB.QueryRow(
+		"SELECT id FROM "+accountTable(req.AccountType)+" WHERE email = $1",
+		req.Email,
+	).Scan(&accountID)
+	if err == sql.ErrNoRows {
+		ctx.JSON(http.StatusOK, gin.H{"message": forgotPasswordMessage})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	token, tokenHash, err := utils.NewToken()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate reset token"})
+		return
+	}
+
+	tx, err := c.DB.Begin()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	defer tx.Rollback()
+
+	// Token lama yang belum dipakai tidak berlaku lagi, token yang sudah lama
+	// kedaluwarsa ikut dibersihkan
+	_, err = tx.Exec(`
+		DELETE FROM password_reset_tokens
+		WHERE (account_type = $1 AND account_id = $2 AND used_at IS NULL)
+			OR expires_at < NOW() - INTERVAL '1 day'
+	`, req.AccountType, accountID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO password_reset_tokens (token_hash, account_type, account_id, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`, tokenHash, req.AccountType, accountID, time.Now().Add(c.TTL))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	msg := utils.Message{
+		To:      req.Email,
+		Subject: "Reset password Turning Jane",
+		Body: fmt.Sprintf(
+			"Kami menerima permintaan reset password untuk akun %s.\n\n"+
+				"Buka link berikut untuk membuat password baru:\n%s\n\n"+
+				"Link ini berlaku selama %s dan hanya bisa dipakai sekali. "+
+				"Abaikan email ini jika kamu tidak meminta reset password.\n",
+			req.Email, tokenLink(c.ResetURL, token), formatTTL(c.TTL),
+		),
+	}
+
+	// Email dikirim di background agar waktu respons tidak membedakan email
+	// yang terdaftar dan yang tidak
+	go func() {
+		if err := c.Mailer.Send(msg); err != nil {
+			log.Printf("Failed to send password reset email to %s: %v", msg.To, err)
+		}
+	}()
+
+	ctx.JSON(http.StatusOK, gin.H{"message": forgotPasswordMessage})
+}
+
+// ResetPassword mengganti password dengan token dari email reset. Token
+// hanya bisa dipakai sekali dan sebelum kedaluwarsa.
+func (c *PasswordController) ResetPassword(ctx *gin.Context) {
+	var req ResetPasswordRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid request: %v", err)})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process password"})
+		return
+	}
+
+	tx, err := c.DB.Begin()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	defer tx.Rollback()
+
+	// Tandai token terpakai, dua permintaan bersamaan tidak bisa sama-sama berhasil
+	var accountType string
+	var accountID uuid.UUID
+	err = tx.QueryRow(`
+		UPDATE password_reset_tokens
+		SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING account_type, account_id
+	`, utils.HashToken(req.Token)).Scan(&accountType, &accountID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+		} else {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		}
+		return
+	}
+
+	result, err := tx.Exec(
+		"UPDATE "+accountTable(accountType)+" SET password = $1 WHERE id = $2",
+		string(hashedPassword), accountID,
+	)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		// Akun sudah dihapus setelah token dibuat
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+		return
+	}
+
+	// Token lain untuk akun yang sama tidak berlaku lagi
+	_, err = tx.Exec(`
+		DELETE FROM password_reset_tokens
+		WHERE account_type = $1 AND account_id = $2 AND used_at IS NULL
+	`, accountType, accountID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Password has been reset successfully"})
+}
@@ -0,0 +1,352 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"backend-turningjane/models"
+)
+
+const (
+	// playDedupWindow: pemutaran ulang dari fingerprint yang sama dalam blok
+	// waktu yang sama memperbarui pemutaran sebelumnya, bukan menambah hitungan
+	playDedupWindow = 30 * time.Minute
+	// playSaltSize adalah panjang salt harian fingerprint dalam byte
+	playSaltSize = 32
+	// playCompletionRatio adalah bagian lagu yang harus didengar agar dianggap selesai
+	playCompletionRatio = 0.9
+	// defaultStatsDays adalah rentang statistik jika from tidak diisi
+	defaultStatsDays = 30
+	// maxStatsDays membatasi rentang statistik
+	maxStatsDays = 366
+	// defaultStatsLimit adalah jumlah lagu dan referrer teratas
+	defaultStatsLimit = 10
+)
+
+// botUserAgent mengenali crawler, link preview dan HTTP client yang bukan browser
+var botUserAgent = regexp.MustCompile(`(?i)bot|crawl|spider|slurp|facebookexternalhit|preview|headless|lighthouse|phantomjs|selenium|puppeteer|playwright|curl|wget|python|java/|okhttp|go-http-client|httpclient|libwww|scrapy`)
+
+// playRangeFilter membatasi song_plays p ke tanggal $1 sampai $2 (inklusif, UTC)
+const playRangeFilter = `p.played_at >= $1::date::timestamp AT TIME ZONE 'UTC' AND p.played_at < ($2::date + 1)::timestamp AT TIME ZONE 'UTC'`
+
+type PlayController struct {
+	DB *sql.DB
+
+	// Salt hari ini disimpan di memori agar tidak dibaca setiap pemutaran
+	saltMu  sync.Mutex
+	saltDay string
+	salt    []byte
+}
+
+func NewPlayController(db *sql.DB) *PlayController {
+	return &PlayController{DB: db}
+}
+
+// RecordPlay mencatat pemutaran lagu. Pemutaran dari fingerprint yang sama
+// dalam blok 30 menit yang sama hanya memperbarui durasi yang didengar.
+func (c *PlayController) RecordPlay(ctx *gin.Context) {
+	idStr := ctx.Param("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid UUID format"})
+		return
+	}
+
+	var req models.RecordPlayRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid request: %v", err)})
+		return
+	}
+
+	// Bot tidak dihitung, tetapi tidak diberi tahu alasannya lewat status error
+	userAgent := ctx.Request.UserAgent()
+	if userAgent == "" || botUserAgent.MatchString(userAgent) {
+		ctx.JSON(http.StatusAccepted, models.RecordPlayResponse{Recorded: false, Reason: "filtered"})
+		return
+	}
+
+	var duration sql.NullFloat64
+	err = c.DB.QueryRow("SELECT duration_seconds FROM songs WHERE song_id = $1", id).Scan(&duration)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Song not found"})
+		} else {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		}
+		return
+	}
+
+	// Durasi yang didengar tidak boleh melebihi panjang lagu, status selesai
+	// hanya diketahui jika durasi lagu tersimpan
+	listened := req.ListenedSeconds
+	var completed *bool
+	if duration.Valid && duration.Float64 > 0 {
+		listened = min(listened, duration.Float64)
+		done := listened >= duration.Float64*playCompletionRatio
+		completed = &done
+	}
+
+	now := time.Now().UTC()
+	salt, err := c.dailySalt(now.Format(time.DateOnly))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	fingerprint := playFingerprint(salt, ctx.ClientIP(), userAgent)
+	bucket := now.Unix() / int64(playDedupWindow/time.Second)
+
+	// Unique index pada (song_id, fingerprint, dedup_bucket) membuat laporan
+	// yang datang bersamaan tetap menjadi satu pemutaran. xmax = 0 hanya untuk
+	// baris yang baru di-insert.
+	var inserted bool
+	err = c.DB.QueryRow(`
+		INSERT INTO song_plays (song_id, fingerprint, dedup_bucket, listened_seconds, completed, referrer)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (song_id, fingerprint, dedup_bucket) DO UPDATE
+		SET listened_seconds = GREATEST(song_plays.listened_seconds, EXCLUDED.listened_seconds),
+			completed = CASE WHEN EXCLUDED.completed IS NULL THEN song_plays.completed
+				ELSE COALESCE(song_plays.completed, false) OR EXCLUDED.completed END,
+			updated_at = NOW()
+		RETURNING xmax = 0
+	`, id, fingerprint, bucket, listened, completed, referrerHost(req.Referrer)).Scan(&inserted)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	if !inserted {
+		ctx.JSON(http.StatusOK, models.RecordPlayResponse{Recorded: false, Reason: "duplicate"})
+		return
+	}
+	ctx.JSON(http.StatusCreated, models.RecordPlayResponse{Recorded: true})
+}
+
+// Stats menampilkan statistik pemutaran: pemutaran per hari, lagu teratas,
+// referrer teratas dan completion rate
+func (c *PlayController) Stats(ctx *gin.Context) {
+	var req models.PlayStatsQuery
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid query: %v", err)})
+		return
+	}
+
+	to := time.Now().UTC()
+	if req.To != "" {
+		to, _ = time.Parse(time.DateOnly, req.To)
+	}
+	from := to.AddDate(0, 0, -(defaultStatsDays - 1))
+	if req.From != "" {
+		from, _ = time.Parse(time.DateOnly, req.From)
+	}
+	if from.After(to) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "from must not be after to"})
+		return
+	}
+	if to.Sub(from) >= maxStatsDays*24*time.Hour {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Date range must be at most %d days", maxStatsDays)})
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = defaultStatsLimit
+	}
+
+	response := models.PlayStatsResponse{
+		From:         from.Format(time.DateOnly),
+		To:           to.Format(time.DateOnly),
+		PlaysPerDay:  []models.DailyPlays{},
+		TopSongs:     []models.TopSong{},
+		TopReferrers: []models.ReferrerPlays{},
+	}
+
+	if err := c.playTotals(&response); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	if err := c.playsPerDay(&response); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	if err := c.topSongs(&response, req.Limit); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	if err := c.topReferrers(&response, req.Limit); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, response)
+}
+
+// Helper function to count plays, listeners and the completion rate of the range.
+// Fingerprints are salted per day, so the distinct count is the sum of the
+// unique listeners of each day.
+func (c *PlayController) playTotals(response *models.PlayStatsResponse) error {
+	var completionRate sql.NullFloat64
+	err := c.DB.QueryRow(`
+		SELECT COUNT(*), COUNT(DISTINCT p.fingerprint), AVG(p.completed::int)
+		FROM song_plays p
+		WHERE `+playRangeFilter,
+		response.From, response.To,
+	).Scan(&response.TotalPlays, &response.UniqueListeners, &completionRate)
+	if err != nil {
+		return err
+	}
+
+	if completionRate.Valid {
+		response.CompletionRate = &completionRate.Float64
+	}
+	return nil
+}
+
+// Helper function to count plays per UTC day, days without plays are included
+func (c *PlayController) playsPerDay(response *models.PlayStatsResponse) error {
+	rows, err := c.DB.Query(`
+		SELECT to_char(d, 'YYYY-MM-DD'), COUNT(p.id), COUNT(DISTINCT p.fingerprint)
+		FROM generate_series($1::date, $2::date, INTERVAL '1 day') d
+		LEFT JOIN song_plays p ON `+playRangeFilter+` AND (p.played_at AT TIME ZONE 'UTC')::date = d::date
+		GROUP BY d
+		ORDER BY d
+	`, response.From, response.To)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var day models.DailyPlays
+		if err := rows.Scan(&day.Date, &day.Plays, &day.UniqueListeners); err != nil {
+			return err
+		}
+		response.PlaysPerDay = append(response.PlaysPerDay, day)
+	}
+	return rows.Err()
+}
+
+// Helper function to list the most played songs of the range
+func (c *PlayController) topSongs(response *models.PlayStatsResponse, limit int) error {
+	rows, err := c.DB.Query(`
+		SELECT s.song_id, s.title, s.artist, COUNT(*), COUNT(DISTINCT p.fingerprint),
+			AVG(p.completed::int), AVG(p.listened_seconds)
+		FROM song_plays p
+		JOIN songs s ON s.song_id = p.song_id
+		WHERE `+playRangeFilter+`
+		GROUP BY s.song_id, s.title, s.artist
+		ORDER BY COUNT(*) DESC, s.title
+		LIMIT $3
+	`, response.From, response.To, limit)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var song models.TopSong
+		var completionRate sql.NullFloat64
+		err := rows.Scan(&song.SongID, &song.Title, &song.Artist, &song.Plays, &song.UniqueListeners,
+			&completionRate, &song.AvgListenedSeconds)
+		if err != nil {
+			return err
+		}
+		if completionRate.Valid {
+			song.CompletionRate = &completionRate.Float64
+		}
+		response.TopSongs = append(response.TopSongs, song)
+	}
+	return rows.Err()
+}
+
+// Helper function to list the referrers that brought the most plays
+func (c *PlayController) topReferrers(response *models.PlayStatsResponse, limit int) error {
+	rows, err := c.DB.Query(`
+		SELECT p.referrer, COUNT(*)
+		FROM song_plays p
+		WHERE `+playRangeFilter+`
+		GROUP BY p.referrer
+		ORDER BY COUNT(*) DESC, p.referrer
+		LIMIT $3
+	`, response.From, response.To, limit)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var referrer models.ReferrerPlays
+		var host sql.NullString
+		if err := rows.Scan(&host, &referrer.Plays); err != nil {
+			return err
+		}
+		if host.Valid {
+			referrer.Referrer = &host.String
+		}
+		response.TopReferrers = append(response.TopReferrers, referrer)
+	}
+	return rows.Err()
+}
+
+// Helper function to get the random salt of the given UTC day. The first
+// play of the day creates it and removes the salts of earlier days, so old
+// fingerprints can no longer be matched to an IP address by hashing every
+// possible address.
+func (c *PlayController) dailySalt(day string) ([]byte, error) {
+	c.saltMu.Lock()
+	defer c.saltMu.Unlock()
+	if c.saltDay == day {
+		return c.salt, nil
+	}
+
+	salt := make([]byte, playSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	// Server lain mungkin sudah membuat salt hari ini, salt itu yang dipakai
+	_, err := c.DB.Exec(
+		"INSERT INTO play_salts (day, salt) VALUES ($1, $2) ON CONFLICT (day) DO NOTHING",
+		day, salt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.DB.QueryRow("SELECT salt FROM play_salts WHERE day = $1", day).Scan(&salt); err != nil {
+		return nil, err
+	}
+	if _, err := c.DB.Exec("DELETE FROM play_salts WHERE day < $1", day); err != nil {
+		return nil, err
+	}
+
+	c.saltDay, c.salt = day, salt
+	return salt, nil
+}
+
+// Helper function to derive the fingerprint of a listener from the salt of
+// the day, the IP address and the User-Agent. Only the hash is stored, and
+// once the salt is deleted it cannot be recomputed from an IP address.
+func playFingerprint(salt []byte, clientIP, userAgent string) string {
+	hash := sha256.New()
+	hash.Write(salt)
+	hash.Write([]byte(clientIP + "\x00" + userAgent))
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Helper function to reduce a referrer URL to its host, nil for direct visits
+func referrerHost(referrer string) interface{} {
+	parsed, err := url.Parse(strings.TrimSpace(referrer))
+	if err != nil || parsed.Hostname() == "" {
+		return nil
+	}
+	return strings.TrimPrefix(strings.ToLower(parsed.Hostname()), "www.")
+}
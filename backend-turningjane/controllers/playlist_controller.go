@@ -0,0 +1,581 @@
+package controllers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"backend-turningjane/models"
+	"backend-turningjane/utils"
+)
+
+// playlistColumns adalah kolom yang dibaca oleh scanPlaylist, termasuk jumlah lagu
+const playlistColumns = `
+	p.playlist_id, p.name, p.description, p.is_public, p.share_slug, p.created_at, p.updated_at,
+	(SELECT COUNT(*) FROM playlist_songs ps WHERE ps.playlist_id = p.playlist_id)
+`
+
+// playlistMutationQuery membungkus INSERT/UPDATE ... RETURNING * agar hasilnya
+// memiliki kolom yang sama dengan playlistColumns
+func playlistMutationQuery(statement string) string {
+	return `WITH p AS (` + statement + `) SELECT ` + playlistColumns + ` FROM p`
+}
+
+type PlaylistController struct {
+	DB *sql.DB
+}
+
+func NewPlaylistController(db *sql.DB) *PlaylistController {
+	return &PlaylistController{DB: db}
+}
+
+// Helper function to scan a row selected with playlistColumns
+func scanPlaylist(row rowScanner) (models.Playlist, error) {
+	var playlist models.Playlist
+	var description sql.NullString
+	var shareSlug sql.NullString
+
+	err := row.Scan(
+		&playlist.PlaylistID,
+		&playlist.Name,
+		&description,
+		&playlist.IsPublic,
+		&shareSlug,
+		&playlist.CreatedAt,
+		&playlist.UpdatedAt,
+		&playlist.SongCount,
+	)
+	if err != nil {
+		return playlist, err
+	}
+
+	if description.Valid {
+		playlist.Description = &description.String
+	}
+	if shareSlug.Valid {
+		playlist.ShareSlug = &shareSlug.String
+	}
+
+	return playlist, nil
+}
+
+// Helper function to load the ordered songs of a playlist
+func (c *PlaylistController) playlistSongs(playlistID uuid.UUID) ([]models.SongResponse, error) {
+	rows, err := c.DB.Query(`
+		SELECT `+songColumns+`
+		FROM playlist_songs ps
+		JOIN songs s ON s.song_id = ps.song_id
+		LEFT JOIN genres g ON s.genre_id = g.genre_id
+		WHERE ps.playlist_id = $1
+		ORDER BY ps.position, ps.added_at
+	`, playlistID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	songs := []models.SongResponse{}
+	for rows.Next() {
+		song, err := scanSong(rows)
+		if err != nil {
+			return nil, err
+		}
+		songs = append(songs, song)
+	}
+
+	return songs, rows.Err()
+}
+
+// Helper function to load a playlist of the user with its songs
+func (c *PlaylistController) playlistDetail(playlistID, userID uuid.UUID) (models.PlaylistDetailResponse, error) {
+	var detail models.PlaylistDetailResponse
+
+	playlist, err := scanPlaylist(c.DB.QueryRow(
+		"SELECT "+playlistColumns+" FROM playlists p WHERE p.playlist_id = $1 AND p.user_id = $2",
+		playlistID, userID,
+	))
+	if err != nil {
+		return detail, err
+	}
+	detail.Playlist = playlist
+
+	detail.Songs, err = c.playlistSongs(playlistID)
+	return detail, err
+}
+
+// Helper function to lock a playlist of the user inside a transaction. It
+// writes a 404 or 500 response and returns false when the lock fails.
+func lockPlaylist(ctx *gin.Context, tx *sql.Tx, playlistID, userID uuid.UUID) bool {
+	var id uuid.UUID
+	err := tx.QueryRow(
+		"SELECT playlist_id FROM playlists WHERE playlist_id = $1 AND user_id = $2 FOR UPDATE",
+		playlistID, userID,
+	).Scan(&id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Playlist not found"})
+		} else {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		}
+		return false
+	}
+	return true
+}
+
+// ListPlaylists mengambil playlist milik user yang sedang login
+func (c *PlaylistController) ListPlaylists(ctx *gin.Context) {
+	userID, ok := sessionUserID(ctx)
+	if !ok {
+		return
+	}
+
+	rows, err := c.DB.Query("SELECT "+playlistColumns+" FROM playlists p WHERE p.user_id = $1 ORDER BY p.updated_at DESC", userID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	defer rows.Close()
+
+	playlists := []models.Playlist{}
+	for rows.Next() {
+		playlist, err := scanPlaylist(rows)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+			return
+		}
+		playlists = append(playlists, playlist)
+	}
+
+	if err := rows.Err(); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, playlists)
+}
+
+// CreatePlaylist membuat playlist baru, playlist publik langsung mendapat share_slug
+func (c *PlaylistController) CreatePlaylist(ctx *gin.Context) {
+	userID, ok := sessionUserID(ctx)
+	if !ok {
+		return
+	}
+
+	var req models.CreatePlaylistRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid request: %v", err)})
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Playlist name is required"})
+		return
+	}
+
+	var shareSlug *string
+	if req.IsPublic {
+		// Playlist publik hanya untuk user yang emailnya sudah terverifikasi
+		if !requireVerifiedUser(ctx, c.DB, userID) {
+			return
+		}
+		slug, err := utils.RandomSlug(name)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to create share slug: %v", err)})
+			return
+		}
+		shareSlug = &slug
+	}
+
+	playlist, err := scanPlaylist(c.DB.QueryRow(playlistMutationQuery(`
+		INSERT INTO playlists (user_id, name, description, is_public, share_slug)
+		VALUES ($1, $2, NULLIF($3::text, ''), $4, $5)
+		RETURNING *
+	`), userID, name, req.Description, req.IsPublic, shareSlug))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, models.PlaylistDetailResponse{Playlist: playlist, Songs: []models.SongResponse{}})
+}
+
+// GetPlaylist mengambil playlist milik user beserta lagunya
+func (c *PlaylistController) GetPlaylist(ctx *gin.Context) {
+	userID, ok := sessionUserID(ctx)
+	if !ok {
+		return
+	}
+
+	playlistID, err := uuid.Parse(ctx.Param("playlist_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid UUID format"})
+		return
+	}
+
+	detail, err := c.playlistDetail(playlistID, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Playlist not found"})
+		} else {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, detail)
+}
+
+// UpdatePlaylist mengganti nama, deskripsi atau status publik playlist.
+// share_slug tetap sama jika playlist dijadikan privat lalu publik lagi.
+func (c *PlaylistController) UpdatePlaylist(ctx *gin.Context) {
+	userID, ok := sessionUserID(ctx)
+	if !ok {
+		return
+	}
+
+	playlistID, err := uuid.Parse(ctx.Param("playlist_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid UUID format"})
+		return
+	}
+
+	var req models.UpdatePlaylistRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid request: %v", err)})
+		return
+	}
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Playlist name must not be empty"})
+			return
+		}
+		req.Name = &name
+	}
+
+	// Slug hanya dipakai jika playlist belum punya slug
+	var newSlug *string
+	if req.IsPublic != nil && *req.IsPublic {
+		// Playlist publik hanya untuk user yang emailnya sudah terverifikasi
+		if !requireVerifiedUser(ctx, c.DB, userID) {
+			return
+		}
+		var slugName string
+		if req.Name != nil {
+			slugName = *req.Name
+		} else if err := c.DB.QueryRow("SELECT name FROM playlists WHERE playlist_id = $1 AND user_id = $2", playlistID, userID).Scan(&slugName); err != nil && err != sql.ErrNoRows {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+			return
+		}
+		slug, err := utils.RandomSlug(slugName)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to create share slug: %v", err)})
+			return
+		}
+		newSlug = &slug
+	}
+
+	playlist, err := scanPlaylist(c.DB.QueryRow(playlistMutationQuery(`
+		UPDATE playlists
+		SET
+			name = COALESCE($3, name),
+			description = CASE WHEN $4::text IS NULL THEN description ELSE NULLIF($4, '') END,
+			is_public = COALESCE($5, is_public),
+			share_slug = COALESCE(share_slug, $6),
+			updated_at = NOW()
+		WHERE playlist_id = $1 AND user_id = $2
+		RETURNING *
+	`), playlistID, userID, req.Name, req.Description, req.IsPublic, newSlug))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Playlist not found"})
+		} else {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, playlist)
+}
+
+// DeletePlaylist menghapus playlist milik user, lagunya tetap ada
+func (c *PlaylistController) DeletePlaylist(ctx *gin.Context) {
+	userID, ok := sessionUserID(ctx)
+	if !ok {
+		return
+	}
+
+	playlistID, err := uuid.Parse(ctx.Param("playlist_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid UUID format"})
+		return
+	}
+
+	result, err := c.DB.Exec("DELETE FROM playlists WHERE playlist_id = $1 AND user_id = $2", playlistID, userID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	if rowsAffected == 0 {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Playlist not found"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Playlist deleted successfully"})
+}
+
+// AddPlaylistSong menambahkan lagu di akhir playlist. Lagu yang sudah ada
+// tidak ditambahkan dua kali.
+func (c *PlaylistController) AddPlaylistSong(ctx *gin.Context) {
+	userID, ok := sessionUserID(ctx)
+	if !ok {
+		return
+	}
+
+	playlistID, err := uuid.Parse(ctx.Param("playlist_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid UUID format"})
+		return
+	}
+
+	var req models.AddPlaylistSongRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid request: %v", err)})
+		return
+	}
+
+	tx, err := c.DB.Begin()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	defer tx.Rollback()
+
+	// Playlist dikunci agar posisi lagu yang ditambahkan bersamaan tidak bentrok
+	if !lockPlaylist(ctx, tx, playlistID, userID) {
+		return
+	}
+
+	var songExists bool
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM songs WHERE song_id = $1)", req.SongID).Scan(&songExists); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	if !songExists {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Song not found"})
+		return
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO playlist_songs (playlist_id, song_id, position)
+		SELECT $1, $2, COALESCE(MAX(position) + 1, 0) FROM playlist_songs WHERE playlist_id = $1
+		ON CONFLICT (playlist_id, song_id) DO NOTHING
+	`, playlistID, req.SongID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	if !c.touchPlaylist(ctx, tx, playlistID) {
+		return
+	}
+	c.respondPlaylistDetail(ctx, playlistID, userID)
+}
+
+// RemovePlaylistSong menghapus lagu dari playlist
+func (c *PlaylistController) RemovePlaylistSong(ctx *gin.Context) {
+	userID, ok := sessionUserID(ctx)
+	if !ok {
+		return
+	}
+
+	playlistID, err := uuid.Parse(ctx.Param("playlist_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid UUID format"})
+		return
+	}
+	songID, err := uuid.Parse(ctx.Param("song_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid UUID format"})
+		return
+	}
+
+	tx, err := c.DB.Begin()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	defer tx.Rollback()
+
+	if !lockPlaylist(ctx, tx, playlistID, userID) {
+		return
+	}
+
+	_, err = tx.Exec("DELETE FROM playlist_songs WHERE playlist_id = $1 AND song_id = $2", playlistID, songID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	if !c.touchPlaylist(ctx, tx, playlistID) {
+		return
+	}
+	c.respondPlaylistDetail(ctx, playlistID, userID)
+}
+
+// ReorderPlaylistSongs menyusun ulang lagu playlist. song_ids harus berisi
+// setiap lagu playlist tepat satu kali.
+func (c *PlaylistController) ReorderPlaylistSongs(ctx *gin.Context) {
+	userID, ok := sessionUserID(ctx)
+	if !ok {
+		return
+	}
+
+	playlistID, err := uuid.Parse(ctx.Param("playlist_id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid UUID format"})
+		return
+	}
+
+	var req models.ReorderPlaylistRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid request: %v", err)})
+		return
+	}
+
+	tx, err := c.DB.Begin()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	defer tx.Rollback()
+
+	if !lockPlaylist(ctx, tx, playlistID, userID) {
+		return
+	}
+
+	rows, err := tx.Query("SELECT song_id FROM playlist_songs WHERE playlist_id = $1", playlistID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	current := map[uuid.UUID]bool{}
+	for rows.Next() {
+		var songID uuid.UUID
+		if err := rows.Scan(&songID); err != nil {
+			rows.Close()
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+			return
+		}
+		current[songID] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	// Urutan baru harus memuat semua lagu playlist, tidak lebih dan tidak kurang
+	seen := map[uuid.UUID]bool{}
+	songIDs := make([]string, 0, len(req.SongIDs))
+	for _, songID := range req.SongIDs {
+		if !current[songID] || seen[songID] {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "song_ids must list every song of the playlist exactly once"})
+			return
+		}
+		seen[songID] = true
+		songIDs = append(songIDs, songID.String())
+	}
+	if len(seen) != len(current) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "song_ids must list every song of the playlist exactly once"})
+		return
+	}
+
+	_, err = tx.Exec(`
+		UPDATE playlist_songs ps
+		SET position = o.ord - 1
+		FROM unnest($2::uuid[]) WITH ORDINALITY AS o(song_id, ord)
+		WHERE ps.playlist_id = $1 AND ps.song_id = o.song_id
+	`, playlistID, pq.Array(songIDs))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	if !c.touchPlaylist(ctx, tx, playlistID) {
+		return
+	}
+	c.respondPlaylistDetail(ctx, playlistID, userID)
+}
+
+// GetSharedPlaylist mengambil playlist publik berdasarkan share_slug. Playlist
+// milik user yang emailnya belum terverifikasi tidak ditampilkan.
+func (c *PlaylistController) GetSharedPlaylist(ctx *gin.Context) {
+	var detail models.PlaylistDetailResponse
+	var owner string
+
+	playlist, err := scanPlaylist(extraColumnsScanner{
+		rows: c.DB.QueryRow(`
+			SELECT `+playlistColumns+`, u.username
+			FROM playlists p
+			JOIN users u ON u.id = p.user_id
+			WHERE p.share_slug = $1 AND p.is_public AND u.verified_at IS NOT NULL
+		`, ctx.Param("slug")),
+		extra: []interface{}{&owner},
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Playlist not found"})
+		} else {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		}
+		return
+	}
+	detail.Playlist = playlist
+	detail.Owner = &owner
+
+	detail.Songs, err = c.playlistSongs(playlist.PlaylistID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, detail)
+}
+
+// Helper function to bump updated_at and commit a playlist change. It writes a
+// 500 response and returns false when the commit fails.
+func (c *PlaylistController) touchPlaylist(ctx *gin.Context, tx *sql.Tx, playlistID uuid.UUID) bool {
+	if _, err := tx.Exec("UPDATE playlists SET updated_at = NOW() WHERE playlist_id = $1", playlistID); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return false
+	}
+	if err := tx.Commit(); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return false
+	}
+	return true
+}
+
+// Helper function to respond with the playlist after a change
+func (c *PlaylistController) respondPlaylistDetail(ctx *gin.Context, playlistID, userID uuid.UUID) {
+	detail, err := c.playlistDetail(playlistID, userID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	ctx.JSON(http.StatusOK, detail)
+}
@@ -0,0 +1,758 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"backend-turningjane/models"
+	"backend-turningjane/utils"
+)
+
+const (
+	// postCoverFolder adalah folder storage untuk cover berita
+	postCoverFolder = "post_covers"
+	// postExcerptLength adalah panjang excerpt otomatis dalam karakter
+	postExcerptLength = 200
+	// defaultPostPageSize adalah jumlah berita per halaman jika limit tidak diisi
+	defaultPostPageSize = 10
+)
+
+// postColumns adalah kolom yang dibaca oleh scanPost
+const postColumns = `
+	p.post_id, p.title, p.slug, p.excerpt, p.body_markdown, p.body_html, p.cover_image_path,
+	p.cover_image_variants, p.author_id, p.tags, p.status, p.publish_at, p.created_at, p.updated_at
+`
+
+// postMutationQuery membungkus INSERT/UPDATE ... RETURNING * agar hasilnya
+// memiliki kolom yang sama dengan postColumns
+func postMutationQuery(statement string) string {
+	return `WITH p AS (` + statement + `) SELECT ` + postColumns + ` FROM p`
+}
+
+// postCursor menandai berita terakhir sebuah halaman GET /posts
+type postCursor struct {
+	PublishAt time.Time `json:"publish_at"`
+	ID        uuid.UUID `json:"id"`
+}
+
+type PostController struct {
+	DB      *sql.DB
+	Storage utils.Storage
+	Outbox  *utils.DeletionOutbox
+}
+
+func NewPostController(db *sql.DB, storage utils.Storage, outbox *utils.DeletionOutbox) *PostController {
+	return &PostController{
+		DB:      db,
+		Storage: storage,
+		Outbox:  outbox,
+	}
+}
+
+// Helper function to scan a row selected with postColumns
+func scanPost(row rowScanner) (models.Post, error) {
+	var post models.Post
+	var excerpt sql.NullString
+	var coverImagePath sql.NullString
+	var coverImageVariants []byte
+	var authorID uuid.NullUUID
+	var tags pq.StringArray
+	var publishAt sql.NullTime
+
+	err := row.Scan(
+		&post.PostID,
+		&post.Title,
+		&post.Slug,
+		&excerpt,
+		&post.BodyMarkdown,
+		&post.BodyHTML,
+		&coverImagePath,
+		&coverImageVariants,
+		&authorID,
+		&tags,
+		&post.Status,
+		&publishAt,
+		&post.CreatedAt,
+		&post.UpdatedAt,
+	)
+	if err != nil {
+		return post, err
+	}
+
+	if excerpt.Valid {
+		post.Excerpt = excerpt.String
+	} else {
+		post.Excerpt = utils.MarkdownExcerpt(post.BodyHTML, postExcerptLength)
+	}
+	if coverImagePath.Valid {
+		post.CoverImagePath = &coverImagePath.String
+	}
+	post.CoverImageVariants = decodeImageVariants(coverImageVariants)
+	if authorID.Valid {
+		post.AuthorID = &authorID.UUID
+	}
+	post.Tags = []string(tags)
+	if post.Tags == nil {
+		post.Tags = []string{}
+	}
+	if publishAt.Valid {
+		post.PublishAt = &publishAt.Time
+	}
+
+	return post, nil
+}
+
+// Helper function to trim, lowercase and deduplicate tags
+func normalizeTags(tags []string) []string {
+	normalized := []string{}
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.Join(strings.Fields(tag), " "))
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized
+}
+
+// Helper function to check that no other post uses the slug
+func (c *PostController) slugTaken(slug string, postID uuid.UUID) (bool, error) {
+	var exists bool
+	err := c.DB.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM posts WHERE slug = $1 AND post_id <> $2)",
+		slug, postID,
+	).Scan(&exists)
+	return exists, err
+}
+
+// Helper function to decide publish_at for a status. stored is the current
+// publish_at and wasPublished tells whether the post is already live, so its
+// original date is kept. It returns a message for the client on invalid input.
+func postPublishAt(status string, requested, stored *time.Time, wasPublished bool) (*time.Time, string) {
+	now := time.Now()
+	switch status {
+	case "scheduled":
+		publishAt := requested
+		if publishAt == nil {
+			publishAt = stored
+		}
+		if publishAt == nil {
+			return nil, "publish_at is required for scheduled posts"
+		}
+		if !publishAt.After(now) {
+			return nil, "publish_at must be in the future for scheduled posts"
+		}
+		return publishAt, ""
+	case "published":
+		if requested != nil {
+			if requested.After(now) {
+				return nil, "publish_at is in the future, use status scheduled instead"
+			}
+			return requested, ""
+		}
+		if wasPublished && stored != nil {
+			return stored, ""
+		}
+		return &now, ""
+	}
+
+	// Draft menyimpan rencana tanggal terbit tanpa menerbitkannya
+	if requested != nil {
+		return requested, ""
+	}
+	return stored, ""
+}
+
+// Helper function to detect a violation of the unique slug index
+func isSlugConflict(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "posts_slug_key"
+}
+
+// Helper function to encode the position after the given post
+func encodePostCursor(post models.Post) (string, error) {
+	raw, err := json.Marshal(postCursor{PublishAt: *post.PublishAt, ID: post.PostID})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// Helper function to decode a cursor created by encodePostCursor
+func decodePostCursor(value string) (postCursor, error) {
+	var cursor postCursor
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return cursor, err
+	}
+	err = json.Unmarshal(raw, &cursor)
+	return cursor, err
+}
+
+// ListPosts mengambil berita yang sudah terbit per halaman, terbaru lebih
+// dulu. Parameter query: limit (1-50), cursor dan tag.
+func (c *PostController) ListPosts(ctx *gin.Context) {
+	var req models.ListPostsQuery
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid query: %v", err)})
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = defaultPostPageSize
+	}
+
+	conditions := []string{"p.status = 'published'"}
+	var args []interface{}
+	addArg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if tag := normalizeTags([]string{req.Tag}); len(tag) > 0 {
+		conditions = append(conditions, addArg(tag[0])+" = ANY(p.tags)")
+	}
+	if req.Cursor != "" {
+		cursor, err := decodePostCursor(req.Cursor)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid cursor: %v", err)})
+			return
+		}
+		conditions = append(conditions, fmt.Sprintf("(p.publish_at, p.post_id) < (%s, %s)", addArg(cursor.PublishAt), addArg(cursor.ID)))
+	}
+
+	// Ambil satu baris lebih untuk mengetahui apakah masih ada halaman berikutnya
+	rows, err := c.DB.Query(
+		"SELECT "+postColumns+" FROM posts p WHERE "+strings.Join(conditions, " AND ")+
+			" ORDER BY p.publish_at DESC, p.post_id DESC LIMIT "+addArg(req.Limit+1),
+		args...,
+	)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	defer rows.Close()
+
+	response := models.PostListResponse{Posts: []models.Post{}}
+	for rows.Next() {
+		if len(response.Posts) == req.Limit {
+			cursor, err := encodePostCursor(response.Posts[len(response.Posts)-1])
+			if err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Cursor error: %v", err)})
+				return
+			}
+			response.NextCursor = &cursor
+			break
+		}
+
+		post, err := scanPost(rows)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+			return
+		}
+
+		// Daftar berita hanya berisi excerpt, isi lengkap ada di GET /posts/:slug
+		post.BodyMarkdown = ""
+		post.BodyHTML = ""
+		response.Posts = append(response.Posts, post)
+	}
+
+	if err := rows.Err(); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, response)
+}
+
+// GetPost mengambil berita yang sudah terbit berdasarkan slug
+func (c *PostController) GetPost(ctx *gin.Context) {
+	post, err := scanPost(c.DB.QueryRow(
+		"SELECT "+postColumns+" FROM posts p WHERE p.slug = $1 AND p.status = 'published'",
+		ctx.Param("slug"),
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		} else {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		}
+		return
+	}
+
+	post.BodyMarkdown = ""
+	ctx.JSON(http.StatusOK, post)
+}
+
+// ListAdminPosts mengambil semua berita termasuk draft dan yang terjadwal
+func (c *PostController) ListAdminPosts(ctx *gin.Context) {
+	var req models.ListAdminPostsQuery
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid query: %v", err)})
+		return
+	}
+
+	var conditions []string
+	var args []interface{}
+	if req.Status != "" {
+		args = append(args, req.Status)
+		conditions = append(conditions, fmt.Sprintf("p.status = $%d", len(args)))
+	}
+	if tag := normalizeTags([]string{req.Tag}); len(tag) > 0 {
+		args = append(args, tag[0])
+		conditions = append(conditions, fmt.Sprintf("$%d = ANY(p.tags)", len(args)))
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	rows, err := c.DB.Query("SELECT "+postColumns+" FROM posts p"+where+" ORDER BY p.updated_at DESC, p.post_id", args...)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	defer rows.Close()
+
+	posts := []models.Post{}
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+			return
+		}
+		post.BodyMarkdown = ""
+		post.BodyHTML = ""
+		posts = append(posts, post)
+	}
+
+	if err := rows.Err(); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, posts)
+}
+
+// GetAdminPost mengambil berita berdasarkan ID beserta Markdown aslinya
+func (c *PostController) GetAdminPost(ctx *gin.Context) {
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid UUID format"})
+		return
+	}
+
+	post, err := scanPost(c.DB.QueryRow("SELECT "+postColumns+" FROM posts p WHERE p.post_id = $1", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		} else {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, post)
+}
+
+// CreatePost menambahkan berita baru, admin yang login menjadi penulisnya
+func (c *PostController) CreatePost(ctx *gin.Context) {
+	authorID, ok := sessionAdminID(ctx)
+	if !ok {
+		return
+	}
+
+	var req models.CreatePostRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid request: %v", err)})
+		return
+	}
+
+	if req.Status == "" {
+		req.Status = "draft"
+	}
+	publishAt, message := postPublishAt(req.Status, req.PublishAt, nil, false)
+	if message != "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": message})
+		return
+	}
+
+	var slug string
+	if req.Slug != nil {
+		slug = utils.Slugify(*req.Slug)
+		if slug == "" {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "slug must contain letters or digits"})
+			return
+		}
+		taken, err := c.slugTaken(slug, uuid.Nil)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+			return
+		}
+		if taken {
+			ctx.JSON(http.StatusConflict, gin.H{"error": "Slug already exists"})
+			return
+		}
+	} else {
+		var err error
+		slug, err = utils.UniqueSlug(req.Title, func(slug string) (bool, error) {
+			return c.slugTaken(slug, uuid.Nil)
+		})
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to generate slug: %v", err)})
+			return
+		}
+	}
+
+	bodyHTML, err := utils.RenderMarkdown(req.BodyMarkdown)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid Markdown: %v", err)})
+		return
+	}
+
+	query := postMutationQuery(`
+		INSERT INTO posts (title, slug, excerpt, body_markdown, body_html, cover_image_path, author_id, tags, status, publish_at)
+		VALUES ($1, $2, NULLIF($3::text, ''), $4, $5, NULLIF($6::text, ''), $7, $8, $9, $10)
+		RETURNING *
+	`)
+
+	post, err := scanPost(c.DB.QueryRow(
+		query,
+		req.Title,
+		slug,
+		req.Excerpt,
+		req.BodyMarkdown,
+		bodyHTML,
+		req.CoverImagePath,
+		authorID,
+		pq.Array(normalizeTags(req.Tags)),
+		req.Status,
+		publishAt,
+	))
+	if err != nil {
+		if isSlugConflict(err) {
+			ctx.JSON(http.StatusConflict, gin.H{"error": "Slug already exists"})
+		} else {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, post)
+}
+
+// UpdatePost memperbarui berita, hanya field yang dikirim yang diubah. Slug
+// tidak ikut berubah saat judul diganti agar link lama tetap berlaku.
+func (c *PostController) UpdatePost(ctx *gin.Context) {
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid UUID format"})
+		return
+	}
+
+	var req models.UpdatePostRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid request: %v", err)})
+		return
+	}
+
+	var slug *string
+	if req.Slug != nil {
+		value := utils.Slugify(*req.Slug)
+		if value == "" {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "slug must contain letters or digits"})
+			return
+		}
+		taken, err := c.slugTaken(value, id)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+			return
+		}
+		if taken {
+			ctx.JSON(http.StatusConflict, gin.H{"error": "Slug already exists"})
+			return
+		}
+		slug = &value
+	}
+
+	var bodyHTML *string
+	if req.BodyMarkdown != nil {
+		value, err := utils.RenderMarkdown(*req.BodyMarkdown)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid Markdown: %v", err)})
+			return
+		}
+		bodyHTML = &value
+	}
+
+	var tags interface{}
+	if req.Tags != nil {
+		tags = pq.Array(normalizeTags(*req.Tags))
+	}
+
+	tx, err := c.DB.Begin()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	defer tx.Rollback()
+
+	// Kunci berita dan ambil status serta cover lama
+	var currentStatus string
+	var currentPublishAt sql.NullTime
+	var currentCover sql.NullString
+	var currentVariants []byte
+	err = tx.QueryRow(
+		"SELECT status, publish_at, cover_image_path, cover_image_variants FROM posts WHERE post_id = $1 FOR UPDATE",
+		id,
+	).Scan(&currentStatus, &currentPublishAt, &currentCover, &currentVariants)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		} else {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		}
+		return
+	}
+
+	status := currentStatus
+	if req.Status != nil {
+		status = *req.Status
+	}
+	var storedPublishAt *time.Time
+	if currentPublishAt.Valid {
+		storedPublishAt = &currentPublishAt.Time
+	}
+
+	// Jadwal yang tidak disentuh tetap berlaku walau scheduler belum sempat berjalan
+	publishAt := storedPublishAt
+	if req.Status != nil || req.PublishAt != nil {
+		var message string
+		publishAt, message = postPublishAt(status, req.PublishAt, storedPublishAt, currentStatus == "published")
+		if message != "" {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": message})
+			return
+		}
+	}
+
+	query := postMutationQuery(`
+		UPDATE posts
+		SET
+			title = COALESCE($2, title),
+			slug = COALESCE($3, slug),
+			excerpt = CASE WHEN $4::text IS NULL THEN excerpt ELSE NULLIF($4, '') END,
+			body_markdown = COALESCE($5, body_markdown),
+			body_html = COALESCE($6, body_html),
+			cover_image_path = CASE WHEN $7::text IS NULL THEN cover_image_path ELSE NULLIF($7, '') END,
+			cover_image_variants = CASE WHEN $7::text IS NULL OR $7 = cover_image_path THEN cover_image_variants ELSE NULL END,
+			tags = COALESCE($8::text[], tags),
+			status = $9,
+			publish_at = $10,
+			updated_at = NOW()
+		WHERE post_id = $1
+		RETURNING *
+	`)
+
+	post, err := scanPost(tx.QueryRow(
+		query,
+		id,
+		req.Title,
+		slug,
+		req.Excerpt,
+		req.BodyMarkdown,
+		bodyHTML,
+		req.CoverImagePath,
+		tags,
+		status,
+		publishAt,
+	))
+	if err != nil {
+		if isSlugConflict(err) {
+			ctx.JSON(http.StatusConflict, gin.H{"error": "Slug already exists"})
+		} else {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		}
+		return
+	}
+
+	// Cover lama yang diganti dihapus setelah commit
+	if currentCover.Valid && (post.CoverImagePath == nil || *post.CoverImagePath != currentCover.String) {
+		if err := c.Outbox.Enqueue(tx, imageFiles(currentCover.String, decodeImageVariants(currentVariants))...); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	c.Outbox.Notify()
+
+	ctx.JSON(http.StatusOK, post)
+}
+
+// UploadPostCover mengganti cover berita dengan file yang diupload
+func (c *PostController) UploadPostCover(ctx *gin.Context) {
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid UUID format"})
+		return
+	}
+
+	var req models.PostCoverFormRequest
+	if err := ctx.ShouldBind(&req); err != nil {
+		ctx.JSON(bindErrorStatus(err), gin.H{"error": fmt.Sprintf("Invalid form request: %v", err)})
+		return
+	}
+
+	// Periksa tipe dan ukuran file sebelum diupload
+	if _, err := utils.PostCoverRule().Validate(req.CoverFile); err != nil {
+		var fieldErr *utils.FieldError
+		if errors.As(err, &fieldErr) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file upload", "fields": gin.H{fieldErr.Field: fieldErr.Message}})
+		} else {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to read uploaded file: %v", err)})
+		}
+		return
+	}
+
+	// Berita yang tidak ada tidak perlu menerima upload
+	var exists bool
+	err = c.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM posts WHERE post_id = $1)", id).Scan(&exists)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	if !exists {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return
+	}
+
+	// Cover diupload sebelum transaksi dibuka agar baris berita tidak
+	// terkunci selama upload
+	coverPath, variants, err := c.Storage.UploadImage(req.CoverFile, postCoverFolder)
+	if err != nil {
+		ctx.JSON(storageErrorStatus(err), gin.H{"error": fmt.Sprintf("Failed to upload cover file: %v", err)})
+		return
+	}
+
+	// File yang baru diupload dihapus lagi jika transaksi gagal
+	uploaded := imageFiles(coverPath, variants)
+	defer func() {
+		if uploaded != nil {
+			c.Outbox.Discard(uploaded...)
+		}
+	}()
+
+	tx, err := c.DB.Begin()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	defer tx.Rollback()
+
+	// Kunci berita dan ambil cover lama
+	var currentCover sql.NullString
+	var currentVariants []byte
+	err = tx.QueryRow(
+		"SELECT cover_image_path, cover_image_variants FROM posts WHERE post_id = $1 FOR UPDATE",
+		id,
+	).Scan(&currentCover, &currentVariants)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		} else {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		}
+		return
+	}
+
+	query := postMutationQuery(`
+		UPDATE posts
+		SET cover_image_path = $1, cover_image_variants = $2, updated_at = NOW()
+		WHERE post_id = $3
+		RETURNING *
+	`)
+
+	post, err := scanPost(tx.QueryRow(query, coverPath, encodeImageVariants(variants), id))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	// Cover lama dihapus setelah commit berhasil
+	if currentCover.Valid {
+		if err := c.Outbox.Enqueue(tx, imageFiles(currentCover.String, decodeImageVariants(currentVariants))...); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	uploaded = nil
+	c.Outbox.Notify()
+
+	ctx.JSON(http.StatusOK, post)
+}
+
+// DeletePost menghapus berita beserta cover-nya
+func (c *PostController) DeletePost(ctx *gin.Context) {
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid UUID format"})
+		return
+	}
+
+	tx, err := c.DB.Begin()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	defer tx.Rollback()
+
+	var coverImagePath sql.NullString
+	var coverImageVariants []byte
+	err = tx.QueryRow(
+		"DELETE FROM posts WHERE post_id = $1 RETURNING cover_image_path, cover_image_variants",
+		id,
+	).Scan(&coverImagePath, &coverImageVariants)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		} else {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		}
+		return
+	}
+
+	// Cover dihapus dari storage setelah commit
+	if coverImagePath.Valid {
+		if err := c.Outbox.Enqueue(tx, imageFiles(coverImagePath.String, decodeImageVariants(coverImageVariants))...); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	c.Outbox.Notify()
+
+	ctx.Status(http.StatusNoContent)
+}
@@ -0,0 +1,221 @@
+package controllers
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"backend-turningjane/models"
+)
+
+const (
+	// defaultSearchLimit adalah jumlah hasil jika limit tidak diisi
+	defaultSearchLimit = 20
+	// maxSearchQueryLength membatasi panjang kata kunci
+	maxSearchQueryLength = 200
+	// searchSimilarityThreshold adalah skor trigram minimum untuk pencarian typo
+	searchSimilarityThreshold = 0.3
+)
+
+// ts_headline menandai kata yang cocok dengan karakter kontrol, teks
+// di-escape dulu sebelum penanda diganti menjadi <mark>
+const (
+	headlineStart = "\x02"
+	headlineStop  = "\x03"
+
+	// Judul, artis dan genre pendek sehingga ditampilkan utuh
+	shortHeadlineOptions = "HighlightAll=true, StartSel=" + headlineStart + ", StopSel=" + headlineStop
+	// Lirik dipotong menjadi beberapa fragmen di sekitar kata yang cocok
+	lyricsHeadlineOptions = "MaxFragments=2, MaxWords=15, MinWords=5, FragmentDelimiter=\" … \", StartSel=" + headlineStart + ", StopSel=" + headlineStop
+)
+
+// searchLyricsText adalah lirik tanpa timestamp LRC, sama dengan ekspresi pada
+// kolom search_vector
+const searchLyricsText = `regexp_replace(COALESCE(s.lyrics, ''), '\[[^]]*\]', ' ', 'g')`
+
+// searchDocument menggabungkan search_vector lagu dengan nama genre, hanya
+// dipakai untuk ranking karena ekspresi ini tidak bisa memakai indeks
+const searchDocument = `(s.search_vector || setweight(to_tsvector('simple', COALESCE(g.genre_name, '')), 'B'))`
+
+// searchMatch memfilter lagu lewat songs_search_idx, atau lewat genre_id untuk
+// lagu yang nama genrenya cocok. Genre dicari dulu sebagai array agar kedua
+// kondisi tetap bisa digabung dengan BitmapOr.
+const searchMatch = `(s.search_vector @@ q.query
+		OR s.genre_id = ANY(ARRAY(SELECT genre_id FROM genres WHERE to_tsvector('simple', genre_name) @@ websearch_to_tsquery('simple', $1))))`
+
+// fullTextSearchQuery mencari dengan tsvector dan mengurutkan berdasarkan ts_rank_cd
+const fullTextSearchQuery = `
+	WITH q AS (SELECT websearch_to_tsquery('simple', $1) AS query)
+	SELECT ` + songColumns + `,
+		ts_rank_cd(` + searchDocument + `, q.query) AS rank,
+		ts_headline('simple', s.title, q.query, $3),
+		ts_headline('simple', s.artist, q.query, $3),
+		CASE WHEN g.genre_name IS NOT NULL THEN ts_headline('simple', g.genre_name, q.query, $3) END,
+		CASE WHEN to_tsvector('simple', ` + searchLyricsText + `) @@ q.query
+			THEN ts_headline('simple', ` + searchLyricsText + `, q.query, $4) END
+	FROM songs s LEFT JOIN genres g ON s.genre_id = g.genre_id, q
+	WHERE ` + searchMatch + `
+	ORDER BY rank DESC, s.title, s.song_id
+	LIMIT $2
+`
+
+// trigramSearchQuery dipakai jika full-text tidak menemukan apa pun, misalnya
+// karena salah ketik. Operator <% memakai songs_title_trgm_idx dan
+// songs_artist_trgm_idx dengan batas pg_trgm.word_similarity_threshold.
+// Skornya adalah word_similarity tertinggi dari judul, artis dan genre.
+const trigramSearchQuery = `
+	SELECT ` + songColumns + `,
+		GREATEST(
+			word_similarity($1, s.title),
+			word_similarity($1, s.artist),
+			word_similarity($1, COALESCE(g.genre_name, ''))
+		) AS rank
+	FROM songs s LEFT JOIN genres g ON s.genre_id = g.genre_id
+	WHERE $1 <% s.title
+		OR $1 <% s.artist
+		OR s.genre_id = ANY(ARRAY(SELECT genre_id FROM genres WHERE $1 <% genre_name))
+	ORDER BY rank DESC, s.title, s.song_id
+	LIMIT $2
+`
+
+type SearchController struct {
+	DB *sql.DB
+}
+
+func NewSearchController(db *sql.DB) *SearchController {
+	return &SearchController{DB: db}
+}
+
+// Search mencari lagu berdasarkan judul, artis, genre dan lirik
+func (c *SearchController) Search(ctx *gin.Context) {
+	var req models.SearchQuery
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid query: %v", err)})
+		return
+	}
+
+	q := strings.TrimSpace(req.Q)
+	if q == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Query parameter q is required"})
+		return
+	}
+	if len(q) > maxSearchQueryLength {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Query must be at most %d characters", maxSearchQueryLength)})
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = defaultSearchLimit
+	}
+
+	results, err := c.fullTextSearch(q, req.Limit)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	response := models.SearchResponse{Query: q, Results: results}
+	if len(results) == 0 {
+		// Tidak ada kata yang cocok, coba pencarian yang toleran terhadap typo
+		response.Results, err = c.trigramSearch(q, req.Limit)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+			return
+		}
+		response.Fuzzy = true
+	}
+
+	ctx.JSON(http.StatusOK, response)
+}
+
+// Helper function to run the ranked full-text search with highlights
+func (c *SearchController) fullTextSearch(q string, limit int) ([]models.SearchResult, error) {
+	rows, err := c.DB.Query(fullTextSearchQuery, q, limit, shortHeadlineOptions, lyricsHeadlineOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []models.SearchResult{}
+	for rows.Next() {
+		var result models.SearchResult
+		var title, artist string
+		var genre, lyrics sql.NullString
+
+		result.SongResponse, err = scanSong(extraColumnsScanner{
+			rows:  rows,
+			extra: []interface{}{&result.Rank, &title, &artist, &genre, &lyrics},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		result.Highlights.Title = highlight(title)
+		result.Highlights.Artist = highlight(artist)
+		if genre.Valid {
+			value := highlight(genre.String)
+			result.Highlights.GenreName = &value
+		}
+		if lyrics.Valid {
+			value := highlight(lyrics.String)
+			result.Highlights.Lyrics = &value
+		}
+		results = append(results, result)
+	}
+
+	return results, rows.Err()
+}
+
+// Helper function to run the trigram fallback, results are not highlighted
+func (c *SearchController) trigramSearch(q string, limit int) ([]models.SearchResult, error) {
+	tx, err := c.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Batas skor operator <% hanya berlaku untuk transaksi ini
+	_, err = tx.Exec("SELECT set_config('pg_trgm.word_similarity_threshold', $1, true)", strconv.FormatFloat(searchSimilarityThreshold, 'f', -1, 64))
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(trigramSearchQuery, q, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []models.SearchResult{}
+	for rows.Next() {
+		var result models.SearchResult
+		result.SongResponse, err = scanSong(extraColumnsScanner{rows: rows, extra: []interface{}{&result.Rank}})
+		if err != nil {
+			return nil, err
+		}
+
+		result.Highlights.Title = html.EscapeString(result.Title)
+		result.Highlights.Artist = html.EscapeString(result.Artist)
+		if result.GenreName != nil {
+			value := html.EscapeString(*result.GenreName)
+			result.Highlights.GenreName = &value
+		}
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return results, tx.Commit()
+}
+
+// Helper function to escape a ts_headline result and turn its markers into <mark>
+func highlight(headline string) string {
+	escaped := html.EscapeString(headline)
+	escaped = strings.ReplaceAll(escaped, headlineStart, "<mark>")
+	return strings.ReplaceAll(escaped, headlineStop, "</mark>")
+}
@@ -2,176 +2,244 @@ package controllers
 
 import (
 	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 
 	"backend-turningjane/models"
 	"backend-turningjane/utils"
 )
 
 type SongController struct {
-	DB            *sql.DB
-	StorageConfig *utils.SupabaseStorageConfig
+	DB      *sql.DB
+	Storage utils.Storage
+	Outbox  *utils.DeletionOutbox
 }
 
-func NewSongController(db *sql.DB) *SongController {
+func NewSongController(db *sql.DB, storage utils.Storage, outbox *utils.DeletionOutbox) *SongController {
 	return &SongController{
-		DB:            db,
-		StorageConfig: utils.NewSupabaseStorageConfig(),
+		DB:      db,
+		Storage: storage,
+		Outbox:  outbox,
 	}
 }
 
-// Helper function to check if error is "file not found"
-func (c *SongController) isNotFoundError(err error) bool {
-	if err == nil {
-		return false
+// Helper function to map form binding errors to a status code
+func bindErrorStatus(err error) int {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return http.StatusRequestEntityTooLarge
 	}
+	return http.StatusBadRequest
+}
 
-	errStr := strings.ToLower(err.Error())
-	return strings.Contains(errStr, "404") ||
-		strings.Contains(errStr, "not_found") ||
-		strings.Contains(errStr, "object not found") ||
-		strings.Contains(errStr, "nosuchkey")
+// Helper function to map storage errors to a status code
+func storageErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, utils.ErrStorageQuota):
+		return http.StatusInsufficientStorage
+	case errors.Is(err, utils.ErrStorageTransient):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, utils.ErrStorageUnauthorized):
+		// Kredensial storage server yang salah, bukan kesalahan klien
+		return http.StatusBadGateway
+	}
+	return http.StatusInternalServerError
 }
 
-// Helper function to safely delete file from Supabase storage
-func (c *SongController) safeDeleteFile(filePath string, fileType string) {
-	if filePath == "" {
-		return
-	}
+// Helper function to sniff and validate uploaded song files. It writes a
+// field-level 400 response and returns false when a file is rejected.
+func (c *SongController) validateSongFiles(ctx *gin.Context, audioFile, imageFile *multipart.FileHeader) bool {
+	fieldErrors := gin.H{}
 
-	log.Printf("Attempting to delete %s file: %s", fileType, filePath)
+	checks := []struct {
+		file *multipart.FileHeader
+		rule utils.FileRule
+	}{
+		{audioFile, utils.SongAudioRule()},
+		{imageFile, utils.SongImageRule()},
+	}
 
-	err := c.StorageConfig.DeleteFile(filePath)
-	if err != nil {
-		if c.isNotFoundError(err) {
-			log.Printf("%s file already deleted or not found: %s", fileType, filePath)
-		} else {
-			log.Printf("Error deleting %s file %s: %v", fileType, filePath, err)
+	for _, check := range checks {
+		if check.file == nil {
+			continue
 		}
-	} else {
-		log.Printf("Successfully deleted %s file: %s", fileType, filePath)
+		if _, err := check.rule.Validate(check.file); err != nil {
+			var fieldErr *utils.FieldError
+			if !errors.As(err, &fieldErr) {
+				ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to read uploaded file: %v", err)})
+				return false
+			}
+			fieldErrors[fieldErr.Field] = fieldErr.Message
+		}
+	}
+
+	if len(fieldErrors) > 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file upload", "fields": fieldErrors})
+		return false
 	}
+	return true
 }
 
-// ListSongs mengambil daftar semua lagu dari database
-func (c *SongController) ListSongs(ctx *gin.Context) {
-	query := `
-		SELECT s.song_id, s.title, s.artist, s.genre_id, 
-			   g.genre_name, s.release_year, s.audio_file_path, s.image_path
-		FROM songs s
-		LEFT JOIN genres g ON s.genre_id = g.genre_id
-	`
-
-	rows, err := c.DB.Query(query)
-	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
-		return
+// songLyrics adalah lirik dari request. nil berarti kolom tidak diubah, string
+// kosong menghapus lirik.
+type songLyrics struct {
+	Plain *string
+	LRC   *string
+}
+
+// Helper function to validate lyrics from a request. The LRC is parsed and,
+// when no plain text was sent, its lines become the plain lyrics. lrcField is
+// the request field the LRC came from and is used as the key of field errors.
+func parseSongLyrics(plain, lrc *string, lrcField string) (songLyrics, gin.H) {
+	fieldErrors := gin.H{}
+
+	if plain != nil {
+		if len(*plain) > utils.MaxLyricsSize {
+			fieldErrors["lyrics"] = fmt.Sprintf("lyrics are larger than %d KB", utils.MaxLyricsSize>>10)
+		} else if !utf8.ValidString(*plain) {
+			fieldErrors["lyrics"] = "lyrics must be UTF-8 encoded"
+		}
 	}
-	defer rows.Close()
 
-	var songs []models.SongResponse
-	for rows.Next() {
-		var song models.SongResponse
-		var genreID sql.NullString
-		var genreName sql.NullString
-		var releaseYear sql.NullInt32
-		var audioFilePath sql.NullString
-		var imagePath sql.NullString
-
-		err := rows.Scan(
-			&song.SongID,
-			&song.Title,
-			&song.Artist,
-			&genreID,
-			&genreName,
-			&releaseYear,
-			&audioFilePath,
-			&imagePath,
-		)
+	if lrc != nil && strings.TrimSpace(*lrc) != "" {
+		parsed, err := utils.ParseLRC(*lrc)
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Scan error: %v", err)})
-			return
+			fieldErrors[lrcField] = err.Error()
+		} else if plain == nil || *plain == "" {
+			text := parsed.PlainText()
+			plain = &text
 		}
+	}
 
-		if genreID.Valid {
-			parsedID, err := uuid.Parse(genreID.String)
-			if err == nil {
-				song.GenreID = &parsedID
-			}
-		}
-		if genreName.Valid {
-			song.GenreName = &genreName.String
-		}
-		if releaseYear.Valid {
-			year := int(releaseYear.Int32)
-			song.ReleaseYear = &year
-		}
-		if audioFilePath.Valid {
-			song.AudioFilePath = &audioFilePath.String
-		}
-		if imagePath.Valid {
-			song.ImagePath = &imagePath.String
-		}
+	if len(fieldErrors) > 0 {
+		return songLyrics{}, fieldErrors
+	}
+	return songLyrics{Plain: plain, LRC: lrc}, nil
+}
 
-		songs = append(songs, song)
+// Helper function to read an uploaded .lrc file
+func readLyricsFile(fileHeader *multipart.FileHeader) (*string, error) {
+	if fileHeader.Size > utils.MaxLyricsSize {
+		return nil, &utils.LRCError{Message: fmt.Sprintf("lyrics are larger than %d KB", utils.MaxLyricsSize>>10)}
 	}
 
-	if err = rows.Err(); err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Rows error: %v", err)})
-		return
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, err
 	}
+	defer file.Close()
 
-	ctx.JSON(http.StatusOK, songs)
+	data, err := io.ReadAll(io.LimitReader(file, utils.MaxLyricsSize+1))
+	if err != nil {
+		return nil, err
+	}
+	content := string(data)
+	return &content, nil
 }
 
-// CreateSong menambahkan lagu baru ke dalam database (JSON based)
-func (c *SongController) CreateSong(ctx *gin.Context) {
-	var req models.CreateSongRequest
-	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid request: %v", err)})
-		return
+// Helper function to validate the lyrics fields of a song form. It writes a
+// field-level 400 response and returns false when the lyrics are rejected.
+func formLyrics(ctx *gin.Context, plain *string, lyricsFile *multipart.FileHeader) (songLyrics, bool) {
+	var lrc *string
+	if lyricsFile != nil {
+		content, err := readLyricsFile(lyricsFile)
+		if err != nil {
+			var lrcErr *utils.LRCError
+			if errors.As(err, &lrcErr) {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid lyrics", "fields": gin.H{"lyrics_file": lrcErr.Error()}})
+			} else {
+				ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to read uploaded file: %v", err)})
+			}
+			return songLyrics{}, false
+		}
+		lrc = content
 	}
 
-	query := `
-		INSERT INTO songs (title, artist, genre_id, release_year, audio_file_path, image_path)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		RETURNING song_id, title, artist, genre_id, release_year, audio_file_path, image_path
-	`
+	lyrics, fieldErrors := parseSongLyrics(plain, lrc, "lyrics_file")
+	if fieldErrors != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid lyrics", "fields": fieldErrors})
+		return songLyrics{}, false
+	}
+	return lyrics, true
+}
+
+// UploadStats menampilkan statistik upload yang sedang berjalan
+func (c *SongController) UploadStats(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, utils.GetUploadStats())
+}
+
+// songColumns adalah kolom yang dibaca oleh scanSong, dengan alias s untuk songs dan g untuk genres
+const songColumns = `
+	s.song_id, s.title, s.artist, s.genre_id, g.genre_name, s.release_year,
+	s.audio_file_path, s.image_path, s.image_variants, s.duration_seconds, s.bitrate, s.sample_rate, s.codec,
+	s.album_id, s.disc_number, s.track_number
+`
+
+// songSelectQuery mengambil lagu beserta nama genre, pemanggil menambahkan WHERE sendiri
+const songSelectQuery = `SELECT ` + songColumns + ` FROM songs s LEFT JOIN genres g ON s.genre_id = g.genre_id`
+
+// songMutationQuery membungkus INSERT/UPDATE ... RETURNING * agar hasilnya
+// memiliki kolom yang sama dengan songSelectQuery
+func songMutationQuery(statement string) string {
+	return `WITH s AS (` + statement + `) SELECT ` + songColumns + ` FROM s LEFT JOIN genres g ON s.genre_id = g.genre_id`
+}
 
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// Helper function to scan a row selected with songColumns
+func scanSong(row rowScanner) (models.SongResponse, error) {
 	var song models.SongResponse
 	var genreID sql.NullString
+	var genreName sql.NullString
 	var releaseYear sql.NullInt32
 	var audioFilePath sql.NullString
 	var imagePath sql.NullString
-
-	err := c.DB.QueryRow(
-		query,
-		req.Title,
-		req.Artist,
-		req.GenreID,
-		req.ReleaseYear,
-		req.AudioFilePath,
-		req.ImagePath,
-	).Scan(
+	var imageVariants []byte
+	var durationSeconds sql.NullFloat64
+	var bitrate sql.NullInt32
+	var sampleRate sql.NullInt32
+	var codec sql.NullString
+	var albumID uuid.NullUUID
+	var discNumber sql.NullInt32
+	var trackNumber sql.NullInt32
+
+	err := row.Scan(
 		&song.SongID,
 		&song.Title,
 		&song.Artist,
 		&genreID,
+		&genreName,
 		&releaseYear,
 		&audioFilePath,
 		&imagePath,
+		&imageVariants,
+		&durationSeconds,
+		&bitrate,
+		&sampleRate,
+		&codec,
+		&albumID,
+		&discNumber,
+		&trackNumber,
 	)
-
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
-		return
+		return song, err
 	}
 
 	if genreID.Valid {
@@ -180,6 +248,9 @@ func (c *SongController) CreateSong(ctx *gin.Context) {
 			song.GenreID = &parsedID
 		}
 	}
+	if genreName.Valid {
+		song.GenreName = &genreName.String
+	}
 	if releaseYear.Valid {
 		year := int(releaseYear.Int32)
 		song.ReleaseYear = &year
@@ -190,6 +261,414 @@ func (c *SongController) CreateSong(ctx *gin.Context) {
 	if imagePath.Valid {
 		song.ImagePath = &imagePath.String
 	}
+	song.ImageVariants = decodeImageVariants(imageVariants)
+	if durationSeconds.Valid {
+		song.DurationSeconds = &durationSeconds.Float64
+	}
+	if bitrate.Valid {
+		value := int(bitrate.Int32)
+		song.Bitrate = &value
+	}
+	if sampleRate.Valid {
+		value := int(sampleRate.Int32)
+		song.SampleRate = &value
+	}
+	if codec.Valid {
+		song.Codec = &codec.String
+	}
+	if albumID.Valid {
+		song.AlbumID = &albumID.UUID
+	}
+	if discNumber.Valid {
+		value := int(discNumber.Int32)
+		song.DiscNumber = &value
+	}
+	if trackNumber.Valid {
+		value := int(trackNumber.Int32)
+		song.TrackNumber = &value
+	}
+
+	return song, nil
+}
+
+// Helper function to read the tags of an uploaded audio file. Files we cannot
+// parse are still accepted, they simply get no metadata.
+func (c *SongController) readAudioMetadata(audioFile *multipart.FileHeader) *utils.AudioMetadata {
+	if audioFile == nil {
+		return nil
+	}
+
+	meta, err := utils.ReadAudioMetadataFromFile(audioFile)
+	if err != nil {
+		log.Printf("Could not read audio metadata from %s: %v", audioFile.Filename, err)
+		return nil
+	}
+	return meta
+}
+
+// Helper function to compute the waveform peaks of an uploaded audio file.
+// Formats we cannot decode simply get no waveform.
+func (c *SongController) computeWaveform(audioFile *multipart.FileHeader) []float64 {
+	if audioFile == nil {
+		return nil
+	}
+
+	peaks, err := utils.ComputeWaveformFromFile(audioFile, utils.WaveformResolution)
+	if err != nil {
+		log.Printf("Could not compute waveform for %s: %v", audioFile.Filename, err)
+		return nil
+	}
+	return peaks
+}
+
+// Helper function to decode the image_variants column
+func decodeImageVariants(raw []byte) utils.ImageVariants {
+	if len(raw) == 0 {
+		return nil
+	}
+
+	var variants utils.ImageVariants
+	if err := json.Unmarshal(raw, &variants); err != nil {
+		log.Printf("Invalid image variants %s: %v", raw, err)
+		return nil
+	}
+	return variants
+}
+
+// Helper function to encode image variants for the image_variants column
+func encodeImageVariants(variants utils.ImageVariants) interface{} {
+	if len(variants) == 0 {
+		return nil
+	}
+
+	raw, err := json.Marshal(variants)
+	if err != nil {
+		return nil
+	}
+	return string(raw)
+}
+
+// Helper function to list a song image together with its variants
+func imageFiles(imagePath string, variants utils.ImageVariants) []string {
+	files := []string{imagePath}
+
+	// Sumber yang kecil memakai file yang sama untuk beberapa ukuran
+	seen := map[string]bool{imagePath: true}
+	for _, url := range variants {
+		if !seen[url] {
+			seen[url] = true
+			files = append(files, url)
+		}
+	}
+	return files
+}
+
+// Helper function to list the stored files a song update stops referencing
+func replacedSongFiles(currentAudio, currentImage sql.NullString, currentVariants []byte, audioFilePath, imagePath interface{}) []string {
+	var files []string
+	if currentAudio.Valid && currentAudio.String != "" && audioFilePath != currentAudio.String {
+		files = append(files, currentAudio.String)
+	}
+	if currentImage.Valid && currentImage.String != "" && imagePath != currentImage.String {
+		files = append(files, imageFiles(currentImage.String, decodeImageVariants(currentVariants))...)
+	}
+	return files
+}
+
+// Helper function to upload the cover art embedded in an audio file
+func (c *SongController) uploadEmbeddedCover(meta *utils.AudioMetadata) (*string, utils.ImageVariants) {
+	if meta == nil || meta.Picture == nil {
+		return nil, nil
+	}
+
+	rule := utils.SongImageRule()
+	allowed := false
+	for _, t := range rule.AllowedTypes {
+		if t == meta.Picture.MIMEType {
+			allowed = true
+			break
+		}
+	}
+	if !allowed || int64(len(meta.Picture.Data)) > rule.MaxSize {
+		log.Printf("Skipping embedded cover art of type %s", meta.Picture.MIMEType)
+		return nil, nil
+	}
+
+	path, variants, err := c.Storage.UploadSongImageData(meta.Picture.Data, meta.Picture.MIMEType)
+	if err != nil {
+		log.Printf("Failed to upload embedded cover art: %v", err)
+		return nil, nil
+	}
+	return &path, variants
+}
+
+// audioDetails converts extracted metadata into nullable column values
+func audioDetails(meta *utils.AudioMetadata) (duration, bitrate, sampleRate, codec interface{}) {
+	if meta == nil {
+		return nil, nil, nil, nil
+	}
+	if meta.DurationSeconds > 0 {
+		duration = meta.DurationSeconds
+	}
+	if meta.Bitrate > 0 {
+		bitrate = meta.Bitrate
+	}
+	if meta.SampleRate > 0 {
+		sampleRate = meta.SampleRate
+	}
+	if meta.Codec != "" {
+		codec = meta.Codec
+	}
+	return
+}
+
+// defaultSongPageSize adalah jumlah lagu per halaman jika limit tidak diisi
+const defaultSongPageSize = 20
+
+// songSortColumns memetakan parameter sort ke ekspresi ORDER BY. Tahun yang
+// kosong dianggap 0 agar perbandingan cursor tidak bertemu NULL.
+var songSortColumns = map[string]string{
+	"title":      "s.title",
+	"year":       "COALESCE(s.release_year, 0)",
+	"created_at": "s.created_at",
+}
+
+// songCursor menandai lagu terakhir sebuah halaman GET /songs
+type songCursor struct {
+	Sort  string          `json:"sort"`
+	Order string          `json:"order"`
+	Key   json.RawMessage `json:"key"`
+	ID    uuid.UUID       `json:"id"`
+}
+
+// Helper function to allocate the scan destination of a sort key
+func newSortKey(sort string) interface{} {
+	switch sort {
+	case "title":
+		return new(string)
+	case "year":
+		return new(int64)
+	}
+	return new(time.Time)
+}
+
+// Helper function to encode the position after the given song
+func encodeSongCursor(sort, order string, key interface{}, id uuid.UUID) (string, error) {
+	rawKey, err := json.Marshal(key)
+	if err != nil {
+		return "", err
+	}
+	raw, err := json.Marshal(songCursor{Sort: sort, Order: order, Key: rawKey, ID: id})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// Helper function to decode a cursor, it must come from the same sort and order
+func decodeSongCursor(value, sort, order string) (interface{}, uuid.UUID, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+
+	var cursor songCursor
+	if err := json.Unmarshal(raw, &cursor); err != nil {
+		return nil, uuid.Nil, err
+	}
+	if cursor.Sort != sort || cursor.Order != order {
+		return nil, uuid.Nil, errors.New("cursor was created with a different sort order")
+	}
+
+	key := newSortKey(sort)
+	if err := json.Unmarshal(cursor.Key, key); err != nil {
+		return nil, uuid.Nil, err
+	}
+	return key, cursor.ID, nil
+}
+
+// extraColumnsScanner membaca kolom tambahan yang dipilih setelah songColumns
+// atau kolom standar lain seperti playlistColumns
+type extraColumnsScanner struct {
+	rows  rowScanner
+	extra []interface{}
+}
+
+func (s extraColumnsScanner) Scan(dest ...interface{}) error {
+	return s.rows.Scan(append(dest, s.extra...)...)
+}
+
+// ListSongs mengambil daftar lagu per halaman dengan filter dan urutan
+//
+// Parameter query: limit (1-100), cursor, genre_id, artist, year_from,
+// year_to, has_audio, sort (title|year|created_at) dan order (asc|desc)
+func (c *SongController) ListSongs(ctx *gin.Context) {
+	var req models.ListSongsQuery
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid query: %v", err)})
+		return
+	}
+
+	if req.Limit == 0 {
+		req.Limit = defaultSongPageSize
+	}
+	if req.Sort == "" {
+		req.Sort = "created_at"
+	}
+	if req.Order == "" {
+		req.Order = "asc"
+		if req.Sort == "created_at" {
+			// Lagu terbaru ditampilkan lebih dulu
+			req.Order = "desc"
+		}
+	}
+
+	var cursorKey interface{}
+	var cursorID uuid.UUID
+	if req.Cursor != "" {
+		var err error
+		cursorKey, cursorID, err = decodeSongCursor(req.Cursor, req.Sort, req.Order)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid cursor: %v", err)})
+			return
+		}
+	}
+
+	// Susun filter dengan parameter bernomor
+	var conditions []string
+	var args []interface{}
+	addArg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if req.GenreID != "" {
+		conditions = append(conditions, "s.genre_id = "+addArg(req.GenreID))
+	}
+	if req.Artist != "" {
+		escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(req.Artist)
+		conditions = append(conditions, "s.artist ILIKE "+addArg("%"+escaped+"%"))
+	}
+	if req.YearFrom != nil {
+		conditions = append(conditions, "s.release_year >= "+addArg(*req.YearFrom))
+	}
+	if req.YearTo != nil {
+		conditions = append(conditions, "s.release_year <= "+addArg(*req.YearTo))
+	}
+	if req.HasAudio != nil {
+		if *req.HasAudio {
+			conditions = append(conditions, "COALESCE(s.audio_file_path, '') <> ''")
+		} else {
+			conditions = append(conditions, "COALESCE(s.audio_file_path, '') = ''")
+		}
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	// Total dihitung tanpa cursor agar sama di setiap halaman
+	var total int
+	if err := c.DB.QueryRow("SELECT COUNT(*) FROM songs s"+where, args...).Scan(&total); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	sortColumn := songSortColumns[req.Sort]
+	direction, comparison := "ASC", ">"
+	if req.Order == "desc" {
+		direction, comparison = "DESC", "<"
+	}
+
+	if req.Cursor != "" {
+		condition := fmt.Sprintf("(%s, s.song_id) %s (%s, %s)", sortColumn, comparison, addArg(cursorKey), addArg(cursorID))
+		if where == "" {
+			where = " WHERE " + condition
+		} else {
+			where += " AND " + condition
+		}
+	}
+
+	// Ambil satu baris lebih untuk mengetahui apakah masih ada halaman berikutnya
+	query := `SELECT ` + songColumns + `, ` + sortColumn + ` FROM songs s LEFT JOIN genres g ON s.genre_id = g.genre_id` +
+		where + fmt.Sprintf(" ORDER BY %s %s, s.song_id %s LIMIT %s", sortColumn, direction, direction, addArg(req.Limit+1))
+
+	rows, err := c.DB.Query(query, args...)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	defer rows.Close()
+
+	response := models.SongListResponse{Songs: []models.SongResponse{}, Total: total}
+	var lastKey interface{}
+	for rows.Next() {
+		if len(response.Songs) == req.Limit {
+			cursor, err := encodeSongCursor(req.Sort, req.Order, lastKey, response.Songs[len(response.Songs)-1].SongID)
+			if err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Cursor error: %v", err)})
+				return
+			}
+			response.NextCursor = &cursor
+			break
+		}
+
+		key := newSortKey(req.Sort)
+		song, err := scanSong(extraColumnsScanner{rows: rows, extra: []interface{}{key}})
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Scan error: %v", err)})
+			return
+		}
+
+		response.Songs = append(response.Songs, song)
+		lastKey = key
+	}
+
+	if err = rows.Err(); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Rows error: %v", err)})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, response)
+}
+
+// CreateSong menambahkan lagu baru ke dalam database (JSON based)
+func (c *SongController) CreateSong(ctx *gin.Context) {
+	var req models.CreateSongRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid request: %v", err)})
+		return
+	}
+
+	lyrics, fieldErrors := parseSongLyrics(req.Lyrics, req.LyricsLRC, "lyrics_lrc")
+	if fieldErrors != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid lyrics", "fields": fieldErrors})
+		return
+	}
+
+	query := songMutationQuery(`
+		INSERT INTO songs (title, artist, genre_id, release_year, audio_file_path, image_path, lyrics, lyrics_lrc)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7::text, ''), NULLIF($8::text, ''))
+		RETURNING *
+	`)
+
+	song, err := scanSong(c.DB.QueryRow(
+		query,
+		req.Title,
+		req.Artist,
+		req.GenreID,
+		req.ReleaseYear,
+		req.AudioFilePath,
+		req.ImagePath,
+		lyrics.Plain,
+		lyrics.LRC,
+	))
+
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
 
 	ctx.JSON(http.StatusCreated, song)
 }
@@ -198,7 +677,44 @@ func (c *SongController) CreateSong(ctx *gin.Context) {
 func (c *SongController) CreateSongWithFiles(ctx *gin.Context) {
 	var req models.CreateSongFormRequest
 	if err := ctx.ShouldBind(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid form request: %v", err)})
+		ctx.JSON(bindErrorStatus(err), gin.H{"error": fmt.Sprintf("Invalid form request: %v", err)})
+		return
+	}
+
+	// Periksa tipe dan ukuran file sebelum diupload
+	if !c.validateSongFiles(ctx, req.AudioFile, req.ImageFile) {
+		return
+	}
+
+	// Lirik LRC divalidasi sebelum file lain diupload
+	lyrics, ok := formLyrics(ctx, &req.Lyrics, req.LyricsFile)
+	if !ok {
+		return
+	}
+
+	// Lengkapi data yang kosong dari tag file audio
+	audioMeta := c.readAudioMetadata(req.AudioFile)
+	if audioMeta != nil {
+		if req.Title == "" {
+			req.Title = audioMeta.Title
+		}
+		if req.Artist == "" {
+			req.Artist = audioMeta.Artist
+		}
+		if req.ReleaseYear == "" && audioMeta.Year > 0 {
+			req.ReleaseYear = strconv.Itoa(audioMeta.Year)
+		}
+	}
+
+	fieldErrors := gin.H{}
+	if req.Title == "" {
+		fieldErrors["title"] = "title is required"
+	}
+	if req.Artist == "" {
+		fieldErrors["artist"] = "artist is required"
+	}
+	if len(fieldErrors) > 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid form request", "fields": fieldErrors})
 		return
 	}
 
@@ -227,42 +743,44 @@ func (c *SongController) CreateSongWithFiles(ctx *gin.Context) {
 	// Upload audio file if provided
 	var audioFilePath *string
 	if req.AudioFile != nil {
-		path, err := c.StorageConfig.UploadSongAudio(req.AudioFile)
+		path, err := c.Storage.UploadSongAudio(req.AudioFile)
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to upload audio file: %v", err)})
+			ctx.JSON(storageErrorStatus(err), gin.H{"error": fmt.Sprintf("Failed to upload audio file: %v", err)})
 			return
 		}
 		audioFilePath = &path
 	}
 
-	// Upload image file if provided
+	// Upload image file if provided, otherwise fall back to the embedded cover art
 	var imagePath *string
+	var imageVariants utils.ImageVariants
 	if req.ImageFile != nil {
-		path, err := c.StorageConfig.UploadSongImage(req.ImageFile)
+		path, variants, err := c.Storage.UploadSongImage(req.ImageFile)
 		if err != nil {
-			// If we've already uploaded the audio file, try to delete it to avoid orphaned files
+			// If we've already uploaded the audio file, queue it for deletion to avoid orphaned files
 			if audioFilePath != nil {
-				_ = c.StorageConfig.DeleteFile(*audioFilePath)
+				c.Outbox.Discard(*audioFilePath)
 			}
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to upload image file: %v", err)})
+			ctx.JSON(storageErrorStatus(err), gin.H{"error": fmt.Sprintf("Failed to upload image file: %v", err)})
 			return
 		}
 		imagePath = &path
+		imageVariants = variants
+	} else {
+		imagePath, imageVariants = c.uploadEmbeddedCover(audioMeta)
 	}
 
-	query := `
-		INSERT INTO songs (title, artist, genre_id, release_year, audio_file_path, image_path)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		RETURNING song_id, title, artist, genre_id, release_year, audio_file_path, image_path
-	`
+	duration, bitrate, sampleRate, codec := audioDetails(audioMeta)
+	peaks := c.computeWaveform(req.AudioFile)
 
-	var song models.SongResponse
-	var dbGenreID sql.NullString
-	var dbReleaseYear sql.NullInt32
-	var dbAudioFilePath sql.NullString
-	var dbImagePath sql.NullString
+	query := songMutationQuery(`
+		INSERT INTO songs (title, artist, genre_id, release_year, audio_file_path, image_path,
+			image_variants, duration_seconds, bitrate, sample_rate, codec, waveform_peaks, lyrics, lyrics_lrc)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, NULLIF($13::text, ''), NULLIF($14::text, ''))
+		RETURNING *
+	`)
 
-	err := c.DB.QueryRow(
+	song, err := scanSong(c.DB.QueryRow(
 		query,
 		req.Title,
 		req.Artist,
@@ -270,45 +788,30 @@ func (c *SongController) CreateSongWithFiles(ctx *gin.Context) {
 		releaseYear,
 		audioFilePath,
 		imagePath,
-	).Scan(
-		&song.SongID,
-		&song.Title,
-		&song.Artist,
-		&dbGenreID,
-		&dbReleaseYear,
-		&dbAudioFilePath,
-		&dbImagePath,
-	)
+		encodeImageVariants(imageVariants),
+		duration,
+		bitrate,
+		sampleRate,
+		codec,
+		pq.Array(peaks),
+		lyrics.Plain,
+		lyrics.LRC,
+	))
 
 	if err != nil {
 		// Cleanup uploaded files on database error
+		var uploaded []string
 		if audioFilePath != nil {
-			c.safeDeleteFile(*audioFilePath, "audio")
+			uploaded = append(uploaded, *audioFilePath)
 		}
 		if imagePath != nil {
-			c.safeDeleteFile(*imagePath, "image")
+			uploaded = append(uploaded, imageFiles(*imagePath, imageVariants)...)
 		}
+		c.Outbox.Discard(uploaded...)
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
 		return
 	}
 
-	if dbGenreID.Valid {
-		parsedID, err := uuid.Parse(dbGenreID.String)
-		if err == nil {
-			song.GenreID = &parsedID
-		}
-	}
-	if dbReleaseYear.Valid {
-		year := int(dbReleaseYear.Int32)
-		song.ReleaseYear = &year
-	}
-	if dbAudioFilePath.Valid {
-		song.AudioFilePath = &dbAudioFilePath.String
-	}
-	if dbImagePath.Valid {
-		song.ImagePath = &dbImagePath.String
-	}
-
 	ctx.JSON(http.StatusCreated, song)
 }
 
@@ -321,32 +824,31 @@ func (c *SongController) GetSong(ctx *gin.Context) {
 		return
 	}
 
-	query := `
-		SELECT s.song_id, s.title, s.artist, s.genre_id, 
-			   g.genre_name, s.release_year, s.audio_file_path, s.image_path
-		FROM songs s
-		LEFT JOIN genres g ON s.genre_id = g.genre_id
-		WHERE s.song_id = $1
-	`
+	song, err := scanSong(c.DB.QueryRow(songSelectQuery+" WHERE s.song_id = $1", id))
 
-	var song models.SongResponse
-	var genreID sql.NullString
-	var genreName sql.NullString
-	var releaseYear sql.NullInt32
-	var audioFilePath sql.NullString
-	var imagePath sql.NullString
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Song not found"})
+		} else {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		}
+		return
+	}
 
-	err = c.DB.QueryRow(query, id).Scan(
-		&song.SongID,
-		&song.Title,
-		&song.Artist,
-		&genreID,
-		&genreName,
-		&releaseYear,
-		&audioFilePath,
-		&imagePath,
-	)
+	ctx.JSON(http.StatusOK, song)
+}
+
+// GetWaveform mengambil puncak waveform lagu berdasarkan ID
+func (c *SongController) GetWaveform(ctx *gin.Context) {
+	idStr := ctx.Param("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid UUID format"})
+		return
+	}
 
+	var peaks pq.Float64Array
+	err = c.DB.QueryRow("SELECT waveform_peaks FROM songs WHERE song_id = $1", id).Scan(&peaks)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			ctx.JSON(http.StatusNotFound, gin.H{"error": "Song not found"})
@@ -356,27 +858,94 @@ func (c *SongController) GetSong(ctx *gin.Context) {
 		return
 	}
 
-	if genreID.Valid {
-		parsedID, err := uuid.Parse(genreID.String)
-		if err == nil {
-			song.GenreID = &parsedID
+	// Waveform hanya tersedia untuk file MP3/WAV yang diupload lewat form
+	if peaks == nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Waveform not available for this song"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, models.WaveformResponse{
+		SongID:     id,
+		Resolution: len(peaks),
+		Peaks:      peaks,
+	})
+}
+
+// lyricsFormats adalah format yang bisa diminta lewat header Accept, format
+// pertama dipakai jika Accept kosong atau */*
+var lyricsFormats = []string{gin.MIMEJSON, gin.MIMEPlain, "application/lrc", "text/x-lrc", "application/x-lrc"}
+
+// GetLyrics mengambil lirik lagu berdasarkan ID. JSON berisi baris LRC beserta
+// timestamp, text/plain berisi lirik biasa dan application/lrc berisi file LRC mentah.
+func (c *SongController) GetLyrics(ctx *gin.Context) {
+	idStr := ctx.Param("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid UUID format"})
+		return
+	}
+
+	ctx.Header("Vary", "Accept")
+	format := ctx.NegotiateFormat(lyricsFormats...)
+	if format == "" {
+		ctx.JSON(http.StatusNotAcceptable, gin.H{"error": "Lyrics are available as application/json, text/plain or application/lrc"})
+		return
+	}
+
+	var plain, lrc sql.NullString
+	err = c.DB.QueryRow("SELECT lyrics, lyrics_lrc FROM songs WHERE song_id = $1", id).Scan(&plain, &lrc)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Song not found"})
+		} else {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
 		}
+		return
 	}
-	if genreName.Valid {
-		song.GenreName = &genreName.String
+
+	switch format {
+	case gin.MIMEPlain:
+		if !plain.Valid {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Lyrics not available for this song"})
+			return
+		}
+		ctx.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(plain.String))
+		return
+	case gin.MIMEJSON:
+	default:
+		if !lrc.Valid {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Synced lyrics not available for this song"})
+			return
+		}
+		ctx.Data(http.StatusOK, format+"; charset=utf-8", []byte(lrc.String))
+		return
 	}
-	if releaseYear.Valid {
-		year := int(releaseYear.Int32)
-		song.ReleaseYear = &year
+
+	if !plain.Valid && !lrc.Valid {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Lyrics not available for this song"})
+		return
 	}
-	if audioFilePath.Valid {
-		song.AudioFilePath = &audioFilePath.String
+
+	response := models.LyricsResponse{SongID: id, Lines: []models.LyricsLine{}}
+	if plain.Valid {
+		response.Plain = &plain.String
 	}
-	if imagePath.Valid {
-		song.ImagePath = &imagePath.String
+	if lrc.Valid {
+		// LRC sudah divalidasi saat disimpan
+		parsed, err := utils.ParseLRC(lrc.String)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Stored lyrics are invalid: %v", err)})
+			return
+		}
+
+		response.Synced = true
+		response.Metadata = parsed.Metadata
+		for _, line := range parsed.Lines {
+			response.Lines = append(response.Lines, models.LyricsLine{TimeMs: line.TimeMs, Text: line.Text})
+		}
 	}
 
-	ctx.JSON(http.StatusOK, song)
+	ctx.JSON(http.StatusOK, response)
 }
 
 // UpdateSong memperbarui data lagu berdasarkan ID (JSON based)
@@ -394,16 +963,31 @@ func (c *SongController) UpdateSong(ctx *gin.Context) {
 		return
 	}
 
-	// Mengambil data lagu saat ini untuk pembaruan selektif
+	lyrics, fieldErrors := parseSongLyrics(req.Lyrics, req.LyricsLRC, "lyrics_lrc")
+	if fieldErrors != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid lyrics", "fields": fieldErrors})
+		return
+	}
+
+	tx, err := c.DB.Begin()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	defer tx.Rollback()
+
+	// Mengambil data lagu saat ini untuk pembaruan selektif, baris dikunci
+	// sampai transaksi selesai
 	var currentTitle string
 	var currentArtist string
 	var currentGenreID sql.NullString
 	var currentReleaseYear sql.NullInt32
 	var currentAudioFilePath sql.NullString
 	var currentImagePath sql.NullString
+	var currentImageVariants []byte
 
-	err = c.DB.QueryRow(
-		"SELECT title, artist, genre_id, release_year, audio_file_path, image_path FROM songs WHERE song_id = $1",
+	err = tx.QueryRow(
+		"SELECT title, artist, genre_id, release_year, audio_file_path, image_path, image_variants FROM songs WHERE song_id = $1 FOR UPDATE",
 		id,
 	).Scan(
 		&currentTitle,
@@ -412,6 +996,7 @@ func (c *SongController) UpdateSong(ctx *gin.Context) {
 		&currentReleaseYear,
 		&currentAudioFilePath,
 		&currentImagePath,
+		&currentImageVariants,
 	)
 
 	if err != nil {
@@ -462,7 +1047,7 @@ func (c *SongController) UpdateSong(ctx *gin.Context) {
 	}
 
 	// Menerapkan perubahan hanya jika ada data baru
-	query := `
+	query := songMutationQuery(`
 		UPDATE songs
 		SET 
 			title = $1,
@@ -470,18 +1055,17 @@ func (c *SongController) UpdateSong(ctx *gin.Context) {
 			genre_id = $3,
 			release_year = $4,
 			audio_file_path = $5,
-			image_path = $6
+			image_path = $6,
+			image_variants = CASE WHEN image_path IS DISTINCT FROM $6 THEN NULL ELSE image_variants END,
+			waveform_peaks = CASE WHEN audio_file_path IS DISTINCT FROM $5 THEN NULL ELSE waveform_peaks END,
+			lyrics = CASE WHEN $8::text IS NULL THEN lyrics ELSE NULLIF($8, '') END,
+			lyrics_lrc = CASE WHEN $9::text IS NULL THEN lyrics_lrc ELSE NULLIF($9, '') END,
+			updated_at = NOW()
 		WHERE song_id = $7
-		RETURNING song_id, title, artist, genre_id, release_year, audio_file_path, image_path
-	`
+		RETURNING *
+	`)
 
-	var song models.SongResponse
-	var updatedGenreID sql.NullString
-	var updatedReleaseYear sql.NullInt32
-	var updatedAudioFilePath sql.NullString
-	var updatedImagePath sql.NullString
-
-	err = c.DB.QueryRow(
+	song, err := scanSong(tx.QueryRow(
 		query,
 		title,
 		artist,
@@ -490,37 +1074,27 @@ func (c *SongController) UpdateSong(ctx *gin.Context) {
 		audioFilePath,
 		imagePath,
 		id,
-	).Scan(
-		&song.SongID,
-		&song.Title,
-		&song.Artist,
-		&updatedGenreID,
-		&updatedReleaseYear,
-		&updatedAudioFilePath,
-		&updatedImagePath,
-	)
+		lyrics.Plain,
+		lyrics.LRC,
+	))
 
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
 		return
 	}
 
-	if updatedGenreID.Valid {
-		parsedID, err := uuid.Parse(updatedGenreID.String)
-		if err == nil {
-			song.GenreID = &parsedID
-		}
-	}
-	if updatedReleaseYear.Valid {
-		year := int(updatedReleaseYear.Int32)
-		song.ReleaseYear = &year
-	}
-	if updatedAudioFilePath.Valid {
-		song.AudioFilePath = &updatedAudioFilePath.String
+	// File lama yang diganti dihapus setelah commit
+	replaced := replacedSongFiles(currentAudioFilePath, currentImagePath, currentImageVariants, audioFilePath, imagePath)
+	if err := c.Outbox.Enqueue(tx, replaced...); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
 	}
-	if updatedImagePath.Valid {
-		song.ImagePath = &updatedImagePath.String
+
+	if err := tx.Commit(); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
 	}
+	c.Outbox.Notify()
 
 	ctx.JSON(http.StatusOK, song)
 }
@@ -536,20 +1110,121 @@ func (c *SongController) UpdateSongWithFiles(ctx *gin.Context) {
 
 	var req models.UpdateSongFormRequest
 	if err := ctx.ShouldBind(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid form request: %v", err)})
+		ctx.JSON(bindErrorStatus(err), gin.H{"error": fmt.Sprintf("Invalid form request: %v", err)})
+		return
+	}
+
+	// Periksa tipe dan ukuran file sebelum diupload
+	if !c.validateSongFiles(ctx, req.AudioFile, req.ImageFile) {
+		return
+	}
+
+	lyrics, ok := formLyrics(ctx, req.Lyrics, req.LyricsFile)
+	if !ok {
 		return
 	}
 
-	// Mengambil data lagu saat ini untuk pembaruan selektif
+	var reqGenreID interface{} = nil
+	if req.GenreID != nil && *req.GenreID != "" {
+		parsed, err := uuid.Parse(*req.GenreID)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid genre ID format"})
+			return
+		}
+		reqGenreID = parsed
+	}
+
+	var reqReleaseYear interface{} = nil
+	if req.ReleaseYear != nil && *req.ReleaseYear != "" {
+		year, err := strconv.Atoi(*req.ReleaseYear)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid release year format"})
+			return
+		}
+		reqReleaseYear = year
+	}
+
+	// Lagu yang tidak ada tidak perlu menerima upload. Status gambar dibaca
+	// tanpa kunci dan diperiksa ulang di dalam transaksi.
+	var hasImage bool
+	err = c.DB.QueryRow("SELECT image_path IS NOT NULL FROM songs WHERE song_id = $1", id).Scan(&hasImage)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Song not found"})
+		} else {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		}
+		return
+	}
+
+	// Metadata dari file audio baru dipakai untuk data yang masih kosong
+	audioMeta := c.readAudioMetadata(req.AudioFile)
+
+	// File yang baru diupload dihapus lagi jika transaksi gagal
+	var uploaded []string
+	defer func() {
+		if uploaded != nil {
+			c.Outbox.Discard(uploaded...)
+		}
+	}()
+
+	// File diupload dan waveform dihitung sebelum transaksi dibuka, agar
+	// koneksi database dan kunci baris tidak tertahan selama upload
+	var newAudioPath string
+	if req.AudioFile != nil {
+		path, err := c.Storage.UploadSongAudio(req.AudioFile)
+		if err != nil {
+			ctx.JSON(storageErrorStatus(err), gin.H{"error": fmt.Sprintf("Failed to upload audio file: %v", err)})
+			return
+		}
+		newAudioPath = path
+		uploaded = append(uploaded, path)
+	}
+
+	var newImagePath string
+	var newImageVariants utils.ImageVariants
+	var embeddedCover []string
+	if req.ImageFile != nil {
+		// Upload file gambar baru beserta variannya
+		path, variants, err := c.Storage.UploadSongImage(req.ImageFile)
+		if err != nil {
+			ctx.JSON(storageErrorStatus(err), gin.H{"error": fmt.Sprintf("Failed to upload image file: %v", err)})
+			return
+		}
+		newImagePath, newImageVariants = path, variants
+		uploaded = append(uploaded, imageFiles(path, variants)...)
+	} else if !hasImage {
+		// Lagu belum punya gambar, gunakan cover art dari file audio
+		if cover, variants := c.uploadEmbeddedCover(audioMeta); cover != nil {
+			newImagePath, newImageVariants = *cover, variants
+			embeddedCover = imageFiles(*cover, variants)
+			uploaded = append(uploaded, embeddedCover...)
+		}
+	}
+
+	// Detail audio dan waveform hanya diganti jika ada file audio baru
+	duration, bitrate, sampleRate, codec := audioDetails(audioMeta)
+	peaks := c.computeWaveform(req.AudioFile)
+
+	tx, err := c.DB.Begin()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	defer tx.Rollback()
+
+	// Mengambil data lagu saat ini untuk pembaruan selektif, baris dikunci
+	// sampai transaksi selesai agar file lama tidak diganti bersamaan
 	var currentTitle string
 	var currentArtist string
 	var currentGenreID sql.NullString
 	var currentReleaseYear sql.NullInt32
 	var currentAudioFilePath sql.NullString
 	var currentImagePath sql.NullString
+	var currentImageVariants []byte
 
-	err = c.DB.QueryRow(
-		"SELECT title, artist, genre_id, release_year, audio_file_path, image_path FROM songs WHERE song_id = $1",
+	err = tx.QueryRow(
+		"SELECT title, artist, genre_id, release_year, audio_file_path, image_path, image_variants FROM songs WHERE song_id = $1 FOR UPDATE",
 		id,
 	).Scan(
 		&currentTitle,
@@ -558,6 +1233,7 @@ func (c *SongController) UpdateSongWithFiles(ctx *gin.Context) {
 		&currentReleaseYear,
 		&currentAudioFilePath,
 		&currentImagePath,
+		&currentImageVariants,
 	)
 
 	if err != nil {
@@ -573,77 +1249,56 @@ func (c *SongController) UpdateSongWithFiles(ctx *gin.Context) {
 	title := currentTitle
 	if req.Title != nil {
 		title = *req.Title
+	} else if title == "" && audioMeta != nil {
+		title = audioMeta.Title
 	}
 
 	artist := currentArtist
 	if req.Artist != nil {
 		artist = *req.Artist
+	} else if artist == "" && audioMeta != nil {
+		artist = audioMeta.Artist
 	}
 
-	var genreID interface{} = nil
-	if req.GenreID != nil && *req.GenreID != "" {
-		parsed, err := uuid.Parse(*req.GenreID)
-		if err != nil {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid genre ID format"})
-			return
-		}
-		genreID = parsed
-	} else if currentGenreID.Valid {
+	genreID := reqGenreID
+	if genreID == nil && currentGenreID.Valid {
 		genreID = currentGenreID.String
 	}
 
-	var releaseYear interface{} = nil
-	if req.ReleaseYear != nil && *req.ReleaseYear != "" {
-		year, err := strconv.Atoi(*req.ReleaseYear)
-		if err != nil {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid release year format"})
-			return
+	releaseYear := reqReleaseYear
+	if releaseYear == nil {
+		if currentReleaseYear.Valid {
+			releaseYear = currentReleaseYear.Int32
+		} else if audioMeta != nil && audioMeta.Year > 0 {
+			releaseYear = audioMeta.Year
 		}
-		releaseYear = year
-	} else if currentReleaseYear.Valid {
-		releaseYear = currentReleaseYear.Int32
 	}
 
 	// Mengelola file audio
 	var audioFilePath interface{} = nil
-	if req.AudioFile != nil {
-		// Upload file audio baru
-		path, err := c.StorageConfig.UploadSongAudio(req.AudioFile)
-		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to upload audio file: %v", err)})
-			return
-		}
-		audioFilePath = path
-
-		// Menghapus file audio lama jika ada
-		if currentAudioFilePath.Valid && currentAudioFilePath.String != "" {
-			c.safeDeleteFile(currentAudioFilePath.String, "audio")
-		}
+	if newAudioPath != "" {
+		audioFilePath = newAudioPath
 	} else if currentAudioFilePath.Valid {
 		audioFilePath = currentAudioFilePath.String
 	}
 
-	// Mengelola file gambar
+	// Mengelola file gambar. Cover art dari file audio tidak dipakai jika
+	// gambar sudah diisi request lain selama upload berjalan.
 	var imagePath interface{} = nil
-	if req.ImageFile != nil {
-		// Upload file gambar baru
-		path, err := c.StorageConfig.UploadSongImage(req.ImageFile)
-		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to upload image file: %v", err)})
-			return
-		}
-		imagePath = path
-
-		// Menghapus file gambar lama jika ada
-		if currentImagePath.Valid && currentImagePath.String != "" {
-			c.safeDeleteFile(currentImagePath.String, "image")
+	imageVariants := decodeImageVariants(currentImageVariants)
+	var unused []string
+	if req.ImageFile != nil || (newImagePath != "" && !currentImagePath.Valid) {
+		imagePath = newImagePath
+		imageVariants = newImageVariants
+	} else {
+		if currentImagePath.Valid {
+			imagePath = currentImagePath.String
 		}
-	} else if currentImagePath.Valid {
-		imagePath = currentImagePath.String
+		unused = embeddedCover
 	}
 
 	// Menerapkan perubahan ke database
-	query := `
+	query := songMutationQuery(`
 		UPDATE songs
 		SET 
 			title = $1,
@@ -651,18 +1306,21 @@ func (c *SongController) UpdateSongWithFiles(ctx *gin.Context) {
 			genre_id = $3,
 			release_year = $4,
 			audio_file_path = $5,
-			image_path = $6
+			image_path = $6,
+			image_variants = $14,
+			duration_seconds = CASE WHEN $8 THEN $9 ELSE duration_seconds END,
+			bitrate = CASE WHEN $8 THEN $10 ELSE bitrate END,
+			sample_rate = CASE WHEN $8 THEN $11 ELSE sample_rate END,
+			codec = CASE WHEN $8 THEN $12 ELSE codec END,
+			waveform_peaks = CASE WHEN $8 THEN $13 ELSE waveform_peaks END,
+			lyrics = CASE WHEN $15::text IS NULL THEN lyrics ELSE NULLIF($15, '') END,
+			lyrics_lrc = CASE WHEN $16::text IS NULL THEN lyrics_lrc ELSE NULLIF($16, '') END,
+			updated_at = NOW()
 		WHERE song_id = $7
-		RETURNING song_id, title, artist, genre_id, release_year, audio_file_path, image_path
-	`
-
-	var song models.SongResponse
-	var updatedGenreID sql.NullString
-	var updatedReleaseYear sql.NullInt32
-	var updatedAudioFilePath sql.NullString
-	var updatedImagePath sql.NullString
+		RETURNING *
+	`)
 
-	err = c.DB.QueryRow(
+	song, err := scanSong(tx.QueryRow(
 		query,
 		title,
 		artist,
@@ -671,44 +1329,35 @@ func (c *SongController) UpdateSongWithFiles(ctx *gin.Context) {
 		audioFilePath,
 		imagePath,
 		id,
-	).Scan(
-		&song.SongID,
-		&song.Title,
-		&song.Artist,
-		&updatedGenreID,
-		&updatedReleaseYear,
-		&updatedAudioFilePath,
-		&updatedImagePath,
-	)
+		req.AudioFile != nil,
+		duration,
+		bitrate,
+		sampleRate,
+		codec,
+		pq.Array(peaks),
+		encodeImageVariants(imageVariants),
+		lyrics.Plain,
+		lyrics.LRC,
+	))
 
 	if err != nil {
-		// Rollback jika gagal update database
-		if audioFilePath != nil && audioFilePath != currentAudioFilePath.String {
-			c.safeDeleteFile(audioFilePath.(string), "audio")
-		}
-		if imagePath != nil && imagePath != currentImagePath.String {
-			c.safeDeleteFile(imagePath.(string), "image")
-		}
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
 		return
 	}
 
-	if updatedGenreID.Valid {
-		parsedID, err := uuid.Parse(updatedGenreID.String)
-		if err == nil {
-			song.GenreID = &parsedID
-		}
-	}
-	if updatedReleaseYear.Valid {
-		year := int(updatedReleaseYear.Int32)
-		song.ReleaseYear = &year
-	}
-	if updatedAudioFilePath.Valid {
-		song.AudioFilePath = &updatedAudioFilePath.String
+	// File lama baru dihapus setelah commit berhasil
+	replaced := replacedSongFiles(currentAudioFilePath, currentImagePath, currentImageVariants, audioFilePath, imagePath)
+	if err := c.Outbox.Enqueue(tx, append(replaced, unused...)...); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
 	}
-	if updatedImagePath.Valid {
-		song.ImagePath = &updatedImagePath.String
+
+	if err := tx.Commit(); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
 	}
+	uploaded = nil
+	c.Outbox.Notify()
 
 	ctx.JSON(http.StatusOK, song)
 }
@@ -722,14 +1371,22 @@ func (c *SongController) DeleteSong(ctx *gin.Context) {
 		return
 	}
 
-	// Ambil jalur file terlebih dahulu untuk menghapus file dari storage
+	tx, err := c.DB.Begin()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	defer tx.Rollback()
+
+	// Hapus lagu dari database dan ambil jalur file untuk dihapus dari storage
 	var audioFilePath sql.NullString
 	var imagePath sql.NullString
+	var imageVariants []byte
 
-	err = c.DB.QueryRow(
-		"SELECT audio_file_path, image_path FROM songs WHERE song_id = $1",
+	err = tx.QueryRow(
+		"DELETE FROM songs WHERE song_id = $1 RETURNING audio_file_path, image_path, image_variants",
 		id,
-	).Scan(&audioFilePath, &imagePath)
+	).Scan(&audioFilePath, &imagePath, &imageVariants)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -740,32 +1397,17 @@ func (c *SongController) DeleteSong(ctx *gin.Context) {
 		return
 	}
 
-	// Hapus lagu dari database
-	result, err := c.DB.Exec("DELETE FROM songs WHERE song_id = $1", id)
-	if err != nil {
+	// File dihapus dari storage setelah commit
+	if err := c.Outbox.Enqueue(tx, replacedSongFiles(audioFilePath, imagePath, imageVariants, nil, nil)...); err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
 		return
 	}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
+	if err := tx.Commit(); err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
 		return
 	}
-
-	if rowsAffected == 0 {
-		ctx.JSON(http.StatusNotFound, gin.H{"error": "Song not found"})
-		return
-	}
-
-	// Hapus file dari storage dengan safe deletion
-	if audioFilePath.Valid {
-		c.safeDeleteFile(audioFilePath.String, "audio")
-	}
-
-	if imagePath.Valid {
-		c.safeDeleteFile(imagePath.String, "image")
-	}
+	c.Outbox.Notify()
 
 	ctx.Status(http.StatusNoContent)
 }
@@ -0,0 +1,579 @@
+package controllers
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"image/png"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"golang.org/x/crypto/bcrypt"
+
+	"backend-turningjane/utils"
+)
+
+const (
+	// pendingAdminKey dan pendingAdminExpiresKey menyimpan admin yang sudah
+	// lolos password tetapi belum memasukkan kode 2FA
+	pendingAdminKey        = "pending_admin_id"
+	pendingAdminExpiresKey = "pending_admin_expires"
+	// pendingAdminTTL adalah batas waktu untuk memasukkan kode 2FA setelah login
+	pendingAdminTTL = 5 * time.Minute
+	// recoveryCodeCount adalah jumlah recovery code yang dibuat sekaligus
+	recoveryCodeCount = 10
+	// twoFactorAttemptLimit adalah jumlah percobaan kode per admin setiap 5 menit
+	twoFactorAttemptLimit = 5
+	// twoFactorQRSize adalah ukuran gambar QR code dalam pixel
+	twoFactorQRSize = 256
+)
+
+type TwoFactorController struct {
+	DB *sql.DB
+
+	attempts *utils.RateLimiter
+}
+
+func NewTwoFactorController(db *sql.DB) *TwoFactorController {
+	return &TwoFactorController{
+		DB:       db,
+		attempts: utils.NewRateLimiter(twoFactorAttemptLimit, 5*time.Minute),
+	}
+}
+
+// TwoFactorCodeRequest berisi kode 6 digit dari aplikasi authenticator atau
+// salah satu recovery code
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// DisableTwoFactorRequest for turning two-factor authentication off
+type DisableTwoFactorRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// Helper function to reject a request after too many wrong codes with 429
+func (c *TwoFactorController) tooManyAttempts(ctx *gin.Context, adminID uuid.UUID) bool {
+	allowed, retryAfter := c.attempts.Allow(adminID.String())
+	if allowed {
+		return false
+	}
+
+	ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	ctx.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many two-factor attempts, try again later"})
+	return true
+}
+
+// Helper function to check a TOTP code or an unused recovery code of an admin
+// locked by the caller. A TOTP code is only accepted once, a recovery code is
+// marked as used.
+func verifySecondFactor(tx *sql.Tx, adminID uuid.UUID, secret string, lastStep sql.NullInt64, code string) (bool, error) {
+	if step, ok := utils.TOTPStep(secret, code, time.Now()); ok {
+		if lastStep.Valid && step <= lastStep.Int64 {
+			return false, nil
+		}
+		_, err := tx.Exec("UPDATE admins SET totp_last_step = $1 WHERE id = $2", step, adminID)
+		return err == nil, err
+	}
+
+	// Hash bcrypt memakai salt, jadi code dibandingkan dengan setiap recovery
+	// code yang belum dipakai
+	rows, err := tx.Query(
+		"SELECT code_hash FROM admin_recovery_codes WHERE admin_id = $1 AND used_at IS NULL",
+		adminID,
+	)
+	if err != nil {
+		return false, err
+	}
+	var hashes []string
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			rows.Close()
+			return false, err
+		}
+		hashes = append(hashes, hash)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return false, err
+	}
+
+	for _, hash := range hashes {
+		if utils.RecoveryCodeMatches(hash, code) {
+			_, err := tx.Exec(
+				"UPDATE admin_recovery_codes SET used_at = NOW() WHERE admin_id = $1 AND code_hash = $2",
+				adminID, hash,
+			)
+			return err == nil, err
+		}
+	}
+	return false, nil
+}
+
+// Helper function to replace the recovery codes of an admin. The codes are
+// returned in plain text once, only their bcrypt hashes are stored.
+func replaceRecoveryCodes(tx *sql.Tx, adminID uuid.UUID) ([]string, error) {
+	codes, err := utils.NewRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make([]string, 0, len(codes))
+	for _, code := range codes {
+		hash, err := utils.HashRecoveryCode(code)
+		if err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+	}
+
+	if _, err := tx.Exec("DELETE FROM admin_recovery_codes WHERE admin_id = $1", adminID); err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO admin_recovery_codes (admin_id, code_hash)
+		SELECT $1, unnest($2::text[])
+	`, adminID, pq.Array(hashes))
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Helper function to lock an admin row and read its 2FA state
+func lockTwoFactorAdmin(ctx *gin.Context, tx *sql.Tx, adminID uuid.UUID) (string, sql.NullString, sql.NullInt64, bool) {
+	var email string
+	var secret sql.NullString
+	var lastStep sql.NullInt64
+	err := tx.QueryRow(
+		"SELECT email, totp_secret, totp_last_step FROM admins WHERE id = $1 FOR UPDATE",
+		adminID,
+	).Scan(&email, &secret, &lastStep)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Admin not found"})
+		} else {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		}
+		return "", secret, lastStep, false
+	}
+	return email, secret, lastStep, true
+}
+
+// VerifyAdminLogin adalah langkah kedua login admin yang memakai 2FA. Session
+// baru mendapat user_type admin setelah kode TOTP atau recovery code benar.
+func (c *TwoFactorController) VerifyAdminLogin(ctx *gin.Context) {
+	var req TwoFactorCodeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid request: %v", err)})
+		return
+	}
+
+	session := sessions.Default(ctx)
+	pendingID, _ := session.Get(pendingAdminKey).(string)
+	expires, _ := session.Get(pendingAdminExpiresKey).(int64)
+	adminID, err := uuid.Parse(pendingID)
+	if err != nil || time.Now().Unix() > expires {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Login again to continue"})
+		return
+	}
+
+	if c.tooManyAttempts(ctx, adminID) {
+		return
+	}
+
+	tx, err := c.DB.Begin()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	defer tx.Rollback()
+
+	email, secret, lastStep, ok := lockTwoFactorAdmin(ctx, tx, adminID)
+	if !ok {
+		return
+	}
+	if !secret.Valid {
+		// 2FA dimatikan setelah langkah pertama login
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Login again to continue"})
+		return
+	}
+
+	valid, err := verifySecondFactor(tx, adminID, secret.String, lastStep, req.Code)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	if !valid {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid two-factor code"})
+		return
+	}
+
+	var role string
+	if err := tx.QueryRow("SELECT role FROM admins WHERE id = $1", adminID).Scan(&role); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	session.Delete(pendingAdminKey)
+	session.Delete(pendingAdminExpiresKey)
+	session.Set("user_id", adminID.String())
+	session.Set("user_type", "admin")
+	if err := session.Save(); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "Admin login successful",
+		"admin": Admin{
+			ID:    adminID,
+			Email: email,
+			Role:  role,
+		},
+		"permissions": RolePermissions(role),
+	})
+}
+
+// TwoFactorStatus menampilkan status 2FA admin yang sedang login
+func (c *TwoFactorController) TwoFactorStatus(ctx *gin.Context) {
+	adminID, ok := sessionAdminID(ctx)
+	if !ok {
+		return
+	}
+
+	var enabledAt sql.NullTime
+	var pending bool
+	var remaining int
+	err := c.DB.QueryRow(`
+		SELECT a.totp_enabled_at, a.totp_pending_secret IS NOT NULL,
+			(SELECT COUNT(*) FROM admin_recovery_codes r WHERE r.admin_id = a.id AND r.used_at IS NULL)
+		FROM admins a
+		WHERE a.id = $1
+	`, adminID).Scan(&enabledAt, &pending, &remaining)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Admin not found"})
+		} else {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		}
+		return
+	}
+
+	response := gin.H{
+		"enabled":                  enabledAt.Valid,
+		"pending_setup":            pending,
+		"recovery_codes_remaining": remaining,
+	}
+	if enabledAt.Valid {
+		response["enabled_at"] = enabledAt.Time
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// SetupTwoFactor membuat secret TOTP baru yang belum aktif sampai dikonfirmasi
+// dengan kode dari aplikasi authenticator
+func (c *TwoFactorController) SetupTwoFactor(ctx *gin.Context) {
+	adminID, ok := sessionAdminID(ctx)
+	if !ok {
+		return
+	}
+
+	tx, err := c.DB.Begin()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	defer tx.Rollback()
+
+	email, secret, _, ok := lockTwoFactorAdmin(ctx, tx, adminID)
+	if !ok {
+		return
+	}
+	if secret.Valid {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	key, err := utils.NewTOTPKey(email)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to generate secret: %v", err)})
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE admins SET totp_pending_secret = $1 WHERE id = $2", key.Secret(), adminID); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"secret":      key.Secret(),
+		"otpauth_url": key.URL(),
+		"qr_code_url": "/api/admin/2fa/qr.png",
+	})
+}
+
+// TwoFactorQRCode menyajikan QR code PNG dari secret yang sedang disiapkan
+func (c *TwoFactorController) TwoFactorQRCode(ctx *gin.Context) {
+	adminID, ok := sessionAdminID(ctx)
+	if !ok {
+		return
+	}
+
+	var email string
+	var pendingSecret sql.NullString
+	err := c.DB.QueryRow(
+		"SELECT email, totp_pending_secret FROM admins WHERE id = $1",
+		adminID,
+	).Scan(&email, &pendingSecret)
+	if err != nil && err != sql.ErrNoRows {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	if !pendingSecret.Valid {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "No two-factor setup in progress"})
+		return
+	}
+
+	key, err := utils.TOTPKey(pendingSecret.String, email)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to load secret: %v", err)})
+		return
+	}
+	img, err := key.Image(twoFactorQRSize, twoFactorQRSize)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to render QR code: %v", err)})
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to render QR code: %v", err)})
+		return
+	}
+
+	// QR code berisi secret, jangan disimpan di cache browser atau proxy
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Data(http.StatusOK, "image/png", buf.Bytes())
+}
+
+// ConfirmTwoFactor mengaktifkan 2FA setelah kode dari secret baru benar dan
+// mengembalikan recovery code yang hanya ditampilkan sekali
+func (c *TwoFactorController) ConfirmTwoFactor(ctx *gin.Context) {
+	adminID, ok := sessionAdminID(ctx)
+	if !ok {
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid request: %v", err)})
+		return
+	}
+
+	if c.tooManyAttempts(ctx, adminID) {
+		return
+	}
+
+	tx, err := c.DB.Begin()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	defer tx.Rollback()
+
+	var pendingSecret sql.NullString
+	err = tx.QueryRow("SELECT totp_pending_secret FROM admins WHERE id = $1 FOR UPDATE", adminID).Scan(&pendingSecret)
+	if err != nil && err != sql.ErrNoRows {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	if !pendingSecret.Valid {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "No two-factor setup in progress"})
+		return
+	}
+
+	step, valid := utils.TOTPStep(pendingSecret.String, req.Code, time.Now())
+	if !valid {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid two-factor code"})
+		return
+	}
+
+	_, err = tx.Exec(`
+		UPDATE admins
+		SET totp_secret = totp_pending_secret, totp_pending_secret = NULL,
+			totp_enabled_at = NOW(), totp_last_step = $1
+		WHERE id = $2
+	`, step, adminID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	codes, err := replaceRecoveryCodes(tx, adminID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to create recovery codes: %v", err)})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// RegenerateRecoveryCodes mengganti semua recovery code, code lama tidak
+// berlaku lagi
+func (c *TwoFactorController) RegenerateRecoveryCodes(ctx *gin.Context) {
+	adminID, ok := sessionAdminID(ctx)
+	if !ok {
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid request: %v", err)})
+		return
+	}
+
+	if c.tooManyAttempts(ctx, adminID) {
+		return
+	}
+
+	tx, err := c.DB.Begin()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	defer tx.Rollback()
+
+	_, secret, lastStep, ok := lockTwoFactorAdmin(ctx, tx, adminID)
+	if !ok {
+		return
+	}
+	if !secret.Valid {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+
+	valid, err := verifySecondFactor(tx, adminID, secret.String, lastStep, req.Code)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	if !valid {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid two-factor code"})
+		return
+	}
+
+	codes, err := replaceRecoveryCodes(tx, adminID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to create recovery codes: %v", err)})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// DisableTwoFactor mematikan 2FA, membutuhkan password dan kode 2FA
+func (c *TwoFactorController) DisableTwoFactor(ctx *gin.Context) {
+	adminID, ok := sessionAdminID(ctx)
+	if !ok {
+		return
+	}
+
+	var req DisableTwoFactorRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid request: %v", err)})
+		return
+	}
+
+	if c.tooManyAttempts(ctx, adminID) {
+		return
+	}
+
+	tx, err := c.DB.Begin()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	defer tx.Rollback()
+
+	_, secret, lastStep, ok := lockTwoFactorAdmin(ctx, tx, adminID)
+	if !ok {
+		return
+	}
+	if !secret.Valid {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+
+	var password string
+	if err := tx.QueryRow("SELECT password FROM admins WHERE id = $1", adminID).Scan(&password); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	if bcrypt.CompareHashAndPassword([]byte(password), []byte(req.Password)) != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+
+	valid, err := verifySecondFactor(tx, adminID, secret.String, lastStep, req.Code)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	if !valid {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid two-factor code"})
+		return
+	}
+
+	_, err = tx.Exec(`
+		UPDATE admins
+		SET totp_secret = NULL, totp_pending_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL
+		WHERE id = $1
+	`, adminID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM admin_recovery_codes WHERE admin_id = $1", adminID); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
@@ -2,23 +2,56 @@ package controllers
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"log"
+	"math"
 	"math/rand"
 	"net/http"
+	"os"
+	"strconv"
 	"time"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
+
+	"backend-turningjane/utils"
+)
+
+const (
+	// emailVerificationTTL adalah masa berlaku link verifikasi email
+	emailVerificationTTL = 48 * time.Hour
+	// verificationResendLimit adalah jumlah kirim ulang verifikasi per jam untuk satu user
+	verificationResendLimit = 3
 )
 
+// errVerifyURLNotConfigured: tanpa URL yang dikonfigurasi email verifikasi
+// tidak dikirim, link tidak pernah dibangun dari header Host request
+var errVerifyURLNotConfigured = errors.New("EMAIL_VERIFY_URL and SITE_URL are not set")
+
 type UserController struct {
-	DB *sql.DB
+	DB     *sql.DB
+	Mailer utils.Mailer
+	// VerifyURL adalah halaman verifikasi email, kosong jika belum dikonfigurasi
+	VerifyURL string
+
+	resendLimiter *utils.RateLimiter
 }
 
-func NewUserController(db *sql.DB) *UserController {
-	return &UserController{DB: db}
+func NewUserController(db *sql.DB, mailer utils.Mailer) *UserController {
+	verifyURL := emailVerifyURL()
+	if verifyURL == "" {
+		log.Printf("ERROR: %v, verification emails are disabled", errVerifyURLNotConfigured)
+	}
+
+	return &UserController{
+		DB:            db,
+		Mailer:        mailer,
+		VerifyURL:     verifyURL,
+		resendLimiter: utils.NewRateLimiter(verificationResendLimit, time.Hour),
+	}
 }
 
 // RegisterRequest for user registration
@@ -39,6 +72,118 @@ type User struct {
 	ID       uuid.UUID `json:"id"`
 	Email    string    `json:"email"`
 	Username string    `json:"username"`
+	Verified bool      `json:"verified"`
+}
+
+// sessionUserID returns the ID of the logged in user set by AuthRequired.
+// Admin sessions are rejected because their IDs belong to the admins table.
+func sessionUserID(c *gin.Context) (uuid.UUID, bool) {
+	if userType, _ := c.Get("user_type"); userType != "user" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "User account required"})
+		return uuid.Nil, false
+	}
+
+	userIDStr, _ := c.Get("user_id")
+	value, _ := userIDStr.(string)
+	userID, err := uuid.Parse(value)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+// resetVerification clears verified_at when an UPDATE changes the email in $1
+const resetVerification = "verified_at = CASE WHEN email = $1 THEN verified_at END"
+
+// requireVerifiedUser blocks users whose email is not verified yet from
+// actions that need a real identity, such as publishing a playlist
+func requireVerifiedUser(c *gin.Context, db *sql.DB, userID uuid.UUID) bool {
+	var verified bool
+	err := db.QueryRow("SELECT verified_at IS NOT NULL FROM users WHERE id = $1", userID).Scan(&verified)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		}
+		return false
+	}
+	if !verified {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Email verification required"})
+		return false
+	}
+	return true
+}
+
+// Helper function to pick the page the verification email links to. It is
+// EMAIL_VERIFY_URL, or /verify-email on SITE_URL, or empty when neither is set.
+func emailVerifyURL() string {
+	if base := os.Getenv("EMAIL_VERIFY_URL"); base != "" {
+		return base
+	}
+	if site := configuredSiteURL(); site != "" {
+		return site + "/verify-email"
+	}
+	return ""
+}
+
+// sendVerification creates a verification token for the email of the user
+// and sends the verification link. Older tokens of the user stop working.
+func (uc *UserController) sendVerification(userID uuid.UUID, email string) error {
+	if uc.VerifyURL == "" {
+		return errVerifyURLNotConfigured
+	}
+
+	token, tokenHash, err := utils.NewToken()
+	if err != nil {
+		return err
+	}
+
+	tx, err := uc.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		"DELETE FROM email_verification_tokens WHERE user_id = $1 OR expires_at < NOW()",
+		userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO email_verification_tokens (token_hash, user_id, email, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`, tokenHash, userID, email, time.Now().Add(emailVerificationTTL))
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	msg := utils.Message{
+		To:      email,
+		Subject: "Verifikasi email Turning Jane",
+		Body: fmt.Sprintf(
+			"Terima kasih sudah mendaftar di Turning Jane.\n\n"+
+				"Buka link berikut untuk memverifikasi email %s:\n%s\n\n"+
+				"Link ini berlaku selama %s. Abaikan email ini jika kamu tidak mendaftar.\n",
+			email, tokenLink(uc.VerifyURL, token), formatTTL(emailVerificationTTL),
+		),
+	}
+
+	// Email dikirim di background agar respons tidak menunggu server SMTP
+	go func() {
+		if err := uc.Mailer.Send(msg); err != nil {
+			log.Printf("Failed to send verification email to %s: %v", msg.To, err)
+		}
+	}()
+	return nil
 }
 
 // generateRandomUsername generates a random username with numbers
@@ -127,8 +272,13 @@ func (uc *UserController) Register(c *gin.Context) {
 		return
 	}
 
+	// Akun tetap dibuat jika email gagal, user bisa meminta kirim ulang
+	if err := uc.sendVerification(userID, req.Email); err != nil {
+		log.Printf("Failed to create verification token for %s: %v", req.Email, err)
+	}
+
 	c.JSON(http.StatusCreated, gin.H{
-		"message": "User registered successfully",
+		"message": "User registered successfully, check your email to verify your account",
 		"user": User{
 			ID:       userID,
 			Email:    req.Email,
@@ -151,12 +301,13 @@ func (uc *UserController) Login(c *gin.Context) {
 		Email    string
 		Username string
 		Password string
+		Verified bool
 	}
 
 	err := uc.DB.QueryRow(
-		"SELECT id, email, username, password FROM users WHERE email = $1",
+		"SELECT id, email, username, password, verified_at IS NOT NULL FROM users WHERE email = $1",
 		req.Email,
-	).Scan(&user.ID, &user.Email, &user.Username, &user.Password)
+	).Scan(&user.ID, &user.Email, &user.Username, &user.Password, &user.Verified)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -189,6 +340,7 @@ func (uc *UserController) Login(c *gin.Context) {
 			ID:       user.ID,
 			Email:    user.Email,
 			Username: user.Username,
+			Verified: user.Verified,
 		},
 	})
 }
@@ -209,9 +361,9 @@ func (uc *UserController) GetProfile(c *gin.Context) {
 
 	var user User
 	err = uc.DB.QueryRow(
-		"SELECT id, email, username FROM users WHERE id = $1",
+		"SELECT id, email, username, verified_at IS NOT NULL FROM users WHERE id = $1",
 		userID,
-	).Scan(&user.ID, &user.Email, &user.Username)
+	).Scan(&user.ID, &user.Email, &user.Username, &user.Verified)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -227,7 +379,7 @@ func (uc *UserController) GetProfile(c *gin.Context) {
 
 // ListUsers returns all users (for admin use)
 func (uc *UserController) ListUsers(c *gin.Context) {
-	rows, err := uc.DB.Query("SELECT id, email, username FROM users ORDER BY email ASC")
+	rows, err := uc.DB.Query("SELECT id, email, username, verified_at IS NOT NULL FROM users ORDER BY email ASC")
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
@@ -237,7 +389,7 @@ func (uc *UserController) ListUsers(c *gin.Context) {
 	var users []User
 	for rows.Next() {
 		var user User
-		if err := rows.Scan(&user.ID, &user.Email, &user.Username); err != nil {
+		if err := rows.Scan(&user.ID, &user.Email, &user.Username, &user.Verified); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Scan error"})
 			return
 		}
@@ -257,9 +409,10 @@ func (uc *UserController) UpdateUser(c *gin.Context) {
 	}
 
 	var req struct {
-		Email    string `json:"email" binding:"required,email"`
-		Username string `json:"username,omitempty"`
-		Password string `json:"password,omitempty"`
+		Email           string `json:"email" binding:"required,email"`
+		Username        string `json:"username,omitempty"`
+		Password        string `json:"password,omitempty"`
+		CurrentPassword string `json:"current_password,omitempty"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -267,6 +420,31 @@ func (uc *UserController) UpdateUser(c *gin.Context) {
 		return
 	}
 
+	// Email lama dibutuhkan untuk mengetahui apakah email harus diverifikasi ulang
+	var currentEmail, currentPassword string
+	err = uc.DB.QueryRow("SELECT email, password FROM users WHERE id = $1", id).Scan(&currentEmail, &currentPassword)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	// User yang mengganti password sendiri harus memasukkan password lama.
+	// Admin lewat /api/admin/users tidak membutuhkannya.
+	if req.Password != "" && c.GetString("user_type") == "user" {
+		if req.CurrentPassword == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Current password is required to change the password"})
+			return
+		}
+		if bcrypt.CompareHashAndPassword([]byte(currentPassword), []byte(req.CurrentPassword)) != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+			return
+		}
+	}
+
 	// Check if email already exists (excluding current user)
 	var exists bool
 	err = uc.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE email = $1 AND id != $2)", req.Email, id).Scan(&exists)
@@ -304,9 +482,9 @@ func (uc *UserController) UpdateUser(c *gin.Context) {
 		}
 
 		if req.Username != "" {
-			_, err = uc.DB.Exec("UPDATE users SET email = $1, username = $2, password = $3 WHERE id = $4", req.Email, req.Username, string(hashedPassword), id)
+			_, err = uc.DB.Exec("UPDATE users SET email = $1, username = $2, password = $3, "+resetVerification+" WHERE id = $4", req.Email, req.Username, string(hashedPassword), id)
 		} else {
-			_, err = uc.DB.Exec("UPDATE users SET email = $1, password = $2 WHERE id = $3", req.Email, string(hashedPassword), id)
+			_, err = uc.DB.Exec("UPDATE users SET email = $1, password = $2, "+resetVerification+" WHERE id = $3", req.Email, string(hashedPassword), id)
 		}
 
 		if err != nil {
@@ -316,9 +494,9 @@ func (uc *UserController) UpdateUser(c *gin.Context) {
 	} else {
 		// Update without password
 		if req.Username != "" {
-			_, err = uc.DB.Exec("UPDATE users SET email = $1, username = $2 WHERE id = $3", req.Email, req.Username, id)
+			_, err = uc.DB.Exec("UPDATE users SET email = $1, username = $2, "+resetVerification+" WHERE id = $3", req.Email, req.Username, id)
 		} else {
-			_, err = uc.DB.Exec("UPDATE users SET email = $1 WHERE id = $2", req.Email, id)
+			_, err = uc.DB.Exec("UPDATE users SET email = $1, "+resetVerification+" WHERE id = $2", req.Email, id)
 		}
 
 		if err != nil {
@@ -327,9 +505,114 @@ func (uc *UserController) UpdateUser(c *gin.Context) {
 		}
 	}
 
+	// Email baru harus diverifikasi ulang
+	if req.Email != currentEmail {
+		if err := uc.sendVerification(id, req.Email); err != nil {
+			log.Printf("Failed to create verification token for %s: %v", req.Email, err)
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "User updated successfully"})
 }
 
+// VerifyEmail memverifikasi email user dengan token dari email verifikasi
+func (uc *UserController) VerifyEmail(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token is required"})
+		return
+	}
+
+	tx, err := uc.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	defer tx.Rollback()
+
+	var userID uuid.UUID
+	var email string
+	err = tx.QueryRow(`
+		DELETE FROM email_verification_tokens
+		WHERE token_hash = $1 AND expires_at > NOW()
+		RETURNING user_id, email
+	`, utils.HashToken(token)).Scan(&userID, &email)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification token"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		}
+		return
+	}
+
+	// Token hanya berlaku untuk email saat token dibuat
+	result, err := tx.Exec(
+		"UPDATE users SET verified_at = COALESCE(verified_at, NOW()) WHERE id = $1 AND email = $2",
+		userID, email,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification token"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully"})
+}
+
+// ResendVerification mengirim ulang email verifikasi ke user yang sedang login
+func (uc *UserController) ResendVerification(c *gin.Context) {
+	userID, ok := sessionUserID(c)
+	if !ok {
+		return
+	}
+
+	var email string
+	var verified bool
+	err := uc.DB.QueryRow(
+		"SELECT email, verified_at IS NOT NULL FROM users WHERE id = $1",
+		userID,
+	).Scan(&email, &verified)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Database error: %v", err)})
+		}
+		return
+	}
+	if verified {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email is already verified"})
+		return
+	}
+
+	if allowed, retryAfter := uc.resendLimiter.Allow(userID.String()); !allowed {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many verification emails, try again later"})
+		return
+	}
+
+	err = uc.sendVerification(userID, email)
+	if err == errVerifyURLNotConfigured {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Email verification is not available"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to send verification email: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Verification email sent"})
+}
+
 // DeleteUser deletes a user
 func (uc *UserController) DeleteUser(c *gin.Context) {
 	userID := c.Param("id")
@@ -359,6 +642,16 @@ func (uc *UserController) DeleteUser(c *gin.Context) {
 		return
 	}
 
+	// User yang menghapus akunnya sendiri langsung logout
+	if c.GetString("user_type") == "user" {
+		session := sessions.Default(c)
+		session.Clear()
+		if err := session.Save(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to logout"})
+			return
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
 }
 
@@ -2,6 +2,7 @@ package main
 
 import (
 	"database/sql"
+	"flag"
 	"fmt"
 	"log"
 	"os"
@@ -11,8 +12,12 @@ import (
 	_ "github.com/lib/pq"
 
 	"backend-turningjane/routes"
+	"backend-turningjane/utils"
 )
 
+// minSessionSecretLength adalah panjang minimum SESSION_SECRET
+const minSessionSecretLength = 32
+
 func main() {
 	// Load variabel lingkungan
 	err := godotenv.Load()
@@ -56,11 +61,412 @@ func main() {
 		log.Fatalf("Gagal membuat tabel users: %v", err)
 	}
 
+	// Pastikan kolom metadata audio pada tabel songs ada
+	_, err = db.Exec(`
+		ALTER TABLE songs
+			ADD COLUMN IF NOT EXISTS duration_seconds DOUBLE PRECISION,
+			ADD COLUMN IF NOT EXISTS bitrate INTEGER,
+			ADD COLUMN IF NOT EXISTS sample_rate INTEGER,
+			ADD COLUMN IF NOT EXISTS codec TEXT,
+			ADD COLUMN IF NOT EXISTS waveform_peaks REAL[]
+	`)
+	if err != nil {
+		log.Fatalf("Gagal menambah kolom metadata audio: %v", err)
+	}
+
+	// Pastikan kolom varian gambar pada tabel songs ada
+	_, err = db.Exec(`ALTER TABLE songs ADD COLUMN IF NOT EXISTS image_variants JSONB`)
+	if err != nil {
+		log.Fatalf("Gagal menambah kolom varian gambar: %v", err)
+	}
+
+	// Pastikan kolom created_at, updated_at dan indeks untuk urutan GET /songs ada
+	_, err = db.Exec(`
+		ALTER TABLE songs ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+		ALTER TABLE songs ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ;
+		UPDATE songs SET updated_at = created_at WHERE updated_at IS NULL;
+		ALTER TABLE songs ALTER COLUMN updated_at SET DEFAULT NOW(), ALTER COLUMN updated_at SET NOT NULL;
+		CREATE INDEX IF NOT EXISTS songs_created_at_idx ON songs (created_at, song_id);
+		CREATE INDEX IF NOT EXISTS songs_title_idx ON songs (title, song_id);
+		CREATE INDEX IF NOT EXISTS songs_release_year_idx ON songs ((COALESCE(release_year, 0)), song_id);
+	`)
+	if err != nil {
+		log.Fatalf("Gagal menyiapkan urutan lagu: %v", err)
+	}
+
+	// Pastikan tabel albums dan kolom tracklist pada tabel songs ada
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS albums (
+			album_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			title TEXT NOT NULL,
+			album_type TEXT NOT NULL CHECK (album_type IN ('single', 'ep', 'lp')),
+			release_date DATE,
+			cover_image_path TEXT,
+			cover_image_variants JSONB,
+			label TEXT,
+			upc TEXT UNIQUE,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		);
+		ALTER TABLE songs
+			ADD COLUMN IF NOT EXISTS album_id UUID REFERENCES albums (album_id) ON DELETE SET NULL,
+			ADD COLUMN IF NOT EXISTS disc_number INTEGER,
+			ADD COLUMN IF NOT EXISTS track_number INTEGER;
+		CREATE UNIQUE INDEX IF NOT EXISTS songs_album_track_idx ON songs (album_id, disc_number, track_number)
+			WHERE album_id IS NOT NULL;
+	`)
+	if err != nil {
+		log.Fatalf("Gagal membuat tabel albums: %v", err)
+	}
+
+	// Pastikan kolom lirik dan indeks pencarian ada
+	_, err = db.Exec(`
+		CREATE EXTENSION IF NOT EXISTS pg_trgm;
+		ALTER TABLE songs ADD COLUMN IF NOT EXISTS lyrics TEXT;
+		ALTER TABLE songs ADD COLUMN IF NOT EXISTS lyrics_lrc TEXT;
+		ALTER TABLE songs ADD COLUMN IF NOT EXISTS search_vector TSVECTOR GENERATED ALWAYS AS (
+			setweight(to_tsvector('simple', COALESCE(title, '')), 'A') ||
+			setweight(to_tsvector('simple', COALESCE(artist, '')), 'A') ||
+			setweight(to_tsvector('simple', regexp_replace(COALESCE(lyrics, ''), '\[[^]]*\]', ' ', 'g')), 'D')
+		) STORED;
+		CREATE INDEX IF NOT EXISTS songs_search_idx ON songs USING GIN (search_vector);
+		CREATE INDEX IF NOT EXISTS songs_title_trgm_idx ON songs USING GIN (title gin_trgm_ops);
+		CREATE INDEX IF NOT EXISTS songs_artist_trgm_idx ON songs USING GIN (artist gin_trgm_ops);
+		CREATE INDEX IF NOT EXISTS songs_genre_idx ON songs (genre_id);
+	`)
+	if err != nil {
+		log.Fatalf("Gagal menyiapkan pencarian lagu: %v", err)
+	}
+
+	// Pastikan tabel antrean penghapusan file storage ada
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS storage_deletions (
+			id BIGSERIAL PRIMARY KEY,
+			file_path TEXT NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			last_error TEXT,
+			next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)
+	`)
+	if err != nil {
+		log.Fatalf("Gagal membuat tabel storage_deletions: %v", err)
+	}
+
+	// Pastikan tabel favorit dan playlist user ada
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS favorites (
+			user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+			song_id UUID NOT NULL REFERENCES songs (song_id) ON DELETE CASCADE,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			PRIMARY KEY (user_id, song_id)
+		);
+		CREATE TABLE IF NOT EXISTS playlists (
+			playlist_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+			name TEXT NOT NULL,
+			description TEXT,
+			is_public BOOLEAN NOT NULL DEFAULT false,
+			share_slug TEXT UNIQUE,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS playlists_user_idx ON playlists (user_id);
+		CREATE TABLE IF NOT EXISTS playlist_songs (
+			playlist_id UUID NOT NULL REFERENCES playlists (playlist_id) ON DELETE CASCADE,
+			song_id UUID NOT NULL REFERENCES songs (song_id) ON DELETE CASCADE,
+			position INTEGER NOT NULL,
+			added_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			PRIMARY KEY (playlist_id, song_id)
+		);
+	`)
+	if err != nil {
+		log.Fatalf("Gagal membuat tabel playlists: %v", err)
+	}
+
+	// Pastikan tabel jadwal konser ada
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS events (
+			event_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			title TEXT NOT NULL,
+			venue TEXT NOT NULL,
+			city TEXT NOT NULL,
+			country TEXT,
+			starts_at TIMESTAMPTZ NOT NULL,
+			ends_at TIMESTAMPTZ,
+			time_zone TEXT NOT NULL,
+			ticket_url TEXT,
+			status TEXT NOT NULL DEFAULT 'announced' CHECK (status IN ('announced', 'sold_out', 'cancelled')),
+			description TEXT,
+			sequence INTEGER NOT NULL DEFAULT 0,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			CHECK (ends_at IS NULL OR ends_at > starts_at)
+		);
+		CREATE INDEX IF NOT EXISTS events_starts_at_idx ON events (starts_at);
+		CREATE TABLE IF NOT EXISTS event_setlist (
+			event_id UUID NOT NULL REFERENCES events (event_id) ON DELETE CASCADE,
+			position INTEGER NOT NULL,
+			song_id UUID NOT NULL REFERENCES songs (song_id) ON DELETE CASCADE,
+			PRIMARY KEY (event_id, position)
+		);
+	`)
+	if err != nil {
+		log.Fatalf("Gagal membuat tabel events: %v", err)
+	}
+
+	// Pastikan tabel berita/blog ada
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS posts (
+			post_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			title TEXT NOT NULL,
+			slug TEXT NOT NULL UNIQUE,
+			excerpt TEXT,
+			body_markdown TEXT NOT NULL,
+			body_html TEXT NOT NULL,
+			cover_image_path TEXT,
+			cover_image_variants JSONB,
+			author_id UUID REFERENCES admins (id) ON DELETE SET NULL,
+			tags TEXT[] NOT NULL DEFAULT '{}',
+			status TEXT NOT NULL DEFAULT 'draft' CHECK (status IN ('draft', 'scheduled', 'published')),
+			publish_at TIMESTAMPTZ,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			CHECK (status = 'draft' OR publish_at IS NOT NULL)
+		);
+		CREATE INDEX IF NOT EXISTS posts_published_idx ON posts (publish_at DESC, post_id DESC) WHERE status = 'published';
+		CREATE INDEX IF NOT EXISTS posts_scheduled_idx ON posts (publish_at) WHERE status = 'scheduled';
+		CREATE INDEX IF NOT EXISTS posts_tags_idx ON posts USING GIN (tags);
+	`)
+	if err != nil {
+		log.Fatalf("Gagal membuat tabel posts: %v", err)
+	}
+
+	// Pastikan tabel galeri foto ada
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS gallery_albums (
+			album_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			title TEXT NOT NULL,
+			slug TEXT NOT NULL UNIQUE,
+			description TEXT,
+			position INTEGER NOT NULL DEFAULT 0,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		);
+		CREATE TABLE IF NOT EXISTS gallery_photos (
+			photo_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			album_id UUID NOT NULL REFERENCES gallery_albums (album_id) ON DELETE CASCADE,
+			image_path TEXT NOT NULL,
+			image_variants JSONB,
+			caption TEXT,
+			photographer TEXT,
+			position INTEGER NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS gallery_photos_album_idx ON gallery_photos (album_id, position);
+		ALTER TABLE gallery_albums
+			ADD COLUMN IF NOT EXISTS cover_photo_id UUID REFERENCES gallery_photos (photo_id) ON DELETE SET NULL;
+	`)
+	if err != nil {
+		log.Fatalf("Gagal membuat tabel galeri: %v", err)
+	}
+
+	// Pastikan tabel token reset password ada
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS password_reset_tokens (
+			token_hash TEXT PRIMARY KEY,
+			account_type TEXT NOT NULL CHECK (account_type IN ('user', 'admin')),
+			account_id UUID NOT NULL,
+			expires_at TIMESTAMPTZ NOT NULL,
+			used_at TIMESTAMPTZ,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS password_reset_tokens_account_idx ON password_reset_tokens (account_type, account_id);
+	`)
+	if err != nil {
+		log.Fatalf("Gagal membuat tabel password_reset_tokens: %v", err)
+	}
+
+	// Pastikan kolom verifikasi email dan tabel token verifikasi ada. User yang
+	// sudah terdaftar sebelum kolom verified_at dibuat dianggap terverifikasi.
+	_, err = db.Exec(`
+		DO $$
+		BEGIN
+			IF NOT EXISTS (
+				SELECT 1 FROM information_schema.columns
+				WHERE table_schema = current_schema() AND table_name = 'users' AND column_name = 'verified_at'
+			) THEN
+				ALTER TABLE users ADD COLUMN verified_at TIMESTAMPTZ;
+				UPDATE users SET verified_at = NOW();
+			END IF;
+		END
+		$$;
+		CREATE TABLE IF NOT EXISTS email_verification_tokens (
+			token_hash TEXT PRIMARY KEY,
+			user_id UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+			email TEXT NOT NULL,
+			expires_at TIMESTAMPTZ NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS email_verification_tokens_user_idx ON email_verification_tokens (user_id);
+	`)
+	if err != nil {
+		log.Fatalf("Gagal menyiapkan verifikasi email: %v", err)
+	}
+
+	// Pastikan kolom TOTP admin dan tabel recovery code ada
+	_, err = db.Exec(`
+		ALTER TABLE admins
+			ADD COLUMN IF NOT EXISTS totp_secret TEXT,
+			ADD COLUMN IF NOT EXISTS totp_pending_secret TEXT,
+			ADD COLUMN IF NOT EXISTS totp_enabled_at TIMESTAMPTZ,
+			ADD COLUMN IF NOT EXISTS totp_last_step BIGINT;
+		CREATE TABLE IF NOT EXISTS admin_recovery_codes (
+			admin_id UUID NOT NULL REFERENCES admins (id) ON DELETE CASCADE,
+			code_hash TEXT NOT NULL,
+			used_at TIMESTAMPTZ,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			PRIMARY KEY (admin_id, code_hash)
+		);
+	`)
+	if err != nil {
+		log.Fatalf("Gagal menyiapkan 2FA admin: %v", err)
+	}
+
+	// Pastikan kolom role admin ada. Admin yang sudah terdaftar sebelum kolom
+	// role dibuat menjadi owner agar hak aksesnya tidak berkurang.
+	_, err = db.Exec(`
+		DO $$
+		BEGIN
+			IF NOT EXISTS (
+				SELECT 1 FROM information_schema.columns
+				WHERE table_schema = current_schema() AND table_name = 'admins' AND column_name = 'role'
+			) THEN
+				ALTER TABLE admins ADD COLUMN role TEXT NOT NULL DEFAULT 'editor'
+					CHECK (role IN ('owner', 'editor', 'viewer'));
+				UPDATE admins SET role = 'owner';
+			END IF;
+		END
+		$$;
+	`)
+	if err != nil {
+		log.Fatalf("Gagal menambah kolom role admin: %v", err)
+	}
+
+	// Pastikan tabel pemutaran lagu untuk statistik ada
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS song_plays (
+			id BIGSERIAL PRIMARY KEY,
+			song_id UUID NOT NULL REFERENCES songs (song_id) ON DELETE CASCADE,
+			fingerprint TEXT NOT NULL,
+			listened_seconds DOUBLE PRECISION NOT NULL DEFAULT 0,
+			completed BOOLEAN,
+			referrer TEXT,
+			dedup_bucket BIGINT NOT NULL,
+			played_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		);
+		CREATE INDEX IF NOT EXISTS song_plays_played_at_idx ON song_plays (played_at);
+		CREATE UNIQUE INDEX IF NOT EXISTS song_plays_dedup_key ON song_plays (song_id, fingerprint, dedup_bucket);
+		CREATE TABLE IF NOT EXISTS play_salts (
+			day DATE PRIMARY KEY,
+			salt BYTEA NOT NULL
+		);
+	`)
+	if err != nil {
+		log.Fatalf("Gagal membuat tabel song_plays: %v", err)
+	}
+
+	// Setup media storage (STORAGE_DRIVER=supabase|s3|local)
+	storage := utils.NewStorage()
+
+	// Jalankan perintah CLI jika ada, contoh: go run . gc-media -dry-run=false
+	if len(os.Args) > 1 {
+		runCommand(db, storage, os.Args[1], os.Args[2:])
+		return
+	}
+
+	// Jadwalkan pembersihan media yatim jika MEDIA_GC_INTERVAL diisi (contoh: 24h)
+	if interval := os.Getenv("MEDIA_GC_INTERVAL"); interval != "" {
+		every, err := time.ParseDuration(interval)
+		if err != nil {
+			log.Fatalf("MEDIA_GC_INTERVAL tidak valid: %v", err)
+		}
+		go utils.ScheduleMediaGC(db, storage, every, utils.MediaGCOptions{
+			DryRun: os.Getenv("MEDIA_GC_DELETE") != "true",
+			MinAge: mediaGCMinAge(),
+		})
+	}
+
+	// File lama dihapus dari storage setelah transaksi commit, gagal akan dicoba ulang
+	outbox := utils.NewDeletionOutbox(db, storage)
+	go outbox.Run(time.Minute)
+
+	// Berita berstatus scheduled diterbitkan saat publish_at tercapai
+	go utils.SchedulePostPublishing(db, 30*time.Second)
+
+	// Setup pengiriman email (MAIL_DRIVER=smtp|log)
+	mailer, err := utils.NewMailer()
+	if err != nil {
+		log.Fatalf("Gagal menyiapkan email: %v", err)
+	}
+
+	// Cookie session ditandatangani dengan SESSION_SECRET, server tidak
+	// berjalan tanpa secret yang cukup panjang
+	sessionSecret := os.Getenv("SESSION_SECRET")
+	if len(sessionSecret) < minSessionSecretLength {
+		log.Fatalf("SESSION_SECRET harus diisi minimal %d karakter (contoh: openssl rand -hex 32)", minSessionSecretLength)
+	}
+
 	// Setup router dengan koneksi database
-	router := routes.SetupRouter(db)
+	router := routes.SetupRouter(db, storage, outbox, mailer, []byte(sessionSecret))
 
 	// Jalankan server
 	addr := "127.0.0.1:3000"
 	fmt.Printf("Server berjalan di http://%s\n", addr)
 	router.Run(addr)
 }
+
+// runCommand menjalankan perintah CLI sebagai pengganti server
+func runCommand(db *sql.DB, storage utils.Storage, name string, args []string) {
+	switch name {
+	case "gc-media":
+		runMediaGC(db, storage, args)
+	default:
+		log.Fatalf("Perintah tidak dikenal: %s (tersedia: gc-media)", name)
+	}
+}
+
+// runMediaGC mencari file media di storage yang tidak lagi dipakai tabel songs
+func runMediaGC(db *sql.DB, storage utils.Storage, args []string) {
+	flags := flag.NewFlagSet("gc-media", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", true, "hanya laporkan file yatim tanpa menghapus")
+	minAge := flags.Duration("min-age", mediaGCMinAge(), "abaikan file yang lebih baru dari durasi ini")
+	flags.Parse(args)
+
+	report, err := utils.CollectOrphanedMedia(db, storage, utils.MediaGCOptions{DryRun: *dryRun, MinAge: *minAge})
+	if err != nil {
+		log.Fatalf("Gagal membersihkan media: %v", err)
+	}
+
+	for _, orphan := range report.Orphans {
+		fmt.Printf("%s\t%d bytes\t%s\n", orphan.Path, orphan.Size, orphan.LastModified.Format(time.RFC3339))
+	}
+	action := "dihapus"
+	if report.DryRun {
+		action = "akan dihapus (dry run)"
+	}
+	fmt.Printf("Dipindai %d file, %d dipakai, %d terlalu baru, %d yatim (%d bytes) %s, %d berhasil, %d gagal\n",
+		report.Scanned, report.Referenced, report.SkippedRecent, len(report.Orphans), report.OrphanBytes,
+		action, report.Deleted, len(report.Failed))
+}
+
+// mediaGCMinAge membaca MEDIA_GC_MIN_AGE, default 24 jam
+func mediaGCMinAge() time.Duration {
+	if value := os.Getenv("MEDIA_GC_MIN_AGE"); value != "" {
+		if minAge, err := time.ParseDuration(value); err == nil {
+			return minAge
+		}
+		log.Printf("MEDIA_GC_MIN_AGE tidak valid, memakai 24h")
+	}
+	return 24 * time.Hour
+}
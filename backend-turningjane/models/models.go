@@ -2,6 +2,7 @@ package models
 
 import (
 	"mime/multipart"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -15,6 +16,77 @@ type SongResponse struct {
 	ReleaseYear   *int       `json:"release_year"`
 	AudioFilePath *string    `json:"audio_file_path"`
 	ImagePath     *string    `json:"image_path"`
+
+	// URL varian gambar, contoh: "150", "600", "1200" dan "600_webp"
+	// (varian WebP hanya ada jika lebih kecil dari JPEG/PNG-nya)
+	ImageVariants map[string]string `json:"image_variants"`
+
+	// Diisi otomatis dari metadata file audio
+	DurationSeconds *float64 `json:"duration_seconds"`
+	Bitrate         *int     `json:"bitrate"`
+	SampleRate      *int     `json:"sample_rate"`
+	Codec           *string  `json:"codec"`
+
+	// Diisi jika lagu termasuk dalam album
+	AlbumID     *uuid.UUID `json:"album_id"`
+	DiscNumber  *int       `json:"disc_number"`
+	TrackNumber *int       `json:"track_number"`
+}
+
+// SongListResponse adalah satu halaman hasil GET /songs. next_cursor bernilai
+// null pada halaman terakhir, total adalah jumlah lagu yang cocok dengan filter.
+type SongListResponse struct {
+	Songs      []SongResponse `json:"songs"`
+	NextCursor *string        `json:"next_cursor"`
+	Total      int            `json:"total"`
+}
+
+// ListSongsQuery berisi parameter query GET /songs
+type ListSongsQuery struct {
+	Limit    int    `form:"limit" binding:"omitempty,min=1,max=100"`
+	Cursor   string `form:"cursor"`
+	GenreID  string `form:"genre_id" binding:"omitempty,uuid"`
+	Artist   string `form:"artist"`
+	YearFrom *int   `form:"year_from"`
+	YearTo   *int   `form:"year_to"`
+	HasAudio *bool  `form:"has_audio"`
+	Sort     string `form:"sort" binding:"omitempty,oneof=title year created_at"`
+	Order    string `form:"order" binding:"omitempty,oneof=asc desc"`
+}
+
+// SearchQuery berisi parameter query GET /search
+type SearchQuery struct {
+	Q     string `form:"q"`
+	Limit int    `form:"limit" binding:"omitempty,min=1,max=50"`
+}
+
+// SearchHighlights berisi potongan teks yang sudah di-escape, kata yang cocok
+// dibungkus <mark>
+type SearchHighlights struct {
+	Title     string  `json:"title"`
+	Artist    string  `json:"artist"`
+	GenreName *string `json:"genre_name"`
+	Lyrics    *string `json:"lyrics"`
+}
+
+type SearchResult struct {
+	SongResponse
+	Rank       float64          `json:"rank"`
+	Highlights SearchHighlights `json:"highlights"`
+}
+
+// SearchResponse: fuzzy bernilai true jika hasil berasal dari pencarian trigram
+type SearchResponse struct {
+	Query   string         `json:"query"`
+	Fuzzy   bool           `json:"fuzzy"`
+	Results []SearchResult `json:"results"`
+}
+
+// WaveformResponse berisi puncak amplitudo (0-1) untuk menggambar waveform di player
+type WaveformResponse struct {
+	SongID     uuid.UUID `json:"song_id"`
+	Resolution int       `json:"resolution"`
+	Peaks      []float64 `json:"peaks"`
 }
 
 type CreateSongRequest struct {
@@ -24,17 +96,23 @@ type CreateSongRequest struct {
 	ReleaseYear   *int       `json:"release_year"`
 	AudioFilePath *string    `json:"audio_file_path"`
 	ImagePath     *string    `json:"image_path"`
+	Lyrics        *string    `json:"lyrics"`
+	LyricsLRC     *string    `json:"lyrics_lrc"`
 }
 
+// CreateSongFormRequest: title dan artist boleh kosong jika bisa diambil dari tag audio_file
 type CreateSongFormRequest struct {
-	Title       string                `form:"title" binding:"required"`
-	Artist      string                `form:"artist" binding:"required"`
+	Title       string                `form:"title"`
+	Artist      string                `form:"artist"`
 	GenreID     string                `form:"genre_id"`
 	ReleaseYear string                `form:"release_year"`
 	AudioFile   *multipart.FileHeader `form:"audio_file"`
 	ImageFile   *multipart.FileHeader `form:"image_file"`
+	Lyrics      string                `form:"lyrics"`
+	LyricsFile  *multipart.FileHeader `form:"lyrics_file"`
 }
 
+// UpdateSongRequest: string kosong pada lyrics atau lyrics_lrc menghapus lirik
 type UpdateSongRequest struct {
 	Title         *string    `json:"title"`
 	Artist        *string    `json:"artist"`
@@ -42,6 +120,8 @@ type UpdateSongRequest struct {
 	ReleaseYear   *int       `json:"release_year"`
 	AudioFilePath *string    `json:"audio_file_path"`
 	ImagePath     *string    `json:"image_path"`
+	Lyrics        *string    `json:"lyrics"`
+	LyricsLRC     *string    `json:"lyrics_lrc"`
 }
 
 type UpdateSongFormRequest struct {
@@ -51,6 +131,189 @@ type UpdateSongFormRequest struct {
 	ReleaseYear *string               `form:"release_year"`
 	AudioFile   *multipart.FileHeader `form:"audio_file"`
 	ImageFile   *multipart.FileHeader `form:"image_file"`
+	Lyrics      *string               `form:"lyrics"`
+	LyricsFile  *multipart.FileHeader `form:"lyrics_file"`
+}
+
+// LyricsLine adalah satu baris lirik LRC, time_ms sudah memperhitungkan tag [offset]
+type LyricsLine struct {
+	TimeMs int64  `json:"time_ms"`
+	Text   string `json:"text"`
+}
+
+// LyricsResponse: metadata dan lines hanya terisi jika lagu punya lirik LRC
+type LyricsResponse struct {
+	SongID   uuid.UUID         `json:"song_id"`
+	Synced   bool              `json:"synced"`
+	Plain    *string           `json:"plain"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Lines    []LyricsLine      `json:"lines"`
+}
+
+// FavoriteSong adalah lagu favorit user beserta waktu ditandai
+type FavoriteSong struct {
+	SongResponse
+	FavoritedAt time.Time `json:"favorited_at"`
+}
+
+// Playlist milik user. share_slug dibuat saat playlist pertama kali dijadikan publik.
+type Playlist struct {
+	PlaylistID  uuid.UUID `json:"playlist_id"`
+	Name        string    `json:"name"`
+	Description *string   `json:"description"`
+	IsPublic    bool      `json:"is_public"`
+	ShareSlug   *string   `json:"share_slug"`
+	SongCount   int       `json:"song_count"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// PlaylistDetailResponse: owner hanya diisi pada playlist publik yang dibuka lewat slug
+type PlaylistDetailResponse struct {
+	Playlist
+	Owner *string        `json:"owner,omitempty"`
+	Songs []SongResponse `json:"songs"`
+}
+
+type CreatePlaylistRequest struct {
+	Name        string  `json:"name" binding:"required,max=100"`
+	Description *string `json:"description" binding:"omitempty,max=1000"`
+	IsPublic    bool    `json:"is_public"`
+}
+
+// UpdatePlaylistRequest: description kosong menghapus deskripsi
+type UpdatePlaylistRequest struct {
+	Name        *string `json:"name" binding:"omitempty,max=100"`
+	Description *string `json:"description" binding:"omitempty,max=1000"`
+	IsPublic    *bool   `json:"is_public"`
+}
+
+type AddPlaylistSongRequest struct {
+	SongID uuid.UUID `json:"song_id" binding:"required"`
+}
+
+// ReorderPlaylistRequest berisi semua lagu playlist dalam urutan baru
+type ReorderPlaylistRequest struct {
+	SongIDs []uuid.UUID `json:"song_ids" binding:"required"`
+}
+
+// EventSetlistSong adalah lagu pada setlist konser, position dimulai dari 1
+type EventSetlistSong struct {
+	Position int       `json:"position"`
+	SongID   uuid.UUID `json:"song_id"`
+	Title    string    `json:"title"`
+	Artist   string    `json:"artist"`
+}
+
+// Event adalah jadwal konser. starts_at dan ends_at ditampilkan dalam zona
+// waktu time_zone (nama IANA, contoh Asia/Jakarta).
+type Event struct {
+	EventID     uuid.UUID          `json:"event_id"`
+	Title       string             `json:"title"`
+	Venue       string             `json:"venue"`
+	City        string             `json:"city"`
+	Country     *string            `json:"country"`
+	StartsAt    time.Time          `json:"starts_at"`
+	EndsAt      *time.Time         `json:"ends_at"`
+	TimeZone    string             `json:"time_zone"`
+	TicketURL   *string            `json:"ticket_url"`
+	Status      string             `json:"status"`
+	Description *string            `json:"description"`
+	Setlist     []EventSetlistSong `json:"setlist"`
+	CreatedAt   time.Time          `json:"created_at"`
+	UpdatedAt   time.Time          `json:"updated_at"`
+}
+
+// CreateEventRequest: starts_at dan ends_at adalah waktu lokal (YYYY-MM-DDTHH:MM)
+// di zona time_zone, setlist berisi song_id sesuai urutan
+type CreateEventRequest struct {
+	Title       string      `json:"title" binding:"required,max=200"`
+	Venue       string      `json:"venue" binding:"required,max=200"`
+	City        string      `json:"city" binding:"required,max=100"`
+	Country     *string     `json:"country" binding:"omitempty,max=100"`
+	StartsAt    string      `json:"starts_at" binding:"required,datetime=2006-01-02T15:04"`
+	EndsAt      *string     `json:"ends_at" binding:"omitempty,datetime=2006-01-02T15:04"`
+	TimeZone    string      `json:"time_zone" binding:"required"`
+	TicketURL   *string     `json:"ticket_url" binding:"omitempty,url"`
+	Status      string      `json:"status" binding:"omitempty,oneof=announced sold_out cancelled"`
+	Description *string     `json:"description"`
+	Setlist     []uuid.UUID `json:"setlist"`
+}
+
+// UpdateEventRequest: string kosong menghapus country, ends_at, ticket_url atau
+// description. Jika hanya time_zone yang diganti, jam lokal konser tetap sama.
+type UpdateEventRequest struct {
+	Title       *string      `json:"title" binding:"omitempty,min=1,max=200"`
+	Venue       *string      `json:"venue" binding:"omitempty,min=1,max=200"`
+	City        *string      `json:"city" binding:"omitempty,min=1,max=100"`
+	Country     *string      `json:"country" binding:"omitempty,max=100"`
+	StartsAt    *string      `json:"starts_at" binding:"omitempty,datetime=2006-01-02T15:04"`
+	EndsAt      *string      `json:"ends_at"`
+	TimeZone    *string      `json:"time_zone" binding:"omitempty,min=1"`
+	TicketURL   *string      `json:"ticket_url"`
+	Status      *string      `json:"status" binding:"omitempty,oneof=announced sold_out cancelled"`
+	Description *string      `json:"description"`
+	Setlist     *[]uuid.UUID `json:"setlist"`
+}
+
+// ListEventsQuery: scope upcoming (default), past atau all
+type ListEventsQuery struct {
+	Scope string `form:"scope" binding:"omitempty,oneof=upcoming past all"`
+}
+
+// RecordPlayRequest: listened_seconds boleh dikirim berulang selama lagu diputar
+type RecordPlayRequest struct {
+	ListenedSeconds float64 `json:"listened_seconds" binding:"min=0,max=86400"`
+	Referrer        string  `json:"referrer" binding:"max=2048"`
+}
+
+type RecordPlayResponse struct {
+	Recorded bool   `json:"recorded"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// PlayStatsQuery: from dan to berformat YYYY-MM-DD (UTC), default 30 hari terakhir
+type PlayStatsQuery struct {
+	From  string `form:"from" binding:"omitempty,datetime=2006-01-02"`
+	To    string `form:"to" binding:"omitempty,datetime=2006-01-02"`
+	Limit int    `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+type DailyPlays struct {
+	Date            string `json:"date"`
+	Plays           int    `json:"plays"`
+	UniqueListeners int    `json:"unique_listeners"`
+}
+
+// TopSong: completion_rate bernilai null jika durasi lagu tidak diketahui
+type TopSong struct {
+	SongID             uuid.UUID `json:"song_id"`
+	Title              string    `json:"title"`
+	Artist             string    `json:"artist"`
+	Plays              int       `json:"plays"`
+	UniqueListeners    int       `json:"unique_listeners"`
+	CompletionRate     *float64  `json:"completion_rate"`
+	AvgListenedSeconds float64   `json:"avg_listened_seconds"`
+}
+
+// ReferrerPlays: referrer null berarti dibuka langsung
+type ReferrerPlays struct {
+	Referrer *string `json:"referrer"`
+	Plays    int     `json:"plays"`
+}
+
+// PlayStatsResponse: fingerprint berganti setiap hari, jadi unique_listeners
+// untuk rentang tanggal dan lagu teratas adalah jumlah pendengar unik per
+// hari. Pendengar yang kembali di hari lain dihitung lagi.
+type PlayStatsResponse struct {
+	From            string          `json:"from"`
+	To              string          `json:"to"`
+	TotalPlays      int             `json:"total_plays"`
+	UniqueListeners int             `json:"unique_listeners"`
+	CompletionRate  *float64        `json:"completion_rate"`
+	PlaysPerDay     []DailyPlays    `json:"plays_per_day"`
+	TopSongs        []TopSong       `json:"top_songs"`
+	TopReferrers    []ReferrerPlays `json:"top_referrers"`
 }
 
 type Genre struct {
@@ -61,3 +324,194 @@ type Genre struct {
 type CreateGenreRequest struct {
 	GenreName string `json:"genre_name" binding:"required"`
 }
+
+// Album adalah rilisan (single, EP atau LP). release_date berformat YYYY-MM-DD.
+type Album struct {
+	AlbumID            uuid.UUID         `json:"album_id"`
+	Title              string            `json:"title"`
+	AlbumType          string            `json:"album_type"`
+	ReleaseDate        *string           `json:"release_date"`
+	CoverImagePath     *string           `json:"cover_image_path"`
+	CoverImageVariants map[string]string `json:"cover_image_variants"`
+	Label              *string           `json:"label"`
+	UPC                *string           `json:"upc"`
+	TrackCount         int               `json:"track_count"`
+}
+
+// AlbumDetailResponse berisi album beserta tracklist yang sudah diurutkan
+type AlbumDetailResponse struct {
+	Album
+	Tracks []SongResponse `json:"tracks"`
+}
+
+type CreateAlbumRequest struct {
+	Title          string  `json:"title" binding:"required"`
+	AlbumType      string  `json:"album_type" binding:"required,oneof=single ep lp"`
+	ReleaseDate    *string `json:"release_date" binding:"omitempty,datetime=2006-01-02"`
+	CoverImagePath *string `json:"cover_image_path"`
+	Label          *string `json:"label"`
+	UPC            *string `json:"upc" binding:"omitempty,numeric,min=12,max=13"`
+}
+
+// UpdateAlbumRequest: string kosong menghapus release_date, label, upc atau cover
+type UpdateAlbumRequest struct {
+	Title          *string `json:"title" binding:"omitempty,min=1"`
+	AlbumType      *string `json:"album_type" binding:"omitempty,oneof=single ep lp"`
+	ReleaseDate    *string `json:"release_date"`
+	CoverImagePath *string `json:"cover_image_path"`
+	Label          *string `json:"label"`
+	UPC            *string `json:"upc"`
+}
+
+type AlbumCoverFormRequest struct {
+	CoverFile *multipart.FileHeader `form:"cover_file" binding:"required"`
+}
+
+// AlbumTrack menempatkan lagu pada posisi tertentu di album, disc_number default 1
+type AlbumTrack struct {
+	SongID      uuid.UUID `json:"song_id" binding:"required"`
+	DiscNumber  int       `json:"disc_number" binding:"omitempty,min=1"`
+	TrackNumber int       `json:"track_number" binding:"required,min=1"`
+}
+
+// SetAlbumTracksRequest menggantikan seluruh tracklist album
+type SetAlbumTracksRequest struct {
+	Tracks []AlbumTrack `json:"tracks" binding:"dive"`
+}
+
+// Post adalah berita/blog. body_html adalah hasil render body_markdown yang
+// sudah disanitasi, excerpt dibuat dari isi berita jika tidak diisi.
+type Post struct {
+	PostID             uuid.UUID         `json:"post_id"`
+	Title              string            `json:"title"`
+	Slug               string            `json:"slug"`
+	Excerpt            string            `json:"excerpt"`
+	BodyMarkdown       string            `json:"body_markdown,omitempty"`
+	BodyHTML           string            `json:"body_html,omitempty"`
+	CoverImagePath     *string           `json:"cover_image_path"`
+	CoverImageVariants map[string]string `json:"cover_image_variants"`
+	AuthorID           *uuid.UUID        `json:"author_id"`
+	Tags               []string          `json:"tags"`
+	Status             string            `json:"status"`
+	PublishAt          *time.Time        `json:"publish_at"`
+	CreatedAt          time.Time         `json:"created_at"`
+	UpdatedAt          time.Time         `json:"updated_at"`
+}
+
+// PostListResponse adalah satu halaman GET /posts, next_cursor bernilai null
+// pada halaman terakhir
+type PostListResponse struct {
+	Posts      []Post  `json:"posts"`
+	NextCursor *string `json:"next_cursor"`
+}
+
+// ListPostsQuery berisi parameter query GET /posts
+type ListPostsQuery struct {
+	Limit  int    `form:"limit" binding:"omitempty,min=1,max=50"`
+	Cursor string `form:"cursor"`
+	Tag    string `form:"tag"`
+}
+
+// ListAdminPostsQuery berisi parameter query GET /api/content/posts
+type ListAdminPostsQuery struct {
+	Status string `form:"status" binding:"omitempty,oneof=draft scheduled published"`
+	Tag    string `form:"tag"`
+}
+
+// CreatePostRequest: status default draft. publish_at wajib untuk scheduled,
+// untuk published boleh diisi waktu lampau dan default sekarang.
+type CreatePostRequest struct {
+	Title          string     `json:"title" binding:"required,max=200"`
+	Slug           *string    `json:"slug" binding:"omitempty,max=80"`
+	Excerpt        *string    `json:"excerpt" binding:"omitempty,max=500"`
+	BodyMarkdown   string     `json:"body_markdown" binding:"required,max=200000"`
+	CoverImagePath *string    `json:"cover_image_path"`
+	Tags           []string   `json:"tags" binding:"max=20,dive,max=40"`
+	Status         string     `json:"status" binding:"omitempty,oneof=draft scheduled published"`
+	PublishAt      *time.Time `json:"publish_at"`
+}
+
+// UpdatePostRequest: string kosong menghapus excerpt atau cover, tags
+// menggantikan seluruh tag
+type UpdatePostRequest struct {
+	Title          *string    `json:"title" binding:"omitempty,min=1,max=200"`
+	Slug           *string    `json:"slug" binding:"omitempty,min=1,max=80"`
+	Excerpt        *string    `json:"excerpt" binding:"omitempty,max=500"`
+	BodyMarkdown   *string    `json:"body_markdown" binding:"omitempty,min=1,max=200000"`
+	CoverImagePath *string    `json:"cover_image_path"`
+	Tags           *[]string  `json:"tags" binding:"omitempty,max=20,dive,max=40"`
+	Status         *string    `json:"status" binding:"omitempty,oneof=draft scheduled published"`
+	PublishAt      *time.Time `json:"publish_at"`
+}
+
+type PostCoverFormRequest struct {
+	CoverFile *multipart.FileHeader `form:"cover_file" binding:"required"`
+}
+
+// GalleryPhoto adalah satu foto di album galeri, diurutkan berdasarkan position
+type GalleryPhoto struct {
+	PhotoID       uuid.UUID         `json:"photo_id"`
+	AlbumID       uuid.UUID         `json:"album_id"`
+	ImagePath     string            `json:"image_path"`
+	ImageVariants map[string]string `json:"image_variants"`
+	Caption       *string           `json:"caption"`
+	Photographer  *string           `json:"photographer"`
+	Position      int               `json:"position"`
+	CreatedAt     time.Time         `json:"created_at"`
+}
+
+// GalleryAlbum adalah album galeri. cover_photo adalah foto yang dipilih
+// sebagai cover, atau foto pertama jika belum dipilih.
+type GalleryAlbum struct {
+	AlbumID     uuid.UUID     `json:"album_id"`
+	Title       string        `json:"title"`
+	Slug        string        `json:"slug"`
+	Description *string       `json:"description"`
+	CoverPhoto  *GalleryPhoto `json:"cover_photo"`
+	PhotoCount  int           `json:"photo_count"`
+	Position    int           `json:"position"`
+	CreatedAt   time.Time     `json:"created_at"`
+	UpdatedAt   time.Time     `json:"updated_at"`
+}
+
+// GalleryAlbumDetailResponse berisi album galeri beserta semua fotonya
+type GalleryAlbumDetailResponse struct {
+	GalleryAlbum
+	Photos []GalleryPhoto `json:"photos"`
+}
+
+type CreateGalleryAlbumRequest struct {
+	Title       string  `json:"title" binding:"required,max=200"`
+	Description *string `json:"description" binding:"omitempty,max=2000"`
+}
+
+// UpdateGalleryAlbumRequest: string kosong menghapus description atau
+// cover_photo_id, cover harus foto dari album yang sama
+type UpdateGalleryAlbumRequest struct {
+	Title        *string `json:"title" binding:"omitempty,min=1,max=200"`
+	Description  *string `json:"description" binding:"omitempty,max=2000"`
+	CoverPhotoID *string `json:"cover_photo_id"`
+}
+
+// GalleryPhotoFormRequest adalah form upload foto galeri
+type GalleryPhotoFormRequest struct {
+	PhotoFile    *multipart.FileHeader `form:"photo_file" binding:"required"`
+	Caption      string                `form:"caption" binding:"max=500"`
+	Photographer string                `form:"photographer" binding:"max=200"`
+}
+
+// UpdateGalleryPhotoRequest: string kosong menghapus caption atau photographer
+type UpdateGalleryPhotoRequest struct {
+	Caption      *string `json:"caption" binding:"omitempty,max=500"`
+	Photographer *string `json:"photographer" binding:"omitempty,max=200"`
+}
+
+// ReorderGalleryAlbumsRequest berisi semua album galeri dalam urutan baru
+type ReorderGalleryAlbumsRequest struct {
+	AlbumIDs []uuid.UUID `json:"album_ids" binding:"required"`
+}
+
+// ReorderGalleryPhotosRequest berisi semua foto album dalam urutan baru
+type ReorderGalleryPhotosRequest struct {
+	PhotoIDs []uuid.UUID `json:"photo_ids" binding:"required"`
+}
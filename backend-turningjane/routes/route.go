@@ -2,21 +2,36 @@ package routes
 
 import (
 	"database/sql"
+	"fmt"
+	"log"
 	"net/http"
+	"os"
+	"strings"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-contrib/sessions/cookie"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 
 	"backend-turningjane/controllers"
+	"backend-turningjane/utils"
 )
 
-func SetupRouter(db *sql.DB) *gin.Engine {
+func SetupRouter(db *sql.DB, storage utils.Storage, outbox *utils.DeletionOutbox, mailer utils.Mailer, sessionSecret []byte) *gin.Engine {
 	router := gin.Default()
 
-	// Setup session
-	store := cookie.NewStore([]byte("secret-session-key"))
+	// ClientIP hanya membaca X-Forwarded-For dari proxy di TRUSTED_PROXIES,
+	// tanpa itu alamat IP untuk rate limit bisa dipalsukan
+	if err := router.SetTrustedProxies(trustedProxies()); err != nil {
+		log.Fatalf("TRUSTED_PROXIES tidak valid: %v", err)
+	}
+
+	// Batasi memori form multipart, file yang lebih besar disimpan sementara di disk
+	router.MaxMultipartMemory = utils.MultipartMemory()
+
+	// Setup session, cookie ditandatangani dengan SESSION_SECRET
+	store := cookie.NewStore(sessionSecret)
 	store.Options(sessions.Options{
 		Path:     "/",
 		MaxAge:   3600 * 24, // umur cookies
@@ -34,11 +49,27 @@ func SetupRouter(db *sql.DB) *gin.Engine {
 	config.AllowCredentials = true
 	router.Use(cors.New(config))
 
+	// Sajikan media jika memakai STORAGE_DRIVER=local
+	if local, ok := storage.(*utils.LocalStorageConfig); ok {
+		router.Static(local.MountPath(), local.RootDir)
+	}
+
 	// Initialize controllers
-	songController := controllers.NewSongController(db)
+	songController := controllers.NewSongController(db, storage, outbox)
 	genreController := controllers.NewGenreController(db)
-	userController := controllers.NewUserController(db)
+	userController := controllers.NewUserController(db, mailer)
 	adminController := controllers.NewAdminController(db)
+	searchController := controllers.NewSearchController(db)
+	albumController := controllers.NewAlbumController(db, storage, outbox)
+	playController := controllers.NewPlayController(db)
+	favoriteController := controllers.NewFavoriteController(db)
+	playlistController := controllers.NewPlaylistController(db)
+	eventController := controllers.NewEventController(db)
+	postController := controllers.NewPostController(db, storage, outbox)
+	feedController := controllers.NewFeedController(db, storage)
+	galleryController := controllers.NewGalleryController(db, storage, outbox)
+	passwordController := controllers.NewPasswordController(db, mailer)
+	twoFactorController := controllers.NewTwoFactorController(db)
 
 	router.GET("/", func(c *gin.Context) {
 		c.String(http.StatusOK, "Server Berjalan")
@@ -49,9 +80,15 @@ func SetupRouter(db *sql.DB) *gin.Engine {
 	// User authentication routes
 	router.POST("/register", userController.Register)
 	router.POST("/login", userController.Login)
+	router.GET("/verify-email", userController.VerifyEmail)
 
 	// Admin authentication routes
 	router.POST("/admin/login", adminController.AdminLogin)
+	router.POST("/admin/login/verify", twoFactorController.VerifyAdminLogin)
+
+	// Password reset routes (user dan admin)
+	router.POST("/password/forgot", passwordController.ForgotPassword)
+	router.POST("/password/reset", passwordController.ResetPassword)
 
 	// Add this new public auth check route
 	router.GET("/api/auth", func(c *gin.Context) {
@@ -70,9 +107,10 @@ func SetupRouter(db *sql.DB) *gin.Engine {
 				ID       string `json:"id"`
 				Email    string `json:"email"`
 				Username string `json:"username"`
+				Verified bool   `json:"verified"`
 			}
 
-			err := db.QueryRow("SELECT id, email, username FROM users WHERE id = $1", userID).Scan(&user.ID, &user.Email, &user.Username)
+			err := db.QueryRow("SELECT id, email, username, verified_at IS NOT NULL FROM users WHERE id = $1", userID).Scan(&user.ID, &user.Email, &user.Username, &user.Verified)
 			if err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user details"})
 				return
@@ -83,6 +121,7 @@ func SetupRouter(db *sql.DB) *gin.Engine {
 				"user_type": userType,
 				"username":  user.Username,
 				"email":     user.Email,
+				"verified":  user.Verified,
 			})
 		} else if userType == "admin" {
 			// Get admin details from database
@@ -90,19 +129,22 @@ func SetupRouter(db *sql.DB) *gin.Engine {
 				ID       string `json:"id"`
 				Email    string `json:"email"`
 				Username string `json:"username"`
+				Role     string `json:"role"`
 			}
 
-			err := db.QueryRow("SELECT id, email, username FROM admins WHERE id = $1", userID).Scan(&admin.ID, &admin.Email, &admin.Username)
+			err := db.QueryRow("SELECT id, email, username, role FROM admins WHERE id = $1", userID).Scan(&admin.ID, &admin.Email, &admin.Username, &admin.Role)
 			if err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get admin details"})
 				return
 			}
 
 			c.JSON(http.StatusOK, gin.H{
-				"message":   "Authorized",
-				"user_type": userType,
-				"username":  admin.Username,
-				"email":     admin.Email,
+				"message":     "Authorized",
+				"user_type":   userType,
+				"username":    admin.Username,
+				"email":       admin.Email,
+				"role":        admin.Role,
+				"permissions": controllers.RolePermissions(admin.Role),
 			})
 		} else {
 			c.JSON(http.StatusOK, gin.H{
@@ -115,7 +157,23 @@ func SetupRouter(db *sql.DB) *gin.Engine {
 	// Public routes for songs and genres
 	router.GET("/songs", songController.ListSongs)
 	router.GET("/songs/:id", songController.GetSong)
+	router.GET("/songs/:id/waveform", songController.GetWaveform)
+	router.GET("/songs/:id/lyrics", songController.GetLyrics)
+	router.POST("/songs/:id/plays", playController.RecordPlay)
 	router.GET("/genres", genreController.ListGenres)
+	router.GET("/albums", albumController.ListAlbums)
+	router.GET("/albums/:id", albumController.GetAlbum)
+	router.GET("/search", searchController.Search)
+	router.GET("/playlists/:slug", playlistController.GetSharedPlaylist)
+	router.GET("/events", eventController.ListEvents)
+	router.GET("/events.ics", eventController.EventsCalendar)
+	router.GET("/events/:id", eventController.GetEvent)
+	router.GET("/posts", postController.ListPosts)
+	router.GET("/posts/:slug", postController.GetPost)
+	router.GET("/feed.xml", feedController.Atom)
+	router.GET("/rss.xml", feedController.RSS)
+	router.GET("/gallery", galleryController.ListGalleryAlbums)
+	router.GET("/gallery/:slug", galleryController.GetGalleryAlbum)
 
 	// === PROTECTED ROUTES ===
 	protected := router.Group("/api")
@@ -130,41 +188,107 @@ func SetupRouter(db *sql.DB) *gin.Engine {
 		userRoutes := protected.Group("/users")
 		{
 			userRoutes.GET("/profile", userController.GetProfile)
-			userRoutes.GET("/", userController.ListUsers)        // List all users (admin access)
-			userRoutes.PUT("/:id", userController.UpdateUser)    // Update user
-			userRoutes.DELETE("/:id", userController.DeleteUser) // Delete user
+			userRoutes.POST("/verify-email/resend", userController.ResendVerification)
+			userRoutes.PUT("/:id", AccountOwnerRequired(), userController.UpdateUser)    // Update own account
+			userRoutes.DELETE("/:id", AccountOwnerRequired(), userController.DeleteUser) // Delete own account
+
+			// Lagu favorit user yang sedang login
+			userRoutes.GET("/favorites", favoriteController.ListFavorites)
+			userRoutes.PUT("/favorites/:song_id", favoriteController.AddFavorite)
+			userRoutes.DELETE("/favorites/:song_id", favoriteController.RemoveFavorite)
+
+			// Playlist milik user yang sedang login
+			userRoutes.GET("/playlists", playlistController.ListPlaylists)
+			userRoutes.POST("/playlists", playlistController.CreatePlaylist)
+			userRoutes.GET("/playlists/:playlist_id", playlistController.GetPlaylist)
+			userRoutes.PUT("/playlists/:playlist_id", playlistController.UpdatePlaylist)
+			userRoutes.DELETE("/playlists/:playlist_id", playlistController.DeletePlaylist)
+			userRoutes.POST("/playlists/:playlist_id/songs", playlistController.AddPlaylistSong)
+			userRoutes.PUT("/playlists/:playlist_id/songs", playlistController.ReorderPlaylistSongs)
+			userRoutes.DELETE("/playlists/:playlist_id/songs/:song_id", playlistController.RemovePlaylistSong)
 		}
 
 		// === ADMIN ROUTES ===
 		adminRoutes := protected.Group("/admin")
-		adminRoutes.Use(AdminRequired()) // Additional admin check
+		adminRoutes.Use(AdminRequired(db)) // Additional admin check
 		{
+			// Hak akses per role admin, lihat controllers.RolePermissions
+			manageAdmins := PermissionRequired(controllers.PermAdminsManage)
+			manageUsers := PermissionRequired(controllers.PermUsersManage)
+			readStats := PermissionRequired(controllers.PermStatsRead)
+
 			// Admin profile management
 			adminRoutes.GET("/profile", adminController.GetAdminProfile)
 
+			// Two-factor authentication (TOTP) untuk admin yang sedang login
+			adminRoutes.GET("/2fa", twoFactorController.TwoFactorStatus)
+			adminRoutes.POST("/2fa/setup", twoFactorController.SetupTwoFactor)
+			adminRoutes.GET("/2fa/qr.png", twoFactorController.TwoFactorQRCode)
+			adminRoutes.POST("/2fa/confirm", twoFactorController.ConfirmTwoFactor)
+			adminRoutes.POST("/2fa/recovery-codes", twoFactorController.RegenerateRecoveryCodes)
+			adminRoutes.DELETE("/2fa", twoFactorController.DisableTwoFactor)
+
 			// Admin CRUD operations
-			adminRoutes.GET("/", adminController.ListAdmins)        // List all admins
-			adminRoutes.POST("/", adminController.CreateAdmin)      // Create new admin
-			adminRoutes.PUT("/:id", adminController.UpdateAdmin)    // Update admin
-			adminRoutes.DELETE("/:id", adminController.DeleteAdmin) // Delete admin
+			adminRoutes.GET("/", manageAdmins, adminController.ListAdmins)        // List all admins
+			adminRoutes.POST("/", manageAdmins, adminController.CreateAdmin)      // Create new admin
+			adminRoutes.PUT("/:id", manageAdmins, adminController.UpdateAdmin)    // Update admin
+			adminRoutes.DELETE("/:id", manageAdmins, adminController.DeleteAdmin) // Delete admin
+
+			// Upload monitoring
+			adminRoutes.GET("/uploads/stats", readStats, songController.UploadStats)
+
+			// Statistik pemutaran lagu
+			adminRoutes.GET("/stats", readStats, playController.Stats)
 
 			// Admin management of users (optional - if admins can manage users)
-			adminRoutes.GET("/users", userController.ListUsers)         // Admin can view all users
-			adminRoutes.PUT("/users/:id", userController.UpdateUser)    // Admin can update users
-			adminRoutes.DELETE("/users/:id", userController.DeleteUser) // Admin can delete users
+			adminRoutes.GET("/users", manageUsers, userController.ListUsers)         // Admin can view all users
+			adminRoutes.PUT("/users/:id", manageUsers, userController.UpdateUser)    // Admin can update users
+			adminRoutes.DELETE("/users/:id", manageUsers, userController.DeleteUser) // Admin can delete users
 		}
 
-		// === CONTENT MANAGEMENT ROUTES (Admin only) ===
+		// === CONTENT MANAGEMENT ROUTES (Admin with content:write) ===
 		contentRoutes := protected.Group("/content")
-		contentRoutes.Use(AdminRequired())
+		contentRoutes.Use(AdminRequired(db), PermissionRequired(controllers.PermContentWrite))
 		{
 			// Song management (admin only)
 			contentRoutes.POST("/songs", songController.CreateSong)
-			contentRoutes.POST("/songs/upload", songController.CreateSongWithFiles)
+			contentRoutes.POST("/songs/upload", MaxBodySize(utils.MaxUploadSize()), songController.CreateSongWithFiles)
 			contentRoutes.PUT("/songs/:id", songController.UpdateSong)
-			contentRoutes.PUT("/songs/:id/upload", songController.UpdateSongWithFiles)
+			contentRoutes.PUT("/songs/:id/upload", MaxBodySize(utils.MaxUploadSize()), songController.UpdateSongWithFiles)
 			contentRoutes.DELETE("/songs/:id", songController.DeleteSong)
 
+			// Album management (admin only)
+			contentRoutes.POST("/albums", albumController.CreateAlbum)
+			contentRoutes.PUT("/albums/:id", albumController.UpdateAlbum)
+			contentRoutes.PUT("/albums/:id/cover", MaxBodySize(utils.MaxUploadSize()), albumController.UploadAlbumCover)
+			contentRoutes.PUT("/albums/:id/tracks", albumController.SetAlbumTracks)
+			contentRoutes.DELETE("/albums/:id", albumController.DeleteAlbum)
+
+			// Event management (admin only)
+			contentRoutes.POST("/events", eventController.CreateEvent)
+			contentRoutes.PUT("/events/:id", eventController.UpdateEvent)
+			contentRoutes.DELETE("/events/:id", eventController.DeleteEvent)
+
+			// News/blog management (admin only)
+			contentRoutes.GET("/posts", postController.ListAdminPosts)
+			contentRoutes.GET("/posts/:id", postController.GetAdminPost)
+			contentRoutes.POST("/posts", postController.CreatePost)
+			contentRoutes.PUT("/posts/:id", postController.UpdatePost)
+			contentRoutes.PUT("/posts/:id/cover", MaxBodySize(utils.MaxUploadSize()), postController.UploadPostCover)
+			contentRoutes.DELETE("/posts/:id", postController.DeletePost)
+
+			// Gallery management (admin only)
+			contentRoutes.GET("/gallery", galleryController.ListAdminGalleryAlbums)
+			contentRoutes.POST("/gallery", galleryController.CreateGalleryAlbum)
+			contentRoutes.PUT("/gallery/order", galleryController.ReorderGalleryAlbums)
+			contentRoutes.GET("/gallery/:id", galleryController.GetAdminGalleryAlbum)
+			contentRoutes.PUT("/gallery/:id", galleryController.UpdateGalleryAlbum)
+			contentRoutes.DELETE("/gallery/:id", galleryController.DeleteGalleryAlbum)
+			contentRoutes.POST("/gallery/:id/photos", MaxBodySize(utils.MaxUploadSize()), galleryController.UploadGalleryPhoto)
+			contentRoutes.PUT("/gallery/:id/photos/order", galleryController.ReorderGalleryPhotos)
+			contentRoutes.PUT("/gallery/:id/photos/:photo_id", galleryController.UpdateGalleryPhoto)
+			contentRoutes.DELETE("/gallery/:id/photos/:photo_id", galleryController.DeleteGalleryPhoto)
+
 			// Genre management (admin only)
 			contentRoutes.POST("/genres", genreController.CreateGenre)
 			contentRoutes.PUT("/genres/:id", genreController.UpdateGenre)
@@ -195,8 +319,25 @@ func AuthRequired() gin.HandlerFunc {
 	}
 }
 
-// AdminRequired middleware checks if user is an admin
-func AdminRequired() gin.HandlerFunc {
+// AccountOwnerRequired middleware checks that the :id in the path is the
+// logged in user. Admins manage other users through /api/admin/users.
+func AccountOwnerRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := uuid.Parse(c.GetString("user_id"))
+		targetID, targetErr := uuid.Parse(c.Param("id"))
+		if c.GetString("user_type") != "user" || err != nil || targetErr != nil || userID != targetID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can only modify your own account"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// AdminRequired middleware checks if user is an admin and loads the admin's
+// role. The role is read from the database on every request, so a changed
+// role or a deleted admin takes effect without logging in again.
+func AdminRequired(db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userType, exists := c.Get("user_type")
 		if !exists || userType != "admin" {
@@ -204,6 +345,68 @@ func AdminRequired() gin.HandlerFunc {
 			c.Abort()
 			return
 		}
+
+		adminID, err := uuid.Parse(c.GetString("user_id"))
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			c.Abort()
+			return
+		}
+
+		var role string
+		err = db.QueryRow("SELECT role FROM admins WHERE id = $1", adminID).Scan(&role)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			}
+			c.Abort()
+			return
+		}
+
+		c.Set("admin_role", role)
 		c.Next()
 	}
 }
+
+// PermissionRequired middleware checks if the admin's role grants the
+// permission. It must run after AdminRequired.
+func PermissionRequired(permission controllers.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !controllers.HasPermission(c.GetString("admin_role"), permission) {
+			c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("Permission %s required", permission)})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// MaxBodySize middleware rejects request bodies larger than limit bytes.
+// Requests announcing a larger Content-Length are refused before any of the
+// body is read, chunked bodies are cut off once they pass the limit.
+func MaxBodySize(limit int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > limit {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Request body exceeds the %d MB limit", limit>>20)})
+			c.Abort()
+			return
+		}
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		c.Next()
+	}
+}
+
+// Helper function to read TRUSTED_PROXIES, a comma separated list of proxy
+// IPs or CIDRs. No proxy is trusted when it is empty.
+func trustedProxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
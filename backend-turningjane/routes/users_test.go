@@ -0,0 +1,199 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	"backend-turningjane/utils"
+)
+
+const testSessionSecret = "0123456789abcdef0123456789abcdef"
+
+// newTestRouter builds the real router on a mock database. The extra
+// /test/login route stores a session the way the login handlers do.
+func newTestRouter(t *testing.T) (*gin.Engine, sqlmock.Sqlmock) {
+	gin.SetMode(gin.TestMode)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	router := SetupRouter(db, nil, nil, utils.NewLogMailer(), []byte(testSessionSecret))
+	router.GET("/test/login", func(c *gin.Context) {
+		session := sessions.Default(c)
+		session.Set("user_id", c.Query("id"))
+		session.Set("user_type", c.Query("type"))
+		if err := session.Save(); err != nil {
+			t.Fatal(err)
+		}
+		c.Status(http.StatusNoContent)
+	})
+	return router, mock
+}
+
+// login returns the session cookie of an account
+func login(t *testing.T, router *gin.Engine, id uuid.UUID, userType string) *http.Cookie {
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/test/login?id="+id.String()+"&type="+userType, nil))
+	for _, cookie := range recorder.Result().Cookies() {
+		if cookie.Name == "auth-session" {
+			return cookie
+		}
+	}
+	t.Fatal("login did not set the session cookie")
+	return nil
+}
+
+func serve(router *gin.Engine, method, path, body string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.AddCookie(cookie)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func passwordHash(t *testing.T, password string) string {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(hash)
+}
+
+func TestUpdateUserOwnAccount(t *testing.T) {
+	router, mock := newTestRouter(t)
+	userID := uuid.New()
+	cookie := login(t, router, userID, "user")
+
+	mock.ExpectQuery(`SELECT email, password FROM users WHERE id = \$1`).
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"email", "password"}).AddRow("jane@example.com", passwordHash(t, "rahasia")))
+	mock.ExpectQuery(`SELECT EXISTS\(SELECT 1 FROM users WHERE email = \$1 AND id != \$2\)`).
+		WithArgs("jane@example.com", userID).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectExec(`UPDATE users SET email = \$1, verified_at = .* WHERE id = \$2`).
+		WithArgs("jane@example.com", userID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	recorder := serve(router, http.MethodPut, "/api/users/"+userID.String(), `{"email":"jane@example.com"}`, cookie)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", recorder.Code, recorder.Body)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUpdateUserOtherAccountForbidden(t *testing.T) {
+	router, mock := newTestRouter(t)
+	cookie := login(t, router, uuid.New(), "user")
+
+	for _, method := range []string{http.MethodPut, http.MethodDelete} {
+		recorder := serve(router, method, "/api/users/"+uuid.New().String(), `{"email":"mallory@example.com"}`, cookie)
+		if recorder.Code != http.StatusForbidden {
+			t.Errorf("%s status = %d, want 403: %s", method, recorder.Code, recorder.Body)
+		}
+	}
+	// The request is refused before the database is touched
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUpdateUserAsAdmin(t *testing.T) {
+	router, mock := newTestRouter(t)
+	adminID, userID := uuid.New(), uuid.New()
+	cookie := login(t, router, adminID, "admin")
+
+	mock.ExpectQuery(`SELECT role FROM admins WHERE id = \$1`).
+		WithArgs(adminID).
+		WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow("owner"))
+	mock.ExpectQuery(`SELECT email, password FROM users WHERE id = \$1`).
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"email", "password"}).AddRow("jane@example.com", passwordHash(t, "rahasia")))
+	mock.ExpectQuery(`SELECT EXISTS\(SELECT 1 FROM users WHERE email = \$1 AND id != \$2\)`).
+		WithArgs("jane@example.com", userID).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectExec(`UPDATE users SET email = \$1, password = \$2, verified_at = .* WHERE id = \$3`).
+		WithArgs("jane@example.com", sqlmock.AnyArg(), userID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// Admins do not need the current password of the user
+	recorder := serve(router, http.MethodPut, "/api/admin/users/"+userID.String(), `{"email":"jane@example.com","password":"baru123"}`, cookie)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", recorder.Code, recorder.Body)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUpdateUserPasswordChange(t *testing.T) {
+	tests := []struct {
+		name            string
+		currentPassword string
+		wantStatus      int
+	}{
+		{"without current password", "", http.StatusBadRequest},
+		{"wrong current password", "salah", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, mock := newTestRouter(t)
+			userID := uuid.New()
+			cookie := login(t, router, userID, "user")
+
+			mock.ExpectQuery(`SELECT email, password FROM users WHERE id = \$1`).
+				WithArgs(userID).
+				WillReturnRows(sqlmock.NewRows([]string{"email", "password"}).AddRow("jane@example.com", passwordHash(t, "rahasia")))
+
+			body := `{"email":"jane@example.com","password":"baru123","current_password":"` + tt.currentPassword + `"}`
+			recorder := serve(router, http.MethodPut, "/api/users/"+userID.String(), body, cookie)
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+			// The password is never updated
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestListUsersRequiresUsersManage(t *testing.T) {
+	router, mock := newTestRouter(t)
+
+	recorder := serve(router, http.MethodGet, "/api/users/", "", login(t, router, uuid.New(), "user"))
+	if recorder.Code == http.StatusOK {
+		t.Errorf("user listing all users: status = %d, want an error", recorder.Code)
+	}
+
+	recorder = serve(router, http.MethodGet, "/api/admin/users", "", login(t, router, uuid.New(), "user"))
+	if recorder.Code != http.StatusForbidden {
+		t.Errorf("user on /api/admin/users: status = %d, want 403", recorder.Code)
+	}
+
+	viewerID := uuid.New()
+	mock.ExpectQuery(`SELECT role FROM admins WHERE id = \$1`).
+		WithArgs(viewerID).
+		WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow("viewer"))
+	recorder = serve(router, http.MethodGet, "/api/admin/users", "", login(t, router, viewerID, "admin"))
+	if recorder.Code != http.StatusForbidden {
+		t.Errorf("viewer admin on /api/admin/users: status = %d, want 403", recorder.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
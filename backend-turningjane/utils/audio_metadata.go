@@ -0,0 +1,297 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// maxPictureSize caps the embedded cover art we are willing to load in memory
+const maxPictureSize = 10 << 20
+
+// ErrUnsupportedAudio is returned when no metadata parser exists for a file
+var ErrUnsupportedAudio = errors.New("unsupported audio format")
+
+// AudioPicture is cover art embedded in an audio file
+type AudioPicture struct {
+	MIMEType string
+	Data     []byte
+}
+
+// AudioMetadata holds the tags and stream details read from an audio file
+type AudioMetadata struct {
+	Title           string
+	Artist          string
+	Album           string
+	Year            int
+	DurationSeconds float64
+	Bitrate         int // kbps
+	SampleRate      int // Hz
+	Channels        int
+	Codec           string
+	Picture         *AudioPicture
+}
+
+// ReadAudioMetadataFromFile opens an uploaded file and reads its metadata
+func ReadAudioMetadataFromFile(fileHeader *multipart.FileHeader) (*AudioMetadata, error) {
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %v", err)
+	}
+	defer file.Close()
+
+	return ReadAudioMetadata(file, fileHeader.Size)
+}
+
+// ReadAudioMetadata parses ID3v2/ID3v1 (MP3), Vorbis comments (FLAC, Ogg
+// Vorbis, Opus), MP4 atoms (M4A) and RIFF INFO (WAV) tags together with the
+// stream details needed to compute duration and bitrate.
+func ReadAudioMetadata(r io.ReaderAt, size int64) (*AudioMetadata, error) {
+	head := make([]byte, sniffLength)
+	n, err := r.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read file: %v", err)
+	}
+
+	meta := &AudioMetadata{}
+	switch detectFileType(r, size, head[:n]) {
+	case "audio/mpeg":
+		err = readMP3(r, size, meta)
+	case "audio/flac":
+		err = readFLAC(r, 0, meta)
+	case "audio/ogg":
+		err = readOgg(r, size, meta)
+	case "audio/mp4":
+		err = readMP4(r, size, meta)
+	case "audio/wav":
+		err = readWAV(r, size, meta)
+	default:
+		return nil, ErrUnsupportedAudio
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Fall back to the average bitrate when the stream does not declare one
+	if meta.Bitrate == 0 && meta.DurationSeconds > 0 {
+		meta.Bitrate = int(float64(size)*8/meta.DurationSeconds/1000 + 0.5)
+	}
+
+	return meta, nil
+}
+
+// readAt reads exactly n bytes at off
+func readAt(r io.ReaderAt, off int64, n int64) ([]byte, error) {
+	if n < 0 || n > 64<<20 {
+		return nil, fmt.Errorf("invalid block size %d", n)
+	}
+	buf := make([]byte, n)
+	read, err := r.ReadAt(buf, off)
+	if int64(read) < n {
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf, nil
+}
+
+// setTag fills a metadata field from a tag key, keeping the first value found
+func (m *AudioMetadata) setTag(key, value string) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return
+	}
+
+	switch strings.ToUpper(key) {
+	case "TITLE":
+		if m.Title == "" {
+			m.Title = value
+		}
+	case "ARTIST":
+		if m.Artist == "" {
+			m.Artist = value
+		}
+	case "ALBUMARTIST":
+		// Only used when the track has no artist of its own
+		if m.Artist == "" {
+			m.Artist = value
+		}
+	case "ALBUM":
+		if m.Album == "" {
+			m.Album = value
+		}
+	case "DATE", "YEAR":
+		if m.Year == 0 {
+			m.Year = parseYear(value)
+		}
+	}
+}
+
+// setPicture stores cover art, keeping a front cover over any other picture
+func (m *AudioMetadata) setPicture(mimeType string, data []byte, frontCover bool) {
+	if len(data) == 0 || len(data) > maxPictureSize {
+		return
+	}
+	if m.Picture != nil && !frontCover {
+		return
+	}
+
+	// Trust the bytes rather than the declared MIME type
+	if detected := DetectContentType(data); detected != "" {
+		mimeType = detected
+	}
+	m.Picture = &AudioPicture{MIMEType: mimeType, Data: data}
+}
+
+// parseYear extracts a four digit year from dates such as "2021-05-03"
+func parseYear(value string) int {
+	if len(value) < 4 {
+		return 0
+	}
+	year, err := strconv.Atoi(value[:4])
+	if err != nil || year < 1000 {
+		return 0
+	}
+	return year
+}
+
+// decodeLatin1 converts ISO-8859-1 bytes to a string
+func decodeLatin1(b []byte) string {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// decodeUTF16 converts UTF-16 bytes to a string, honouring a byte order mark
+func decodeUTF16(b []byte, bigEndian bool) string {
+	if len(b) >= 2 {
+		switch {
+		case b[0] == 0xFF && b[1] == 0xFE:
+			bigEndian, b = false, b[2:]
+		case b[0] == 0xFE && b[1] == 0xFF:
+			bigEndian, b = true, b[2:]
+		}
+	}
+
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		if bigEndian {
+			units[i] = binary.BigEndian.Uint16(b[2*i:])
+		} else {
+			units[i] = binary.LittleEndian.Uint16(b[2*i:])
+		}
+	}
+	return string(utf16.Decode(units))
+}
+
+// trimNull cuts a string at the first NUL character
+func trimNull(value string) string {
+	if i := strings.IndexByte(value, 0); i >= 0 {
+		value = value[:i]
+	}
+	return strings.TrimSpace(value)
+}
+
+// === WAV ===
+
+// readWAV reads the fmt, data and LIST/INFO chunks of a RIFF WAVE file
+func readWAV(r io.ReaderAt, size int64, meta *AudioMetadata) error {
+	var byteRate uint32
+	var dataSize int64
+	var format uint16
+
+	for off := int64(12); off+8 <= size; {
+		header, err := readAt(r, off, 8)
+		if err != nil {
+			return err
+		}
+		id := string(header[:4])
+		chunkSize := int64(binary.LittleEndian.Uint32(header[4:]))
+		body := off + 8
+
+		switch id {
+		case "fmt ":
+			fmtChunk, err := readAt(r, body, min(chunkSize, 40))
+			if err != nil {
+				return err
+			}
+			if len(fmtChunk) < 16 {
+				return fmt.Errorf("invalid WAV fmt chunk")
+			}
+			format = binary.LittleEndian.Uint16(fmtChunk[0:])
+			meta.Channels = int(binary.LittleEndian.Uint16(fmtChunk[2:]))
+			meta.SampleRate = int(binary.LittleEndian.Uint32(fmtChunk[4:]))
+			byteRate = binary.LittleEndian.Uint32(fmtChunk[8:])
+			// WAVE_FORMAT_EXTENSIBLE stores the real format in the sub-format GUID
+			if format == 0xFFFE && len(fmtChunk) >= 26 {
+				format = binary.LittleEndian.Uint16(fmtChunk[24:])
+			}
+		case "data":
+			dataSize = min(chunkSize, size-body)
+		case "LIST":
+			if err := readRIFFInfo(r, body, min(chunkSize, size-body), meta); err != nil {
+				return err
+			}
+		case "id3 ", "ID3 ":
+			if _, err := readID3v2(r, body, meta); err != nil {
+				return err
+			}
+		}
+
+		off = body + chunkSize + chunkSize%2
+	}
+
+	switch format {
+	case 1:
+		meta.Codec = "pcm"
+	case 3:
+		meta.Codec = "pcm_float"
+	case 0x55:
+		meta.Codec = "mp3"
+	default:
+		meta.Codec = fmt.Sprintf("wav_0x%04x", format)
+	}
+
+	if byteRate > 0 {
+		meta.Bitrate = int(byteRate * 8 / 1000)
+		meta.DurationSeconds = float64(dataSize) / float64(byteRate)
+	}
+	return nil
+}
+
+// readRIFFInfo reads the text fields of a LIST/INFO chunk
+func readRIFFInfo(r io.ReaderAt, off, size int64, meta *AudioMetadata) error {
+	if size < 4 || size > 1<<20 {
+		return nil
+	}
+	list, err := readAt(r, off, size)
+	if err != nil {
+		return err
+	}
+	if string(list[:4]) != "INFO" {
+		return nil
+	}
+
+	keys := map[string]string{"INAM": "TITLE", "IART": "ARTIST", "IPRD": "ALBUM", "ICRD": "DATE"}
+	for i := 4; i+8 <= len(list); {
+		id := string(list[i : i+4])
+		n := int(binary.LittleEndian.Uint32(list[i+4:]))
+		if i+8+n > len(list) {
+			break
+		}
+		if key, ok := keys[id]; ok {
+			meta.setTag(key, trimNull(string(bytes.ToValidUTF8(list[i+8:i+8+n], nil))))
+		}
+		i += 8 + n + n%2
+	}
+	return nil
+}
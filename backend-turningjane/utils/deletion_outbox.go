@@ -0,0 +1,184 @@
+package utils
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	// deletionBatchSize is the number of queued deletions handled per transaction
+	deletionBatchSize = 50
+	// deletionBaseDelay and deletionMaxDelay bound the retry backoff
+	deletionBaseDelay = 30 * time.Second
+	deletionMaxDelay  = 6 * time.Hour
+)
+
+// Execer is implemented by both *sql.DB and *sql.Tx
+type Execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// DeletionOutbox queues storage deletions in the storage_deletions table so
+// files are only removed once the database no longer references them. Rows
+// are written in the same transaction as the song change and processed after
+// commit, failed deletions are retried with exponential backoff.
+type DeletionOutbox struct {
+	DB      *sql.DB
+	Storage Storage
+	wake    chan struct{}
+}
+
+func NewDeletionOutbox(db *sql.DB, storage Storage) *DeletionOutbox {
+	return &DeletionOutbox{
+		DB:      db,
+		Storage: storage,
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// Enqueue records files to delete. Pass the transaction that stops
+// referencing them so the deletion only happens if it commits. URLs that do
+// not belong to the storage driver are ignored.
+func (o *DeletionOutbox) Enqueue(exec Execer, filePaths ...string) error {
+	for _, filePath := range filePaths {
+		if filePath == "" {
+			continue
+		}
+		if _, err := o.Storage.ObjectPath(filePath); err != nil {
+			continue
+		}
+
+		if _, err := exec.Exec("INSERT INTO storage_deletions (file_path) VALUES ($1)", filePath); err != nil {
+			return fmt.Errorf("failed to queue deletion of %s: %v", filePath, err)
+		}
+	}
+	return nil
+}
+
+// Discard queues files outside of any transaction, e.g. uploads of a request
+// whose database change was rolled back, and wakes the worker
+func (o *DeletionOutbox) Discard(filePaths ...string) {
+	if err := o.Enqueue(o.DB, filePaths...); err != nil {
+		// The media garbage collector picks these up later
+		log.Printf("Failed to queue discarded uploads: %v", err)
+	}
+	o.Notify()
+}
+
+// Notify wakes the worker after a transaction with queued deletions commits
+func (o *DeletionOutbox) Notify() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run processes due deletions every interval, or as soon as Notify is called
+func (o *DeletionOutbox) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			processed, err := o.Process(deletionBatchSize)
+			if err != nil {
+				log.Printf("Failed to process storage deletions: %v", err)
+				break
+			}
+			if processed < deletionBatchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-o.wake:
+		}
+	}
+}
+
+// Process deletes up to limit due files and returns how many rows it handled.
+// Rows are locked with SKIP LOCKED so several instances can share the table.
+func (o *DeletionOutbox) Process(limit int) (int, error) {
+	tx, err := o.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT id, file_path, attempts
+		FROM storage_deletions
+		WHERE next_attempt_at <= NOW()
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	`, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	type deletion struct {
+		id       int64
+		filePath string
+		attempts int
+	}
+	var due []deletion
+	for rows.Next() {
+		var d deletion
+		if err := rows.Scan(&d.id, &d.filePath, &d.attempts); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		due = append(due, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, d := range due {
+		var referenced bool
+		if err := tx.QueryRow(mediaReferencedQuery(), d.filePath).Scan(&referenced); err != nil {
+			return 0, err
+		}
+
+		if referenced {
+			// Another row points at the same file again, keep it
+			log.Printf("Skipping deletion of %s, it is still referenced", d.filePath)
+		} else if err := o.Storage.DeleteFile(d.filePath); err != nil && !errors.Is(err, ErrObjectNotFound) {
+			delay := min(deletionBaseDelay<<min(d.attempts, 20), deletionMaxDelay)
+			log.Printf("Error deleting %s (attempt %d, retrying in %s): %v", d.filePath, d.attempts+1, delay, err)
+
+			_, err = tx.Exec(`
+				UPDATE storage_deletions
+				SET attempts = attempts + 1, last_error = $2, next_attempt_at = NOW() + $3 * INTERVAL '1 second'
+				WHERE id = $1
+			`, d.id, err.Error(), int64(delay/time.Second))
+			if err != nil {
+				return 0, err
+			}
+			continue
+		} else {
+			log.Printf("Deleted %s", d.filePath)
+		}
+
+		if _, err := tx.Exec("DELETE FROM storage_deletions WHERE id = $1", d.id); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(due), nil
+}
+
+// mediaReferencedQuery checks whether any media reference equals $1
+func mediaReferencedQuery() string {
+	return `SELECT EXISTS (SELECT 1 FROM (` + strings.Join(mediaReferenceQueries, " UNION ALL ") + `) refs(url) WHERE refs.url = $1)`
+}
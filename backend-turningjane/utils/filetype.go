@@ -0,0 +1,196 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"path/filepath"
+	"strings"
+)
+
+// sniffLength is how many bytes are read from the start of a file to detect its type
+const sniffLength = 512
+
+// FileRule describes which files are accepted for an upload field
+type FileRule struct {
+	Field        string
+	AllowedTypes []string
+	MaxSize      int64
+}
+
+// FieldError is returned when an uploaded file breaks its FileRule
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// extensions maps the detected content types to the extension used for storage
+var extensions = map[string]string{
+	"audio/mpeg": ".mp3",
+	"audio/flac": ".flac",
+	"audio/wav":  ".wav",
+	"audio/ogg":  ".ogg",
+	"audio/mp4":  ".m4a",
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+}
+
+// SongAudioRule returns the rule for the audio_file field, the size cap is
+// configured with MAX_AUDIO_SIZE_MB (default 150 MB)
+func SongAudioRule() FileRule {
+	return FileRule{
+		Field:        "audio_file",
+		AllowedTypes: []string{"audio/mpeg", "audio/flac", "audio/wav", "audio/ogg", "audio/mp4"},
+		MaxSize:      envMegabytes("MAX_AUDIO_SIZE_MB", 150),
+	}
+}
+
+// SongImageRule returns the rule for the image_file field, the size cap is
+// configured with MAX_IMAGE_SIZE_MB (default 10 MB)
+func SongImageRule() FileRule {
+	return FileRule{
+		Field:        "image_file",
+		AllowedTypes: []string{"image/jpeg", "image/png", "image/webp"},
+		MaxSize:      envMegabytes("MAX_IMAGE_SIZE_MB", 10),
+	}
+}
+
+// AlbumCoverRule returns the rule for the cover_file field, it shares the
+// MAX_IMAGE_SIZE_MB cap with song images
+func AlbumCoverRule() FileRule {
+	rule := SongImageRule()
+	rule.Field = "cover_file"
+	return rule
+}
+
+// GalleryPhotoRule returns the rule for the photo_file field, it shares the
+// MAX_IMAGE_SIZE_MB cap with song images
+func GalleryPhotoRule() FileRule {
+	rule := SongImageRule()
+	rule.Field = "photo_file"
+	return rule
+}
+
+// PostCoverRule returns the rule for the cover_file field of news posts, the
+// same as AlbumCoverRule
+func PostCoverRule() FileRule {
+	return AlbumCoverRule()
+}
+
+// Validate sniffs the real content type of the file and checks it against the
+// rule. On success the Content-Type header and the filename extension are
+// rewritten to the detected type, so storage drivers never rely on the values
+// sent by the client.
+func (r FileRule) Validate(fileHeader *multipart.FileHeader) (string, error) {
+	if fileHeader.Size > r.MaxSize {
+		return "", &FieldError{Field: r.Field, Message: fmt.Sprintf("file is larger than %d MB", r.MaxSize>>20)}
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %v", err)
+	}
+	defer file.Close()
+
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", fmt.Errorf("failed to read file: %v", err)
+	}
+
+	contentType := detectFileType(file, fileHeader.Size, head[:n])
+	allowed := false
+	for _, t := range r.AllowedTypes {
+		if t == contentType {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		if contentType == "" {
+			contentType = "unknown"
+		}
+		return "", &FieldError{
+			Field:   r.Field,
+			Message: fmt.Sprintf("file type %s is not allowed, expected one of %s", contentType, strings.Join(r.AllowedTypes, ", ")),
+		}
+	}
+
+	fileHeader.Header.Set("Content-Type", contentType)
+	fileHeader.Filename = strings.TrimSuffix(fileHeader.Filename, filepath.Ext(fileHeader.Filename)) + extensions[contentType]
+	return contentType, nil
+}
+
+// DetectContentType identifies audio and image files from their magic bytes.
+// It returns an empty string when the type is not recognised.
+func DetectContentType(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte("ID3")) || isMPEGFrame(head):
+		return "audio/mpeg"
+	case bytes.HasPrefix(head, []byte("fLaC")):
+		return "audio/flac"
+	case len(head) >= 12 && bytes.HasPrefix(head, []byte("RIFF")) && bytes.Equal(head[8:12], []byte("WAVE")):
+		return "audio/wav"
+	case len(head) >= 12 && bytes.HasPrefix(head, []byte("RIFF")) && bytes.Equal(head[8:12], []byte("WEBP")):
+		return "image/webp"
+	case bytes.HasPrefix(head, []byte("OggS")):
+		return "audio/ogg"
+	case len(head) >= 12 && bytes.Equal(head[4:8], []byte("ftyp")) && isAudioBrand(head[8:12]):
+		return "audio/mp4"
+	case len(head) >= 12 && bytes.Equal(head[4:8], []byte("ftyp")) && isGenericBrand(head[8:12]):
+		return "video/mp4"
+	case bytes.HasPrefix(head, []byte{0xFF, 0xD8, 0xFF}):
+		return "image/jpeg"
+	case bytes.HasPrefix(head, []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1A, '\n'}):
+		return "image/png"
+	}
+	return ""
+}
+
+// isMPEGFrame reports whether head starts with an MPEG audio Layer I-III frame
+// header (ADTS AAC shares the sync word but uses layer bits 00)
+func isMPEGFrame(head []byte) bool {
+	if len(head) < 4 || head[0] != 0xFF || head[1]&0xE0 != 0xE0 {
+		return false
+	}
+	version := (head[1] >> 3) & 0x03
+	layer := (head[1] >> 1) & 0x03
+	bitrate := head[2] >> 4
+	sampleRate := (head[2] >> 2) & 0x03
+	return version != 1 && layer != 0 && bitrate != 0x0F && sampleRate != 0x03
+}
+
+// detectFileType is DetectContentType for a whole file. An MP4 with a
+// generic brand is only audio/mp4 when it has no video track.
+func detectFileType(r io.ReaderAt, size int64, head []byte) string {
+	contentType := DetectContentType(head)
+	if contentType == "video/mp4" && mp4AudioOnly(r, size) {
+		return "audio/mp4"
+	}
+	return contentType
+}
+
+// isAudioBrand reports whether an ISO BMFF major brand is used for audio files
+func isAudioBrand(brand []byte) bool {
+	switch string(brand) {
+	case "M4A ", "M4B ", "M4P ", "F4A ":
+		return true
+	}
+	return false
+}
+
+// isGenericBrand reports whether an ISO BMFF major brand is shared by audio
+// and video files, so the tracks decide what the file is
+func isGenericBrand(brand []byte) bool {
+	switch string(brand) {
+	case "mp42", "mp41", "isom", "iso2", "dash":
+		return true
+	}
+	return false
+}
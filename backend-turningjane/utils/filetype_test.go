@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"slices"
+	"testing"
+)
+
+// mp4Atom builds an atom with a 32-bit size
+func mp4Atom(kind string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	atom := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+	return append(append(atom, kind...), body...)
+}
+
+// mp4Track builds a trak whose hdlr has the given handler type
+func mp4Track(handler string) []byte {
+	hdlr := append(make([]byte, 8), handler...)
+	hdlr = append(hdlr, make([]byte, 13)...)
+	return mp4Atom("trak", mp4Atom("mdia", mp4Atom("hdlr", hdlr)))
+}
+
+func mp4File(brand string, atoms ...[]byte) []byte {
+	ftyp := mp4Atom("ftyp", []byte(brand), make([]byte, 4), []byte(brand))
+	return append(ftyp, bytes.Join(atoms, nil)...)
+}
+
+func TestDetectFileTypeMP4(t *testing.T) {
+	tests := []struct {
+		name string
+		file []byte
+		want string
+	}{
+		{"M4A brand", mp4File("M4A ", mp4Atom("moov", mp4Track("soun"))), "audio/mp4"},
+		{"F4A brand", mp4File("F4A ", mp4Atom("moov", mp4Track("soun"))), "audio/mp4"},
+		{"isom audio only", mp4File("isom", mp4Atom("moov", mp4Track("soun"))), "audio/mp4"},
+		{"mp42 with video", mp4File("mp42", mp4Atom("moov", mp4Track("vide"), mp4Track("soun"))), "video/mp4"},
+		{"dash video only", mp4File("dash", mp4Atom("moov", mp4Track("vide"))), "video/mp4"},
+		{"isom without moov", mp4File("isom", mp4Atom("mdat", make([]byte, 16))), "video/mp4"},
+		{"isom moov after mdat", mp4File("isom", mp4Atom("mdat", make([]byte, 600)), mp4Atom("moov", mp4Track("soun"))), "audio/mp4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			head := tt.file[:min(len(tt.file), sniffLength)]
+			if got := detectFileType(bytes.NewReader(tt.file), int64(len(tt.file)), head); got != tt.want {
+				t.Errorf("detectFileType = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if allowed := SongAudioRule().AllowedTypes; !slices.Contains(allowed, "audio/mp4") || slices.Contains(allowed, "video/mp4") {
+		t.Errorf("audio rule allows %v", allowed)
+	}
+}
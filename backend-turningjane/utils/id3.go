@@ -0,0 +1,400 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// mpegBitrates holds the bitrate tables in kbps indexed by [mpeg1?][layer-1][index]
+var mpegBitrates = [2][3][16]int{
+	// MPEG-2 and MPEG-2.5
+	{
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+	},
+	// MPEG-1
+	{
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448, 0},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, 0},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},
+	},
+}
+
+// mpegSampleRates is indexed by the version bits of the frame header
+var mpegSampleRates = [4][3]int{
+	{11025, 12000, 8000},  // MPEG-2.5
+	{0, 0, 0},             // reserved
+	{22050, 24000, 16000}, // MPEG-2
+	{44100, 48000, 32000}, // MPEG-1
+}
+
+// mpegFrame is a decoded MPEG audio frame header
+type mpegFrame struct {
+	mpeg1           bool
+	layer           int
+	bitrate         int
+	sampleRate      int
+	channels        int
+	padding         bool
+	samplesPerFrame int
+}
+
+// parseMPEGFrame decodes a 4 byte MPEG audio frame header
+func parseMPEGFrame(h []byte) (mpegFrame, bool) {
+	if !isMPEGFrame(h) {
+		return mpegFrame{}, false
+	}
+
+	version := (h[1] >> 3) & 0x03
+	f := mpegFrame{
+		mpeg1:      version == 3,
+		layer:      4 - int((h[1]>>1)&0x03),
+		sampleRate: mpegSampleRates[version][(h[2]>>2)&0x03],
+		padding:    h[2]&0x02 != 0,
+		channels:   2,
+	}
+	if h[3]>>6 == 3 {
+		f.channels = 1
+	}
+
+	table := 0
+	if f.mpeg1 {
+		table = 1
+	}
+	f.bitrate = mpegBitrates[table][f.layer-1][h[2]>>4]
+	if f.bitrate == 0 {
+		// Free-format streams are not supported
+		return mpegFrame{}, false
+	}
+
+	switch {
+	case f.layer == 1:
+		f.samplesPerFrame = 384
+	case f.layer == 3 && !f.mpeg1:
+		f.samplesPerFrame = 576
+	default:
+		f.samplesPerFrame = 1152
+	}
+	return f, true
+}
+
+// size returns the frame length in bytes including the header
+func (f mpegFrame) size() int {
+	padding := 0
+	if f.padding {
+		padding = 1
+	}
+	if f.layer == 1 {
+		return (12*f.bitrate*1000/f.sampleRate + padding) * 4
+	}
+	return f.samplesPerFrame/8*f.bitrate*1000/f.sampleRate + padding
+}
+
+// sideInfoSize returns the Layer III side information length, which is where
+// the Xing/Info header starts after the frame header
+func (f mpegFrame) sideInfoSize() int {
+	switch {
+	case f.mpeg1 && f.channels == 1:
+		return 17
+	case f.mpeg1:
+		return 32
+	case f.channels == 1:
+		return 9
+	default:
+		return 17
+	}
+}
+
+// findMPEGFrame searches for the first valid frame at or after off. A frame
+// is only accepted when another valid header follows it, so stray sync words
+// inside leftover tag data are skipped.
+func findMPEGFrame(r io.ReaderAt, off, size int64) (int64, mpegFrame, error) {
+	const window = 64 << 10
+
+	buf := make([]byte, window+4)
+	for start := off; start < size && start < off+1<<20; start += window {
+		n, _ := r.ReadAt(buf, start)
+		for i := 0; i+4 <= n; i++ {
+			frame, ok := parseMPEGFrame(buf[i : i+4])
+			if !ok {
+				continue
+			}
+			next := make([]byte, 4)
+			pos := start + int64(i)
+			if _, err := r.ReadAt(next, pos+int64(frame.size())); err == nil {
+				if _, ok := parseMPEGFrame(next); !ok {
+					continue
+				}
+			}
+			return pos, frame, nil
+		}
+	}
+	return 0, mpegFrame{}, fmt.Errorf("no MPEG audio frame found")
+}
+
+// readMP3 reads the ID3 tags and the first frame of an MPEG audio file
+func readMP3(r io.ReaderAt, size int64, meta *AudioMetadata) error {
+	audioStart, err := readID3v2(r, 0, meta)
+	if err != nil {
+		return err
+	}
+
+	// Some FLAC files are prefixed with an ID3v2 tag
+	if magic, err := readAt(r, audioStart, 4); err == nil && string(magic) == "fLaC" {
+		return readFLAC(r, audioStart, meta)
+	}
+
+	audioEnd := size
+	if hasV1, err := readID3v1(r, size, meta); err != nil {
+		return err
+	} else if hasV1 {
+		audioEnd -= 128
+	}
+
+	pos, frame, err := findMPEGFrame(r, audioStart, audioEnd)
+	if err != nil {
+		return err
+	}
+
+	meta.SampleRate = frame.sampleRate
+	meta.Channels = frame.channels
+	meta.Codec = fmt.Sprintf("mp%d", frame.layer)
+
+	// VBR files carry the total frame count in a Xing/Info or VBRI header
+	if frames := readVBRFrames(r, pos, frame); frames > 0 {
+		meta.DurationSeconds = float64(frames) * float64(frame.samplesPerFrame) / float64(frame.sampleRate)
+		return nil
+	}
+
+	meta.Bitrate = frame.bitrate
+	meta.DurationSeconds = float64(audioEnd-pos) * 8 / float64(frame.bitrate*1000)
+	return nil
+}
+
+// readVBRFrames returns the frame count from a Xing/Info or VBRI header.
+// Xing follows the side info, VBRI always starts 32 bytes after the frame
+// header and keeps the frame count at offset 14.
+func readVBRFrames(r io.ReaderAt, pos int64, frame mpegFrame) int {
+	const (
+		xingLength = 12
+		vbriOffset = 4 + 32
+		vbriLength = 18
+	)
+
+	buf, err := readAt(r, pos, max(int64(4+frame.sideInfoSize()+xingLength), vbriOffset+vbriLength))
+	if err != nil {
+		return 0
+	}
+
+	xing := buf[4+frame.sideInfoSize():]
+	if bytes.HasPrefix(xing, []byte("Xing")) || bytes.HasPrefix(xing, []byte("Info")) {
+		flags := binary.BigEndian.Uint32(xing[4:])
+		if flags&0x01 != 0 {
+			return int(binary.BigEndian.Uint32(xing[8:]))
+		}
+		return 0
+	}
+
+	vbri := buf[vbriOffset:]
+	if bytes.HasPrefix(vbri, []byte("VBRI")) {
+		return int(binary.BigEndian.Uint32(vbri[14:]))
+	}
+	return 0
+}
+
+// syncsafe decodes a 28 bit ID3v2 syncsafe integer
+func syncsafe(b []byte) int64 {
+	return int64(b[0]&0x7F)<<21 | int64(b[1]&0x7F)<<14 | int64(b[2]&0x7F)<<7 | int64(b[3]&0x7F)
+}
+
+// removeUnsync reverses ID3v2 unsynchronisation (0xFF 0x00 -> 0xFF)
+func removeUnsync(b []byte) []byte {
+	return bytes.ReplaceAll(b, []byte{0xFF, 0x00}, []byte{0xFF})
+}
+
+// readID3v2 parses an ID3v2.2/2.3/2.4 tag at off and returns the offset right
+// after it. When there is no tag off is returned unchanged.
+func readID3v2(r io.ReaderAt, off int64, meta *AudioMetadata) (int64, error) {
+	header, err := readAt(r, off, 10)
+	if err != nil || string(header[:3]) != "ID3" {
+		return off, nil
+	}
+
+	major := header[3]
+	flags := header[5]
+	tagSize := syncsafe(header[6:10])
+	end := off + 10 + tagSize
+	if flags&0x10 != 0 {
+		end += 10 // footer
+	}
+	if major < 2 || major > 4 {
+		return end, nil
+	}
+
+	tag, err := readAt(r, off+10, tagSize)
+	if err != nil {
+		return end, nil
+	}
+	if flags&0x80 != 0 && major < 4 {
+		tag = removeUnsync(tag)
+	}
+
+	// Skip the extended header
+	if flags&0x40 != 0 && len(tag) >= 4 {
+		skip := int64(binary.BigEndian.Uint32(tag)) + 4
+		if major == 4 {
+			skip = syncsafe(tag)
+		}
+		if skip > int64(len(tag)) {
+			return end, nil
+		}
+		tag = tag[skip:]
+	}
+
+	idLen, headerLen := 4, 10
+	if major == 2 {
+		idLen, headerLen = 3, 6
+	}
+
+	for len(tag) >= headerLen && tag[0] != 0 {
+		id := string(tag[:idLen])
+		var frameSize int64
+		var formatFlags byte
+		unsupported := false
+		switch major {
+		case 2:
+			frameSize = int64(tag[3])<<16 | int64(tag[4])<<8 | int64(tag[5])
+		case 3:
+			frameSize = int64(binary.BigEndian.Uint32(tag[4:]))
+			unsupported = tag[9]&0xC0 != 0
+		case 4:
+			frameSize = syncsafe(tag[4:])
+			formatFlags = tag[9]
+			unsupported = formatFlags&0x0C != 0
+		}
+		if frameSize <= 0 || frameSize > int64(len(tag)-headerLen) {
+			break
+		}
+
+		data := tag[headerLen : int64(headerLen)+frameSize]
+		tag = tag[int64(headerLen)+frameSize:]
+
+		// Compressed or encrypted frames are not supported
+		if unsupported {
+			continue
+		}
+
+		// ID3v2.4 frame flags: data length indicator and unsynchronisation
+		if formatFlags&0x01 != 0 && len(data) >= 4 {
+			data = data[4:]
+		}
+		if formatFlags&0x02 != 0 {
+			data = removeUnsync(data)
+		}
+
+		readID3Frame(id, data, meta)
+	}
+
+	return end, nil
+}
+
+// id3TextFrames maps ID3v2 text frame IDs to tag keys
+var id3TextFrames = map[string]string{
+	"TIT2": "TITLE", "TT2": "TITLE",
+	"TPE1": "ARTIST", "TP1": "ARTIST",
+	"TPE2": "ALBUMARTIST", "TP2": "ALBUMARTIST",
+	"TALB": "ALBUM", "TAL": "ALBUM",
+	"TYER": "YEAR", "TYE": "YEAR",
+	"TDRC": "DATE", "TDOR": "DATE", "TORY": "YEAR",
+}
+
+// readID3Frame decodes a single text or picture frame
+func readID3Frame(id string, data []byte, meta *AudioMetadata) {
+	if len(data) < 2 {
+		return
+	}
+
+	if key, ok := id3TextFrames[id]; ok {
+		// Multiple values are NUL separated, keep the first one
+		meta.setTag(key, trimNull(decodeID3Text(data[0], data[1:])))
+		return
+	}
+
+	switch id {
+	case "APIC":
+		encoding := data[0]
+		rest := data[1:]
+		i := bytes.IndexByte(rest, 0)
+		if i < 0 || i+2 > len(rest) {
+			return
+		}
+		mimeType := strings.ToLower(decodeLatin1(rest[:i]))
+		pictureType := rest[i+1]
+		picture := skipID3String(encoding, rest[i+2:])
+		meta.setPicture(mimeType, picture, pictureType == 3)
+	case "PIC":
+		if len(data) < 5 {
+			return
+		}
+		encoding := data[0]
+		mimeType := "image/" + strings.ToLower(string(data[1:4]))
+		pictureType := data[4]
+		picture := skipID3String(encoding, data[5:])
+		meta.setPicture(mimeType, picture, pictureType == 3)
+	}
+}
+
+// decodeID3Text decodes text with the ID3v2 encoding byte
+func decodeID3Text(encoding byte, b []byte) string {
+	switch encoding {
+	case 1:
+		return decodeUTF16(b, false)
+	case 2:
+		return decodeUTF16(b, true)
+	case 3:
+		return string(bytes.ToValidUTF8(b, nil))
+	default:
+		return decodeLatin1(b)
+	}
+}
+
+// skipID3String skips a NUL terminated string in the given encoding
+func skipID3String(encoding byte, b []byte) []byte {
+	if encoding == 1 || encoding == 2 {
+		for i := 0; i+1 < len(b); i += 2 {
+			if b[i] == 0 && b[i+1] == 0 {
+				return b[i+2:]
+			}
+		}
+		return nil
+	}
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		return b[i+1:]
+	}
+	return nil
+}
+
+// readID3v1 reads the 128 byte ID3v1 tag at the end of the file. Values only
+// fill fields the ID3v2 tag left empty.
+func readID3v1(r io.ReaderAt, size int64, meta *AudioMetadata) (bool, error) {
+	if size < 128 {
+		return false, nil
+	}
+	tag, err := readAt(r, size-128, 128)
+	if err != nil {
+		return false, err
+	}
+	if string(tag[:3]) != "TAG" {
+		return false, nil
+	}
+
+	meta.setTag("TITLE", trimNull(decodeLatin1(tag[3:33])))
+	meta.setTag("ARTIST", trimNull(decodeLatin1(tag[33:63])))
+	meta.setTag("ALBUM", trimNull(decodeLatin1(tag[63:93])))
+	meta.setTag("YEAR", trimNull(decodeLatin1(tag[93:97])))
+	return true, nil
+}
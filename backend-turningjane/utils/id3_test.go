@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// mp3FrameHeader is MPEG-1 Layer III, 128 kbps, 44.1 kHz, joint stereo
+var mp3FrameHeader = []byte{0xFF, 0xFB, 0x90, 0x64}
+
+// mp3FrameLength is the length of a frame with mp3FrameHeader
+const mp3FrameLength = 144 * 128000 / 44100
+
+// vbriFrame builds the first frame of a Fraunhofer encoded VBR file: the
+// VBRI header starts 32 bytes after the frame header
+func vbriFrame(frames uint32) []byte {
+	frame := make([]byte, mp3FrameLength)
+	copy(frame, mp3FrameHeader)
+
+	vbri := []byte("VBRI")
+	vbri = binary.BigEndian.AppendUint16(vbri, 1)                // version
+	vbri = binary.BigEndian.AppendUint16(vbri, 0x3C00)           // encoder delay
+	vbri = binary.BigEndian.AppendUint16(vbri, 75)               // quality
+	vbri = binary.BigEndian.AppendUint32(vbri, 4096000)          // stream size in bytes
+	vbri = binary.BigEndian.AppendUint32(vbri, frames)           // frame count
+	vbri = binary.BigEndian.AppendUint16(vbri, 4)                // TOC entries
+	vbri = binary.BigEndian.AppendUint16(vbri, 1)                // TOC scale
+	vbri = binary.BigEndian.AppendUint16(vbri, 2)                // bytes per TOC entry
+	vbri = binary.BigEndian.AppendUint16(vbri, uint16(frames/4)) // frames per TOC entry
+	for i := 0; i < 4; i++ {
+		vbri = binary.BigEndian.AppendUint16(vbri, 1024)
+	}
+	copy(frame[4+32:], vbri)
+	return frame
+}
+
+// xingFrame builds the first frame of a LAME encoded VBR file: the Xing
+// header follows the 32 byte side info
+func xingFrame(frames uint32) []byte {
+	frame := make([]byte, mp3FrameLength)
+	copy(frame, mp3FrameHeader)
+
+	xing := []byte("Xing")
+	xing = binary.BigEndian.AppendUint32(xing, 0x01) // frame count present
+	xing = binary.BigEndian.AppendUint32(xing, frames)
+	copy(frame[4+32:], xing)
+	return frame
+}
+
+func mp3Stream(first []byte, frames int) []byte {
+	stream := append([]byte(nil), first...)
+	for i := 0; i < frames; i++ {
+		frame := make([]byte, mp3FrameLength)
+		copy(frame, mp3FrameHeader)
+		stream = append(stream, frame...)
+	}
+	return stream
+}
+
+func TestReadMP3VBRHeaders(t *testing.T) {
+	tests := []struct {
+		name  string
+		first []byte
+	}{
+		{"VBRI", vbriFrame(1000)},
+		{"Xing", xingFrame(1000)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream := mp3Stream(tt.first, 3)
+			meta, err := ReadAudioMetadata(bytes.NewReader(stream), int64(len(stream)))
+			if err != nil {
+				t.Fatalf("ReadAudioMetadata: %v", err)
+			}
+
+			want := 1000 * 1152 / 44100.0
+			if math.Abs(meta.DurationSeconds-want) > 0.001 {
+				t.Errorf("duration = %v, want %v", meta.DurationSeconds, want)
+			}
+			if meta.SampleRate != 44100 || meta.Codec != "mp3" {
+				t.Errorf("sample rate %d, codec %s", meta.SampleRate, meta.Codec)
+			}
+		})
+	}
+}
+
+func TestReadVBRFramesShortFile(t *testing.T) {
+	frame, _ := parseMPEGFrame(mp3FrameHeader)
+
+	// A VBRI tag cut off before the frame count must not be read past its end
+	truncated := vbriFrame(1000)[:4+32+16]
+	if frames := readVBRFrames(bytes.NewReader(truncated), 0, frame); frames != 0 {
+		t.Errorf("frames = %d from a truncated VBRI header", frames)
+	}
+}
@@ -0,0 +1,179 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"mime/multipart"
+	"path"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// ImageVariantWidths are the widths generated for every song image. Images
+// are never upscaled, smaller sources reuse their own size for larger widths.
+var ImageVariantWidths = []int{150, 600, 1200}
+
+// imageVariantQuality is the JPEG quality of the resized variants
+const imageVariantQuality = 85
+
+// maxImagePixels limits the size of images decoded for the variants. A small
+// file can declare huge dimensions, and decoding allocates 4 bytes per pixel.
+const maxImagePixels = 40_000_000
+
+// ImageVariants maps a variant name to its public URL. "600" is the 600 px
+// JPEG (PNG for transparent images) and "600_webp" the same size as WebP.
+// The WebP encoder is lossless, so the WebP variant is usually only present
+// for graphics; photos are smaller as JPEG and have no WebP variant.
+type ImageVariants map[string]string
+
+// uploadSongImageFile reads an uploaded image and stores it with its variants
+func uploadSongImageFile(s Storage, folder string, fileHeader *multipart.FileHeader) (publicURL string, variants ImageVariants, err error) {
+	file, err := openUpload(fileHeader)
+	if err != nil {
+		return "", nil, err
+	}
+	defer func() { file.finish(err) }()
+
+	// Images are small enough to decode from memory
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read file: %v", err)
+	}
+
+	return uploadSongImage(s, folder, data, fileHeader.Header.Get("Content-Type"))
+}
+
+// uploadSongImage stores the original image in folder followed by its resized
+// JPEG/PNG and WebP variants. A failure while building the variants is logged
+// and leaves the song with the original image only.
+func uploadSongImage(s Storage, folder string, data []byte, contentType string) (string, ImageVariants, error) {
+	objectPath := objectName(folder, contentType)
+	publicURL, err := s.PutObject(objectPath, bytes.NewReader(data), int64(len(data)), contentType)
+	if err != nil {
+		return "", nil, err
+	}
+
+	variants, err := uploadImageVariants(s, objectPath, data)
+	if err != nil {
+		log.Printf("Failed to create image variants for %s: %v", objectPath, err)
+		return publicURL, nil, nil
+	}
+	return publicURL, variants, nil
+}
+
+// uploadImageVariants resizes the image to every ImageVariantWidths entry and
+// stores the results next to objectPath, e.g. song_images/<id>_600.webp
+func uploadImageVariants(s Storage, objectPath string, data []byte) (ImageVariants, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %v", err)
+	}
+	if config.Width < 1 || config.Height < 1 || int64(config.Width)*int64(config.Height) > maxImagePixels {
+		return nil, fmt.Errorf("image size %dx%d is not supported", config.Width, config.Height)
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %v", err)
+	}
+
+	// Transparent images keep their alpha channel as PNG
+	ext, contentType := ".jpg", "image/jpeg"
+	if opaque, ok := src.(interface{ Opaque() bool }); ok && !opaque.Opaque() {
+		ext, contentType = ".png", "image/png"
+	}
+
+	base := strings.TrimSuffix(objectPath, path.Ext(objectPath))
+	variants := ImageVariants{}
+	stored := map[int][2]string{} // target width -> [original format URL, WebP URL]
+	for _, width := range ImageVariantWidths {
+		target := min(width, src.Bounds().Dx())
+		urls, ok := stored[target]
+		if !ok {
+			urls, err = uploadImageVariant(s, fmt.Sprintf("%s_%d", base, target), resizeImage(src, target), ext, contentType)
+			if err != nil {
+				// Remove what was already stored
+				DeleteImageVariants(s, variants)
+				return nil, err
+			}
+			stored[target] = urls
+		}
+
+		name := strconv.Itoa(width)
+		variants[name] = urls[0]
+		if urls[1] != "" {
+			variants[name+"_webp"] = urls[1]
+		}
+	}
+	return variants, nil
+}
+
+// uploadImageVariant stores one resized image in its original format and as
+// WebP. The WebP encoder is lossless, so photos often come out larger than
+// the JPEG; the WebP copy is only stored (and its URL returned) when it is
+// smaller.
+func uploadImageVariant(s Storage, base string, img image.Image, ext, contentType string) ([2]string, error) {
+	var urls [2]string
+
+	var buf bytes.Buffer
+	var err error
+	if contentType == "image/png" {
+		err = png.Encode(&buf, img)
+	} else {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: imageVariantQuality})
+	}
+	if err != nil {
+		return urls, fmt.Errorf("failed to encode variant: %v", err)
+	}
+	urls[0], err = s.PutObject(base+ext, bytes.NewReader(buf.Bytes()), int64(buf.Len()), contentType)
+	if err != nil {
+		return urls, err
+	}
+
+	var webp bytes.Buffer
+	if err := EncodeWebP(&webp, img); err != nil {
+		_ = s.DeleteFile(urls[0])
+		return urls, fmt.Errorf("failed to encode WebP variant: %v", err)
+	}
+	if webp.Len() >= buf.Len() {
+		return urls, nil
+	}
+	urls[1], err = s.PutObject(base+".webp", &webp, int64(webp.Len()), "image/webp")
+	if err != nil {
+		_ = s.DeleteFile(urls[0])
+		return urls, err
+	}
+	return urls, nil
+}
+
+// resizeImage scales src to width pixels wide keeping its aspect ratio
+func resizeImage(src image.Image, width int) *image.NRGBA {
+	bounds := src.Bounds()
+	height := max(1, (bounds.Dy()*width+bounds.Dx()/2)/bounds.Dx())
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Src, nil)
+	return dst
+}
+
+// DeleteImageVariants removes every variant file, URLs shared by several
+// widths are only deleted once
+func DeleteImageVariants(s Storage, variants ImageVariants) {
+	deleted := map[string]bool{}
+	for _, url := range variants {
+		if deleted[url] {
+			continue
+		}
+		deleted[url] = true
+		if err := s.DeleteFile(url); err != nil {
+			log.Printf("Error deleting image variant %s: %v", url, err)
+		}
+	}
+}
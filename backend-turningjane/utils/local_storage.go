@@ -0,0 +1,228 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"mime/multipart"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// LocalStorageConfig stores files on the local filesystem. It is meant for
+// development machines and CI where no Supabase bucket is available.
+type LocalStorageConfig struct {
+	RootDir     string
+	BaseURL     string
+	ImageFolder string
+	AudioFolder string
+}
+
+// NewLocalStorageConfig creates a new LocalStorageConfig instance
+func NewLocalStorageConfig() *LocalStorageConfig {
+	rootDir := os.Getenv("LOCAL_STORAGE_DIR")
+	if rootDir == "" {
+		rootDir = "./uploads"
+	}
+
+	baseURL := os.Getenv("LOCAL_STORAGE_URL")
+	if baseURL == "" {
+		baseURL = "http://127.0.0.1:3000/media"
+	}
+
+	return &LocalStorageConfig{
+		RootDir:     rootDir,
+		BaseURL:     strings.TrimRight(baseURL, "/"),
+		ImageFolder: "song_images",
+		AudioFolder: "song_audio",
+	}
+}
+
+// MountPath returns the URL path the router should serve RootDir from
+func (c *LocalStorageConfig) MountPath() string {
+	parsed, err := url.Parse(c.BaseURL)
+	if err != nil || parsed.Path == "" {
+		return "/media"
+	}
+	return parsed.Path
+}
+
+// resolve turns an object path into a filesystem path inside RootDir
+func (c *LocalStorageConfig) resolve(objectPath string) (string, error) {
+	cleaned := path.Clean("/" + objectPath)
+	if cleaned == "/" {
+		return "", fmt.Errorf("invalid file path format: %s", objectPath)
+	}
+	return filepath.Join(c.RootDir, filepath.FromSlash(cleaned)), nil
+}
+
+// ObjectPath extracts the object path from a public URL
+func (c *LocalStorageConfig) ObjectPath(filePath string) (string, error) {
+	if !strings.HasPrefix(filePath, c.BaseURL+"/") {
+		return "", fmt.Errorf("invalid file path format: %s", filePath)
+	}
+	return strings.TrimPrefix(filePath, c.BaseURL+"/"), nil
+}
+
+// UploadFile streams a file into RootDir/folder
+func (c *LocalStorageConfig) UploadFile(fileHeader *multipart.FileHeader, folder string) (publicURL string, err error) {
+	file, err := openUpload(fileHeader)
+	if err != nil {
+		return "", err
+	}
+	defer func() { file.finish(err) }()
+
+	// Generate unique filename
+	objectPath := fmt.Sprintf("%s/%s%s", folder, uuid.New().String(), filepath.Ext(fileHeader.Filename))
+
+	return c.PutObject(objectPath, file, fileHeader.Size, fileHeader.Header.Get("Content-Type"))
+}
+
+// PutObject writes body to objectPath, replacing any existing file
+func (c *LocalStorageConfig) PutObject(objectPath string, body io.Reader, size int64, contentType string) (string, error) {
+	target, err := c.resolve(objectPath)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return "", fileError("upload", err)
+	}
+
+	out, err := os.Create(target)
+	if err != nil {
+		return "", fileError("upload", err)
+	}
+
+	if _, err := copyBuffered(out, body); err != nil {
+		out.Close()
+		os.Remove(target)
+		return "", fileError("upload", err)
+	}
+
+	if err := out.Close(); err != nil {
+		os.Remove(target)
+		return "", fileError("upload", err)
+	}
+
+	return c.PublicURL(objectPath), nil
+}
+
+// UploadSongImage stores a song image and its variants on the local filesystem
+func (c *LocalStorageConfig) UploadSongImage(fileHeader *multipart.FileHeader) (string, ImageVariants, error) {
+	return uploadSongImageFile(c, c.ImageFolder, fileHeader)
+}
+
+// UploadImage stores an image and its variants into folder on the local filesystem
+func (c *LocalStorageConfig) UploadImage(fileHeader *multipart.FileHeader, folder string) (string, ImageVariants, error) {
+	return uploadSongImageFile(c, folder, fileHeader)
+}
+
+// UploadSongAudio stores a song audio file on the local filesystem
+func (c *LocalStorageConfig) UploadSongAudio(fileHeader *multipart.FileHeader) (string, error) {
+	return c.UploadFile(fileHeader, c.AudioFolder)
+}
+
+// UploadSongImageData stores an in-memory song image, such as embedded cover art, and its variants
+func (c *LocalStorageConfig) UploadSongImageData(data []byte, contentType string) (string, ImageVariants, error) {
+	return uploadSongImage(c, c.ImageFolder, data, contentType)
+}
+
+// DeleteFile removes a file from the local filesystem
+func (c *LocalStorageConfig) DeleteFile(filePath string) error {
+	objectPath, err := c.ObjectPath(filePath)
+	if err != nil {
+		return err
+	}
+
+	target, err := c.resolve(objectPath)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(target); err != nil {
+		return fileError("delete", err)
+	}
+
+	return nil
+}
+
+// StatFile returns information about a file on the local filesystem
+func (c *LocalStorageConfig) StatFile(filePath string) (*FileInfo, error) {
+	objectPath, err := c.ObjectPath(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := c.resolve(objectPath)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := os.Stat(target)
+	if err != nil {
+		return nil, fileError("stat", err)
+	}
+
+	return &FileInfo{
+		Path:         objectPath,
+		Size:         stat.Size(),
+		ContentType:  mime.TypeByExtension(filepath.Ext(target)),
+		LastModified: stat.ModTime(),
+	}, nil
+}
+
+// ListObjects walks RootDir/prefix and returns every file below it
+func (c *LocalStorageConfig) ListObjects(prefix string) ([]FileInfo, error) {
+	root, err := c.resolve(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []FileInfo
+	err = filepath.WalkDir(root, func(target string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && target == root {
+				// Nothing has been uploaded to this folder yet
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		relative, err := filepath.Rel(c.RootDir, target)
+		if err != nil {
+			return err
+		}
+
+		objects = append(objects, FileInfo{
+			Path:         filepath.ToSlash(relative),
+			Size:         info.Size(),
+			ContentType:  mime.TypeByExtension(filepath.Ext(target)),
+			LastModified: info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fileError("list", err)
+	}
+
+	return objects, nil
+}
+
+// PublicURL builds the URL the file is served from
+func (c *LocalStorageConfig) PublicURL(objectPath string) string {
+	return fmt.Sprintf("%s/%s", c.BaseURL, objectPath)
+}
@@ -0,0 +1,155 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxLyricsSize caps the size of plain and LRC lyrics
+const MaxLyricsSize = 256 << 10
+
+var (
+	// lrcTimestamp matches [mm:ss], [mm:ss.x], [mm:ss.xx], [mm:ss.xxx] and the
+	// [mm:ss:xx] variant written by some editors
+	lrcTimestamp = regexp.MustCompile(`^\[(\d{1,3}):(\d{2})(?:[.:](\d{1,3}))?\]`)
+	// lrcTag matches metadata tags such as [ar:Artist] or [offset:+250]
+	lrcTag = regexp.MustCompile(`^\[([a-zA-Z#]+):(.*)\]$`)
+	// lrcWordTimestamp matches the per-word <mm:ss.xx> marks of enhanced LRC
+	lrcWordTimestamp = regexp.MustCompile(`<\d{1,3}:\d{2}(?:[.:]\d{1,3})?>`)
+)
+
+// LRCLine is one timed lyric line
+type LRCLine struct {
+	// TimeMs is when the line starts, with the [offset] tag applied
+	TimeMs int64
+	Text   string
+}
+
+// LRC is a parsed LRC file
+type LRC struct {
+	// Metadata holds the ID tags, e.g. "ar", "ti", "al", "by" and "length"
+	Metadata map[string]string
+	// Lines are sorted by time. A line with several timestamps, such as a
+	// repeated chorus, appears once per timestamp.
+	Lines []LRCLine
+}
+
+// LRCError reports an invalid line of an LRC file
+type LRCError struct {
+	Line    int
+	Message string
+}
+
+func (e *LRCError) Error() string {
+	if e.Line == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+// ParseLRC parses and validates LRC lyrics. Every non-empty line must be a
+// metadata tag or start with at least one timestamp, and the file needs at
+// least one timed line.
+func ParseLRC(source string) (*LRC, error) {
+	if len(source) > MaxLyricsSize {
+		return nil, &LRCError{Message: fmt.Sprintf("lyrics are larger than %d KB", MaxLyricsSize>>10)}
+	}
+	if !utf8.ValidString(source) {
+		return nil, &LRCError{Message: "lyrics must be UTF-8 encoded"}
+	}
+
+	lrc := &LRC{Metadata: map[string]string{}}
+	var offset int64
+
+	source = strings.TrimPrefix(source, "\ufeff")
+	for i, raw := range strings.Split(source, "\n") {
+		lineNumber := i + 1
+		line := strings.TrimSpace(strings.TrimSuffix(raw, "\r"))
+		if line == "" {
+			continue
+		}
+
+		if !lrcTimestamp.MatchString(line) {
+			tag := lrcTag.FindStringSubmatch(line)
+			if tag == nil {
+				return nil, &LRCError{Line: lineNumber, Message: "expected a [mm:ss.xx] timestamp or a [tag:value] line"}
+			}
+
+			key, value := strings.ToLower(tag[1]), strings.TrimSpace(tag[2])
+			if key == "offset" {
+				parsed, err := strconv.ParseInt(strings.TrimPrefix(value, "+"), 10, 64)
+				if err != nil {
+					return nil, &LRCError{Line: lineNumber, Message: fmt.Sprintf("invalid offset %q", value)}
+				}
+				offset = parsed
+			}
+			lrc.Metadata[key] = value
+			continue
+		}
+
+		// Satu baris boleh memiliki beberapa timestamp, contoh [00:12.00][01:30.00]
+		var times []int64
+		for {
+			match := lrcTimestamp.FindStringSubmatch(line)
+			if match == nil {
+				break
+			}
+
+			ms, err := lrcTime(match[1], match[2], match[3])
+			if err != nil {
+				return nil, &LRCError{Line: lineNumber, Message: err.Error()}
+			}
+			times = append(times, ms)
+			line = line[len(match[0]):]
+		}
+
+		text := strings.TrimSpace(lrcWordTimestamp.ReplaceAllString(line, ""))
+		for _, ms := range times {
+			lrc.Lines = append(lrc.Lines, LRCLine{TimeMs: ms, Text: text})
+		}
+	}
+
+	if len(lrc.Lines) == 0 {
+		return nil, &LRCError{Message: "lyrics contain no timed lines"}
+	}
+
+	// A positive offset makes the lyrics appear sooner
+	for i := range lrc.Lines {
+		lrc.Lines[i].TimeMs = max(0, lrc.Lines[i].TimeMs-offset)
+	}
+	sort.SliceStable(lrc.Lines, func(i, j int) bool { return lrc.Lines[i].TimeMs < lrc.Lines[j].TimeMs })
+
+	return lrc, nil
+}
+
+// lrcTime converts the parts of a timestamp to milliseconds
+func lrcTime(minutes, seconds, fraction string) (int64, error) {
+	m, _ := strconv.ParseInt(minutes, 10, 64)
+	s, _ := strconv.ParseInt(seconds, 10, 64)
+	if s >= 60 {
+		return 0, fmt.Errorf("invalid timestamp %s:%s, seconds must be below 60", minutes, seconds)
+	}
+
+	// .5 is 500 ms, .05 is 50 ms and .005 is 5 ms
+	var ms int64
+	if fraction != "" {
+		ms, _ = strconv.ParseInt((fraction + "00")[:3], 10, 64)
+	}
+	return m*60_000 + s*1000 + ms, nil
+}
+
+// PlainText returns the lyric lines in order without timestamps. Lines shared
+// by several timestamps are repeated, instrumental breaks are dropped.
+func (l *LRC) PlainText() string {
+	var lines []string
+	for _, line := range l.Lines {
+		if line.Text != "" {
+			lines = append(lines, line.Text)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
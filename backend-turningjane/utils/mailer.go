@@ -0,0 +1,192 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer is the common interface implemented by every email driver
+type Mailer interface {
+	// Send delivers the message or returns an error
+	Send(msg Message) error
+}
+
+// NewMailer creates the email driver selected by the MAIL_DRIVER environment
+// variable ("smtp" or "log"). There is no default: the log driver never
+// delivers email, so it has to be chosen explicitly.
+func NewMailer() (Mailer, error) {
+	driver := strings.ToLower(os.Getenv("MAIL_DRIVER"))
+	switch driver {
+	case "smtp":
+		return NewSMTPMailer(), nil
+	case "log":
+		log.Printf("WARNING: MAIL_DRIVER=log, emails are written to the log and never delivered")
+		return NewLogMailer(), nil
+	case "":
+		return nil, fmt.Errorf("MAIL_DRIVER is not set, use smtp or log")
+	default:
+		return nil, fmt.Errorf("unknown MAIL_DRIVER %q, use smtp or log", driver)
+	}
+}
+
+// mailFrom returns the sender address from MAIL_FROM
+func mailFrom() string {
+	if from := os.Getenv("MAIL_FROM"); from != "" {
+		return from
+	}
+	return "Turning Jane <no-reply@turningjane.local>"
+}
+
+// SMTPMailer sends email through an SMTP server, using STARTTLS when the
+// server offers it
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// NewSMTPMailer creates a new SMTPMailer from the SMTP_* environment variables
+func NewSMTPMailer() *SMTPMailer {
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+
+	return &SMTPMailer{
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     port,
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     mailFrom(),
+	}
+}
+
+// Send delivers the message to the SMTP server
+func (m *SMTPMailer) Send(msg Message) error {
+	if m.Host == "" {
+		return fmt.Errorf("SMTP_HOST is not configured")
+	}
+
+	raw, err := buildMessage(m.From, msg)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	return smtp.SendMail(net.JoinHostPort(m.Host, m.Port), auth, envelopeAddress(m.From), []string{envelopeAddress(msg.To)}, raw)
+}
+
+// LogMailer writes email to the log, or appends it to MAIL_LOG_FILE when set.
+// It is meant for development machines and CI without an SMTP server.
+type LogMailer struct {
+	Path string
+	From string
+
+	mu sync.Mutex
+}
+
+// NewLogMailer creates a new LogMailer instance
+func NewLogMailer() *LogMailer {
+	return &LogMailer{
+		Path: os.Getenv("MAIL_LOG_FILE"),
+		From: mailFrom(),
+	}
+}
+
+// Send writes the message to the log or the mail file. The body is written
+// as is so links can be copied from it.
+func (m *LogMailer) Send(msg Message) error {
+	raw := fmt.Sprintf("From: %s\nTo: %s\nSubject: %s\nDate: %s\n\n%s",
+		m.From, msg.To, msg.Subject, time.Now().Format(time.RFC1123Z), msg.Body)
+
+	if m.Path == "" {
+		log.Printf("Email to %s:\n%s", msg.To, raw)
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	file, err := os.OpenFile(m.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open mail file: %v", err)
+	}
+	defer file.Close()
+
+	if _, err := fmt.Fprintf(file, "%s\n\n", raw); err != nil {
+		return fmt.Errorf("failed to write mail file: %v", err)
+	}
+	return nil
+}
+
+// envelopeAddress extracts the bare address from "Name <address>"
+func envelopeAddress(address string) string {
+	if start := strings.LastIndex(address, "<"); start >= 0 {
+		if end := strings.LastIndex(address, ">"); end > start {
+			return address[start+1 : end]
+		}
+	}
+	return strings.TrimSpace(address)
+}
+
+// buildMessage renders msg as an RFC 5322 message with a quoted-printable
+// UTF-8 body
+func buildMessage(from string, msg Message) ([]byte, error) {
+	// Header tidak boleh berisi baris baru agar tidak bisa disisipi header lain
+	for _, value := range []string{from, msg.To, msg.Subject} {
+		if strings.ContainsAny(value, "\r\n") {
+			return nil, fmt.Errorf("invalid email header %q", value)
+		}
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	domain := envelopeAddress(from)
+	if at := strings.LastIndex(domain, "@"); at >= 0 {
+		domain = domain[at+1:]
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(id), domain)
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	body := quotedprintable.NewWriter(&buf)
+	if _, err := body.Write([]byte(strings.ReplaceAll(msg.Body, "\n", "\r\n"))); err != nil {
+		return nil, err
+	}
+	if err := body.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"bytes"
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	goldmarkhtml "github.com/yuin/goldmark/renderer/html"
+)
+
+// markdown renders CommonMark with the GitHub extensions (tables, strikethrough,
+// autolinks, task lists). Raw HTML is passed through and cleaned by
+// markdownPolicy afterwards.
+var markdown = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	goldmark.WithRendererOptions(goldmarkhtml.WithUnsafe()),
+)
+
+// markdownPolicy keeps the formatting allowed in user generated content and
+// drops scripts, styles, event handlers and javascript: URLs
+var markdownPolicy = newMarkdownPolicy()
+
+func newMarkdownPolicy() *bluemonday.Policy {
+	policy := bluemonday.UGCPolicy()
+	policy.RequireNoFollowOnLinks(true)
+	policy.AddTargetBlankToFullyQualifiedLinks(true)
+	// Bahasa code block dari ```go dipertahankan untuk syntax highlighting
+	policy.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w-]+$`)).OnElements("code")
+	return policy
+}
+
+// whitespace matches runs of whitespace collapsed by MarkdownExcerpt
+var whitespace = regexp.MustCompile(`\s+`)
+
+// RenderMarkdown converts Markdown to sanitized HTML that is safe to embed in
+// a page without further escaping
+func RenderMarkdown(source string) (string, error) {
+	var buf bytes.Buffer
+	if err := markdown.Convert([]byte(source), &buf); err != nil {
+		return "", err
+	}
+	return markdownPolicy.Sanitize(buf.String()), nil
+}
+
+// MarkdownExcerpt returns the plain text of rendered HTML, cut at a word
+// boundary so it is at most maxRunes long including the trailing ellipsis
+func MarkdownExcerpt(renderedHTML string, maxRunes int) string {
+	// Blok HTML dipisah spasi agar kata dari paragraf berbeda tidak menempel
+	spaced := strings.NewReplacer("</p>", "</p> ", "</li>", "</li> ", "<br>", " ", "</h1>", "</h1> ", "</h2>", "</h2> ", "</h3>", "</h3> ").Replace(renderedHTML)
+	text := html.UnescapeString(bluemonday.StrictPolicy().Sanitize(spaced))
+	text = strings.TrimSpace(whitespace.ReplaceAllString(text, " "))
+
+	runes := []rune(text)
+	if len(runes) <= maxRunes {
+		return text
+	}
+
+	cut := runes[:maxRunes-1]
+	if i := strings.LastIndexFunc(string(cut), unicode.IsSpace); i > 0 {
+		cut = []rune(string(cut)[:i])
+	}
+	return strings.TrimRightFunc(string(cut), func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsPunct(r)
+	}) + "…"
+}
@@ -0,0 +1,166 @@
+package utils
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// MediaFolders are the storage folders scanned for orphaned media
+var MediaFolders = []string{"song_images", "song_audio", "album_covers", "post_covers", "gallery_photos"}
+
+// mediaReferenceQueries select every media URL still referenced by the database
+var mediaReferenceQueries = []string{
+	`SELECT audio_file_path FROM songs WHERE audio_file_path IS NOT NULL`,
+	`SELECT image_path FROM songs WHERE image_path IS NOT NULL`,
+	`SELECT v.value FROM songs s, jsonb_each_text(s.image_variants) v`,
+	`SELECT cover_image_path FROM albums WHERE cover_image_path IS NOT NULL`,
+	`SELECT v.value FROM albums a, jsonb_each_text(a.cover_image_variants) v`,
+	`SELECT cover_image_path FROM posts WHERE cover_image_path IS NOT NULL`,
+	`SELECT v.value FROM posts p, jsonb_each_text(p.cover_image_variants) v`,
+	`SELECT image_path FROM gallery_photos`,
+	`SELECT v.value FROM gallery_photos p, jsonb_each_text(p.image_variants) v`,
+}
+
+// MediaGCOptions configures a garbage collection run
+type MediaGCOptions struct {
+	// DryRun only reports orphans without deleting them
+	DryRun bool
+	// MinAge protects objects uploaded recently, whose song row may not be
+	// committed yet
+	MinAge time.Duration
+}
+
+// MediaGCReport describes the result of a garbage collection run
+type MediaGCReport struct {
+	DryRun        bool       `json:"dry_run"`
+	Scanned       int        `json:"scanned"`
+	Referenced    int        `json:"referenced"`
+	SkippedRecent int        `json:"skipped_recent"`
+	Orphans       []FileInfo `json:"orphans"`
+	OrphanBytes   int64      `json:"orphan_bytes"`
+	Deleted       int        `json:"deleted"`
+	Failed        []string   `json:"failed"`
+	StartedAt     time.Time  `json:"started_at"`
+	FinishedAt    time.Time  `json:"finished_at"`
+}
+
+// CollectOrphanedMedia lists MediaFolders in storage, diffs the objects
+// against the URLs referenced by the database and deletes the unreferenced
+// ones unless DryRun is set.
+func CollectOrphanedMedia(db *sql.DB, storage Storage, opts MediaGCOptions) (*MediaGCReport, error) {
+	report := &MediaGCReport{DryRun: opts.DryRun, StartedAt: time.Now()}
+
+	// List storage before reading the database, an object uploaded in between
+	// is either missing from the listing or already referenced
+	var objects []FileInfo
+	for _, folder := range MediaFolders {
+		listed, err := storage.ListObjects(folder)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %v", folder, err)
+		}
+		objects = append(objects, listed...)
+	}
+	report.Scanned = len(objects)
+
+	referenced, unresolved, err := referencedObjects(db, storage)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every reference failing to parse usually means the storage driver or
+	// its URL changed, deleting now would wipe the whole bucket
+	if len(referenced) == 0 && unresolved > 0 && !opts.DryRun {
+		return nil, fmt.Errorf("refusing to delete: none of the %d media URLs in the database belong to this storage driver", unresolved)
+	}
+
+	cutoff := report.StartedAt.Add(-opts.MinAge)
+	for _, object := range objects {
+		if referenced[object.Path] {
+			report.Referenced++
+			continue
+		}
+		if !object.LastModified.IsZero() && object.LastModified.After(cutoff) {
+			report.SkippedRecent++
+			continue
+		}
+
+		report.Orphans = append(report.Orphans, object)
+		report.OrphanBytes += object.Size
+		if opts.DryRun {
+			continue
+		}
+
+		if err := storage.DeleteFile(storage.PublicURL(object.Path)); err != nil {
+			log.Printf("Failed to delete orphaned media %s: %v", object.Path, err)
+			report.Failed = append(report.Failed, object.Path)
+			continue
+		}
+		report.Deleted++
+	}
+
+	report.FinishedAt = time.Now()
+	return report, nil
+}
+
+// referencedObjects returns the object paths referenced by the database and
+// the number of URLs that do not belong to storage
+func referencedObjects(db *sql.DB, storage Storage) (map[string]bool, int, error) {
+	referenced := map[string]bool{}
+	unresolved := 0
+
+	for _, query := range mediaReferenceQueries {
+		rows, err := db.Query(query)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to load media references: %v", err)
+		}
+
+		for rows.Next() {
+			var publicURL string
+			if err := rows.Scan(&publicURL); err != nil {
+				rows.Close()
+				return nil, 0, fmt.Errorf("failed to scan media reference: %v", err)
+			}
+			if publicURL == "" {
+				continue
+			}
+
+			objectPath, err := storage.ObjectPath(publicURL)
+			if err != nil {
+				// External URLs set through the JSON endpoints
+				unresolved++
+				continue
+			}
+			referenced[objectPath] = true
+		}
+
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to load media references: %v", err)
+		}
+	}
+
+	return referenced, unresolved, nil
+}
+
+// ScheduleMediaGC runs CollectOrphanedMedia every interval until the process
+// exits, logging a summary of each run
+func ScheduleMediaGC(db *sql.DB, storage Storage, interval time.Duration, opts MediaGCOptions) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		report, err := CollectOrphanedMedia(db, storage, opts)
+		if err != nil {
+			log.Printf("Media GC failed: %v", err)
+			continue
+		}
+		log.Printf(
+			"Media GC (dry run: %t): scanned %d, referenced %d, orphaned %d (%d bytes), deleted %d, failed %d, skipped %d recent",
+			report.DryRun, report.Scanned, report.Referenced, len(report.Orphans), report.OrphanBytes,
+			report.Deleted, len(report.Failed), report.SkippedRecent,
+		)
+	}
+}
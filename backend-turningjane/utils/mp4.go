@@ -0,0 +1,203 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// mp4Walk calls fn for every atom between start and end with the offset and
+// size of the atom payload
+func mp4Walk(r io.ReaderAt, start, end int64, fn func(kind string, off, size int64) error) error {
+	for pos := start; pos+8 <= end; {
+		header, err := readAt(r, pos, 8)
+		if err != nil {
+			return err
+		}
+		size := int64(binary.BigEndian.Uint32(header))
+		kind := string(header[4:8])
+		headerLen := int64(8)
+
+		switch size {
+		case 0: // atom extends to the end of the file
+			size = end - pos
+		case 1: // 64-bit size follows the type
+			large, err := readAt(r, pos+8, 8)
+			if err != nil {
+				return err
+			}
+			size = int64(binary.BigEndian.Uint64(large))
+			headerLen = 16
+		}
+		if size < headerLen || pos+size > end {
+			return fmt.Errorf("invalid MP4 atom %q", kind)
+		}
+
+		if err := fn(kind, pos+headerLen, size-headerLen); err != nil {
+			return err
+		}
+		pos += size
+	}
+	return nil
+}
+
+// mp4ItemKeys maps iTunes ilst item atoms to tag keys
+var mp4ItemKeys = map[string]string{
+	"\xa9nam": "TITLE",
+	"\xa9ART": "ARTIST",
+	"aART":    "ALBUMARTIST",
+	"\xa9alb": "ALBUM",
+	"\xa9day": "DATE",
+}
+
+// readMP4 reads the movie header, the audio sample description and the
+// iTunes metadata list of an MPEG-4 audio file
+func readMP4(r io.ReaderAt, size int64, meta *AudioMetadata) error {
+	var walk func(kind string, off, size int64) error
+	walk = func(kind string, off, size int64) error {
+		switch kind {
+		case "moov", "trak", "mdia", "minf", "stbl", "udta", "ilst":
+			return mp4Walk(r, off, off+size, walk)
+		case "meta":
+			// meta is a full box in MP4 but a plain container in QuickTime files
+			peek, err := readAt(r, off, min(size, 8))
+			if err != nil {
+				return err
+			}
+			if len(peek) == 8 && string(peek[4:8]) == "hdlr" {
+				return mp4Walk(r, off, off+size, walk)
+			}
+			return mp4Walk(r, off+4, off+size, walk)
+		case "mvhd":
+			return readMP4MovieHeader(r, off, size, meta)
+		case "stsd":
+			if meta.Codec == "" {
+				return readMP4SampleDescription(r, off, size, meta)
+			}
+		case "covr":
+			return readMP4Data(r, off, size, func(dataType uint32, value []byte) {
+				mimeType := "image/jpeg"
+				if dataType == 14 {
+					mimeType = "image/png"
+				}
+				meta.setPicture(mimeType, value, true)
+			})
+		default:
+			if key, ok := mp4ItemKeys[kind]; ok {
+				return readMP4Data(r, off, size, func(_ uint32, value []byte) {
+					meta.setTag(key, string(bytes.ToValidUTF8(value, nil)))
+				})
+			}
+		}
+		return nil
+	}
+
+	// Trailing garbage after the atoms we need should not fail the upload
+	if err := mp4Walk(r, 0, size, walk); err != nil && meta.DurationSeconds == 0 {
+		return err
+	}
+	return nil
+}
+
+// readMP4MovieHeader reads the time scale and duration from mvhd
+func readMP4MovieHeader(r io.ReaderAt, off, size int64, meta *AudioMetadata) error {
+	mvhd, err := readAt(r, off, min(size, 32))
+	if err != nil {
+		return err
+	}
+
+	var timescale uint32
+	var duration uint64
+	if mvhd[0] == 1 && len(mvhd) >= 32 {
+		timescale = binary.BigEndian.Uint32(mvhd[20:])
+		duration = binary.BigEndian.Uint64(mvhd[24:])
+	} else if len(mvhd) >= 20 {
+		timescale = binary.BigEndian.Uint32(mvhd[12:])
+		duration = uint64(binary.BigEndian.Uint32(mvhd[16:]))
+	}
+
+	if timescale > 0 {
+		meta.DurationSeconds = float64(duration) / float64(timescale)
+	}
+	return nil
+}
+
+// readMP4SampleDescription reads the codec, channels and sample rate of the
+// first audio sample entry in stsd
+func readMP4SampleDescription(r io.ReaderAt, off, size int64, meta *AudioMetadata) error {
+	stsd, err := readAt(r, off, min(size, 8+36))
+	if err != nil {
+		return err
+	}
+	if len(stsd) < 8+36 {
+		return nil
+	}
+
+	entry := stsd[8:]
+	format := string(entry[4:8])
+	switch format {
+	case "mp4a":
+		meta.Codec = "aac"
+	case "alac":
+		meta.Codec = "alac"
+	case "fLaC":
+		meta.Codec = "flac"
+	case "Opus":
+		meta.Codec = "opus"
+	default:
+		meta.Codec = strings.ToLower(strings.TrimSpace(format))
+	}
+
+	meta.Channels = int(binary.BigEndian.Uint16(entry[24:]))
+	// The sample rate is a 16.16 fixed point number
+	meta.SampleRate = int(binary.BigEndian.Uint32(entry[32:]) >> 16)
+	return nil
+}
+
+// readMP4Data calls fn with the payload of the data atom inside an ilst item
+func readMP4Data(r io.ReaderAt, off, size int64, fn func(dataType uint32, value []byte)) error {
+	return mp4Walk(r, off, off+size, func(kind string, dataOff, dataSize int64) error {
+		if kind != "data" || dataSize < 8 || dataSize > maxPictureSize+8 {
+			return nil
+		}
+		data, err := readAt(r, dataOff, dataSize)
+		if err != nil {
+			return err
+		}
+		fn(binary.BigEndian.Uint32(data)&0xFFFFFF, data[8:])
+		return nil
+	})
+}
+
+// mp4AudioOnly reports whether the moov atom has at least one sound track
+// and no video track, from the handler type in each trak's hdlr
+func mp4AudioOnly(r io.ReaderAt, size int64) bool {
+	var sound, video bool
+	var walk func(kind string, off, size int64) error
+	walk = func(kind string, off, size int64) error {
+		switch kind {
+		case "moov", "trak", "mdia":
+			return mp4Walk(r, off, off+size, walk)
+		case "hdlr":
+			// version and flags, pre_defined, then the handler type
+			hdlr, err := readAt(r, off, min(size, 12))
+			if err != nil || len(hdlr) < 12 {
+				return err
+			}
+			switch string(hdlr[8:12]) {
+			case "soun":
+				sound = true
+			case "vide":
+				video = true
+			}
+		}
+		return nil
+	}
+
+	if err := mp4Walk(r, 0, size, walk); err != nil {
+		return false
+	}
+	return sound && !video
+}
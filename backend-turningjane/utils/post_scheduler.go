@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// PublishDuePosts flips scheduled posts whose publish_at has passed to
+// published and returns how many posts were published
+func PublishDuePosts(db *sql.DB) (int64, error) {
+	result, err := db.Exec(`
+		UPDATE posts
+		SET status = 'published', updated_at = NOW()
+		WHERE status = 'scheduled' AND publish_at <= NOW()
+	`)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// SchedulePostPublishing runs PublishDuePosts right away, to catch up on posts
+// that became due while the server was down, and then every interval
+func SchedulePostPublishing(db *sql.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		published, err := PublishDuePosts(db)
+		if err != nil {
+			log.Printf("Publishing scheduled posts failed: %v", err)
+		} else if published > 0 {
+			log.Printf("Published %d scheduled posts", published)
+		}
+		<-ticker.C
+	}
+}
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter allows at most Limit events per key within a sliding Window.
+// State is kept in memory, so limits apply per server process.
+type RateLimiter struct {
+	Limit  int
+	Window time.Duration
+
+	mu     sync.Mutex
+	events map[string][]time.Time
+	swept  time.Time
+}
+
+// NewRateLimiter creates a new RateLimiter instance
+func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
+	return &RateLimiter{
+		Limit:  limit,
+		Window: window,
+		events: map[string][]time.Time{},
+	}
+}
+
+// Allow records an event for key and reports whether it is within the limit.
+// When it is not, the returned duration is how long until the next event is
+// allowed.
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	cutoff := now.Add(-l.Window)
+
+	// Buang key yang sudah kedaluwarsa sesekali agar map tidak terus membesar
+	if now.Sub(l.swept) > l.Window {
+		for k, times := range l.events {
+			if !times[len(times)-1].After(cutoff) {
+				delete(l.events, k)
+			}
+		}
+		l.swept = now
+	}
+
+	times := l.events[key]
+	for len(times) > 0 && !times[0].After(cutoff) {
+		times = times[1:]
+	}
+
+	if len(times) >= l.Limit {
+		l.events[key] = times
+		return false, times[0].Add(l.Window).Sub(now)
+	}
+
+	l.events[key] = append(times, now)
+	return true, 0
+}
@@ -0,0 +1,505 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	s3Algorithm       = "AWS4-HMAC-SHA256"
+	s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+	s3EmptyPayload    = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	s3TimeFormat      = "20060102T150405Z"
+	s3DateFormat      = "20060102"
+)
+
+// S3StorageConfig holds configuration for S3-compatible storage (AWS S3, MinIO, R2, ...)
+type S3StorageConfig struct {
+	Endpoint      string
+	Region        string
+	Bucket        string
+	AccessKey     string
+	SecretKey     string
+	PublicBaseURL string
+	UsePathStyle  bool
+	PresignExpiry time.Duration
+	ImageFolder   string
+	AudioFolder   string
+}
+
+// NewS3StorageConfig creates a new S3StorageConfig instance
+func NewS3StorageConfig() *S3StorageConfig {
+	region := os.Getenv("S3_REGION")
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	// MinIO and most self-hosted servers only understand path-style URLs
+	usePathStyle := true
+	if value := os.Getenv("S3_FORCE_PATH_STYLE"); value != "" {
+		usePathStyle, _ = strconv.ParseBool(value)
+	}
+
+	presignExpiry := 15 * time.Minute
+	if value := os.Getenv("S3_PRESIGN_EXPIRY"); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil {
+			presignExpiry = parsed
+		}
+	}
+
+	return &S3StorageConfig{
+		Endpoint:      strings.TrimRight(os.Getenv("S3_ENDPOINT"), "/"),
+		Region:        region,
+		Bucket:        os.Getenv("S3_BUCKET"),
+		AccessKey:     os.Getenv("S3_ACCESS_KEY"),
+		SecretKey:     os.Getenv("S3_SECRET_KEY"),
+		PublicBaseURL: strings.TrimRight(os.Getenv("S3_PUBLIC_URL"), "/"),
+		UsePathStyle:  usePathStyle,
+		PresignExpiry: presignExpiry,
+		ImageFolder:   "song_images",
+		AudioFolder:   "song_audio",
+	}
+}
+
+// objectURL builds the API URL of an object (or of the bucket when objectPath is empty)
+func (c *S3StorageConfig) objectURL(objectPath string) (*url.URL, error) {
+	endpoint, err := url.Parse(c.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint: %s", c.Endpoint)
+	}
+
+	u := &url.URL{Scheme: endpoint.Scheme, Host: endpoint.Host}
+	if c.UsePathStyle {
+		u.Path = "/" + c.Bucket + "/" + objectPath
+	} else {
+		u.Host = c.Bucket + "." + endpoint.Host
+		u.Path = "/" + objectPath
+	}
+	u.RawPath = s3EscapePath(u.Path)
+	return u, nil
+}
+
+// ObjectPath extracts the object key from a URL returned by PublicURL
+func (c *S3StorageConfig) ObjectPath(filePath string) (string, error) {
+	bases := []string{}
+	if c.PublicBaseURL != "" {
+		bases = append(bases, c.PublicBaseURL+"/")
+	}
+	if base, err := c.objectURL(""); err == nil {
+		bases = append(bases, base.String())
+	}
+
+	for _, base := range bases {
+		if strings.HasPrefix(filePath, base) && len(filePath) > len(base) {
+			key := strings.TrimPrefix(filePath, base)
+			if i := strings.IndexByte(key, '?'); i >= 0 {
+				key = key[:i]
+			}
+			if unescaped, err := url.PathUnescape(key); err == nil {
+				key = unescaped
+			}
+			return key, nil
+		}
+	}
+
+	return "", fmt.Errorf("invalid file path format: %s", filePath)
+}
+
+// do signs and sends a request for the given object, op names the operation
+// in errors
+func (c *S3StorageConfig) do(op, method, objectPath string, body io.Reader, size int64, contentType string, timeout time.Duration) (*http.Response, error) {
+	u, err := c.objectURL(objectPath)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	payloadHash := s3EmptyPayload
+	if body != nil {
+		req.ContentLength = size
+		payloadHash = s3UnsignedPayload
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	c.signRequest(req, payloadHash, time.Now().UTC())
+
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, transportError(op, err)
+	}
+	return resp, nil
+}
+
+// UploadFile streams a file to the bucket with a SigV4-signed PUT
+func (c *S3StorageConfig) UploadFile(fileHeader *multipart.FileHeader, folder string) (publicURL string, err error) {
+	file, err := openUpload(fileHeader)
+	if err != nil {
+		return "", err
+	}
+	defer func() { file.finish(err) }()
+
+	// Generate unique filename
+	objectPath := fmt.Sprintf("%s/%s%s", folder, uuid.New().String(), filepath.Ext(fileHeader.Filename))
+
+	return c.PutObject(objectPath, file, fileHeader.Size, fileHeader.Header.Get("Content-Type"))
+}
+
+// PutObject streams body to objectPath, replacing any existing object
+func (c *S3StorageConfig) PutObject(objectPath string, body io.Reader, size int64, contentType string) (string, error) {
+	err := withRetry("upload", body, func() error {
+		resp, err := c.do("upload", http.MethodPut, objectPath, body, size, contentType, uploadTimeout(size))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+			return responseError("upload", resp)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return c.PublicURL(objectPath), nil
+}
+
+// UploadSongImage uploads a song image and its variants to the bucket
+func (c *S3StorageConfig) UploadSongImage(fileHeader *multipart.FileHeader) (string, ImageVariants, error) {
+	return uploadSongImageFile(c, c.ImageFolder, fileHeader)
+}
+
+// UploadImage uploads an image and its variants into folder on the bucket
+func (c *S3StorageConfig) UploadImage(fileHeader *multipart.FileHeader, folder string) (string, ImageVariants, error) {
+	return uploadSongImageFile(c, folder, fileHeader)
+}
+
+// UploadSongAudio uploads a song audio file to the bucket
+func (c *S3StorageConfig) UploadSongAudio(fileHeader *multipart.FileHeader) (string, error) {
+	return c.UploadFile(fileHeader, c.AudioFolder)
+}
+
+// UploadSongImageData uploads an in-memory song image, such as embedded cover art, and its variants
+func (c *S3StorageConfig) UploadSongImageData(data []byte, contentType string) (string, ImageVariants, error) {
+	return uploadSongImage(c, c.ImageFolder, data, contentType)
+}
+
+// DeleteFile deletes a file from the bucket
+func (c *S3StorageConfig) DeleteFile(filePath string) error {
+	objectPath, err := c.ObjectPath(filePath)
+	if err != nil {
+		return err
+	}
+
+	return withRetry("delete", nil, func() error {
+		resp, err := c.do("delete", http.MethodDelete, objectPath, nil, 0, "", 10*time.Second)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+			return responseError("delete", resp)
+		}
+		return nil
+	})
+}
+
+// StatFile returns information about a file in the bucket using HEAD
+func (c *S3StorageConfig) StatFile(filePath string) (*FileInfo, error) {
+	objectPath, err := c.ObjectPath(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var info *FileInfo
+	err = withRetry("stat", nil, func() error {
+		resp, err := c.do("stat", http.MethodHead, objectPath, nil, 0, "", 10*time.Second)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return responseError("stat", resp)
+		}
+
+		info = &FileInfo{
+			Path:        objectPath,
+			Size:        resp.ContentLength,
+			ContentType: resp.Header.Get("Content-Type"),
+		}
+		if lastModified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+			info.LastModified = lastModified
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// PublicURL builds the public URL of an object. S3_PUBLIC_URL (for example a
+// CDN in front of the bucket) takes precedence over the endpoint URL.
+func (c *S3StorageConfig) PublicURL(objectPath string) string {
+	if c.PublicBaseURL != "" {
+		return c.PublicBaseURL + "/" + s3EscapePath(objectPath)
+	}
+
+	u, err := c.objectURL(objectPath)
+	if err != nil {
+		return objectPath
+	}
+	return u.String()
+}
+
+// s3ListResult is the response body of ListObjectsV2
+type s3ListResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		LastModified time.Time `xml:"LastModified"`
+		Size         int64     `xml:"Size"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// ListObjects lists the bucket below prefix with ListObjectsV2, following
+// continuation tokens until every page is read
+func (c *S3StorageConfig) ListObjects(prefix string) ([]FileInfo, error) {
+	u, err := c.objectURL("")
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []FileInfo
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {strings.TrimSuffix(prefix, "/") + "/"}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		u.RawQuery = s3CanonicalQuery(query)
+
+		var result s3ListResult
+		err := withRetry("list", nil, func() error {
+			req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+			if err != nil {
+				return fmt.Errorf("failed to create request: %v", err)
+			}
+			c.signRequest(req, s3EmptyPayload, time.Now().UTC())
+
+			client := &http.Client{Timeout: 30 * time.Second}
+			resp, err := client.Do(req)
+			if err != nil {
+				return transportError("list", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != http.StatusOK {
+				return responseError("list", resp)
+			}
+
+			if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+				return fmt.Errorf("failed to parse list response: %v", err)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, object := range result.Contents {
+			objects = append(objects, FileInfo{
+				Path:         object.Key,
+				Size:         object.Size,
+				ContentType:  mime.TypeByExtension(filepath.Ext(object.Key)),
+				LastModified: object.LastModified,
+			})
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// PresignedURL builds a time-limited GET URL for objects in a private bucket.
+// When expiry is zero the configured PresignExpiry is used.
+func (c *S3StorageConfig) PresignedURL(objectPath string, expiry time.Duration) (string, error) {
+	return c.presign(http.MethodGet, objectPath, expiry, time.Now().UTC())
+}
+
+func (c *S3StorageConfig) presign(method, objectPath string, expiry time.Duration, now time.Time) (string, error) {
+	if expiry <= 0 {
+		expiry = c.PresignExpiry
+	}
+
+	u, err := c.objectURL(objectPath)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", s3Algorithm)
+	query.Set("X-Amz-Credential", c.AccessKey+"/"+c.scope(now))
+	query.Set("X-Amz-Date", now.Format(s3TimeFormat))
+	query.Set("X-Amz-Expires", strconv.FormatInt(int64(expiry/time.Second), 10))
+	query.Set("X-Amz-SignedHeaders", "host")
+
+	query.Set("X-Amz-Signature", c.signature(now, s3PresignCanonicalRequest(method, u, query)))
+	u.RawQuery = s3CanonicalQuery(query)
+	return u.String(), nil
+}
+
+// s3PresignCanonicalRequest builds the SigV4 canonical request of a presigned
+// URL. query holds the X-Amz-* parameters without the signature.
+func s3PresignCanonicalRequest(method string, u *url.URL, query url.Values) string {
+	return strings.Join([]string{
+		method,
+		u.EscapedPath(),
+		s3CanonicalQuery(query),
+		"host:" + u.Host + "\n",
+		"host",
+		s3UnsignedPayload,
+	}, "\n")
+}
+
+// signRequest adds the SigV4 Authorization header to req
+func (c *S3StorageConfig) signRequest(req *http.Request, payloadHash string, now time.Time) {
+	req.Header.Set("X-Amz-Date", now.Format(s3TimeFormat))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	canonicalRequest, signedHeaders := s3CanonicalRequest(req, payloadHash)
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, c.AccessKey, c.scope(now), signedHeaders, c.signature(now, canonicalRequest),
+	))
+}
+
+// s3CanonicalRequest builds the SigV4 canonical request of req and the list
+// of headers it signs. req must already carry the X-Amz-* headers.
+func s3CanonicalRequest(req *http.Request, payloadHash string) (string, string) {
+	headers := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           req.Header.Get("X-Amz-Date"),
+	}
+	if contentType := req.Header.Get("Content-Type"); contentType != "" {
+		headers["content-type"] = contentType
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		s3CanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	return canonicalRequest, signedHeaders
+}
+
+func (c *S3StorageConfig) scope(now time.Time) string {
+	return fmt.Sprintf("%s/%s/s3/aws4_request", now.Format(s3DateFormat), c.Region)
+}
+
+// signature derives the signing key and signs the canonical request
+func (c *S3StorageConfig) signature(now time.Time, canonicalRequest string) string {
+	hashed := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		s3Algorithm,
+		now.Format(s3TimeFormat),
+		c.scope(now),
+		hex.EncodeToString(hashed[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+c.SecretKey), now.Format(s3DateFormat))
+	key = hmacSHA256(key, c.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3Escape percent-encodes everything except the RFC 3986 unreserved characters
+func s3Escape(value string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		ch := value[i]
+		if (ch >= 'A' && ch <= 'Z') || (ch >= 'a' && ch <= 'z') || (ch >= '0' && ch <= '9') ||
+			ch == '-' || ch == '_' || ch == '.' || ch == '~' || (keepSlash && ch == '/') {
+			b.WriteByte(ch)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
+
+func s3EscapePath(value string) string {
+	return s3Escape(value, true)
+}
+
+// s3CanonicalQuery encodes query parameters sorted by key as SigV4 requires
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, s3Escape(key, false)+"="+s3Escape(value, false))
+		}
+	}
+	return strings.Join(parts, "&")
+}
@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// maxSlugLength caps the readable part of a slug
+const maxSlugLength = 60
+
+// slugEncoding is lowercase base32 without padding, safe in URLs
+var slugEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// Slugify turns a title into a lowercase, hyphen separated URL segment.
+// Accents are dropped, e.g. "Lagu Cinta Café" becomes "lagu-cinta-cafe".
+func Slugify(title string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range norm.NFD.String(title) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// Tanda diakritik dari dekomposisi NFD
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			if hyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			hyphen = false
+			b.WriteRune(unicode.ToLower(r))
+		default:
+			hyphen = true
+		}
+		if b.Len() >= maxSlugLength {
+			break
+		}
+	}
+	return strings.Trim(b.String(), "-")
+}
+
+// RandomSlug returns Slugify(title) followed by a random suffix, so titles do
+// not need to be unique. Titles without usable characters only get the suffix.
+func RandomSlug(title string) (string, error) {
+	buf := make([]byte, 5)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	suffix := slugEncoding.EncodeToString(buf)
+	if base := Slugify(title); base != "" {
+		return base + "-" + suffix, nil
+	}
+	return suffix, nil
+}
+
+// UniqueSlug returns Slugify(title) when taken reports it as free, otherwise
+// a RandomSlug of the title
+func UniqueSlug(title string, taken func(slug string) (bool, error)) (string, error) {
+	if base := Slugify(title); base != "" {
+		used, err := taken(base)
+		if err != nil {
+			return "", err
+		}
+		if !used {
+			return base, nil
+		}
+	}
+	return RandomSlug(title)
+}
@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FileInfo describes an object stored in a storage backend
+type FileInfo struct {
+	Path         string    `json:"path"`
+	Size         int64     `json:"size"`
+	ContentType  string    `json:"content_type"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// Storage is the common interface implemented by every media storage driver
+type Storage interface {
+	// UploadFile uploads a file into the given folder and returns its public URL
+	UploadFile(fileHeader *multipart.FileHeader, folder string) (string, error)
+	// UploadSongImage uploads a song image and its resized variants into the image folder
+	UploadSongImage(fileHeader *multipart.FileHeader) (string, ImageVariants, error)
+	// UploadImage uploads an image and its resized variants into the given folder
+	UploadImage(fileHeader *multipart.FileHeader, folder string) (string, ImageVariants, error)
+	// UploadSongAudio uploads a song audio file into the audio folder
+	UploadSongAudio(fileHeader *multipart.FileHeader) (string, error)
+	// UploadSongImageData uploads an in-memory image and its variants into the image folder
+	UploadSongImageData(data []byte, contentType string) (string, ImageVariants, error)
+	// PutObject uploads body to an exact object path and returns its public URL
+	PutObject(objectPath string, body io.Reader, size int64, contentType string) (string, error)
+	// DeleteFile deletes a file given the public URL returned by UploadFile
+	DeleteFile(filePath string) error
+	// StatFile returns information about a file given its public URL
+	StatFile(filePath string) (*FileInfo, error)
+	// PublicURL builds the public URL for an object path such as "song_audio/x.mp3"
+	PublicURL(objectPath string) string
+	// ObjectPath extracts the object path from a public URL returned by the driver
+	ObjectPath(publicURL string) (string, error)
+	// ListObjects lists every object stored under the prefix folder
+	ListObjects(prefix string) ([]FileInfo, error)
+}
+
+// NewStorage creates the storage driver selected by the STORAGE_DRIVER
+// environment variable ("supabase", "s3" or "local"). Supabase is the default.
+func NewStorage() Storage {
+	driver := strings.ToLower(os.Getenv("STORAGE_DRIVER"))
+	switch driver {
+	case "local":
+		return NewLocalStorageConfig()
+	case "s3", "minio":
+		return NewS3StorageConfig()
+	case "", "supabase":
+		return NewSupabaseStorageConfig()
+	default:
+		log.Printf("Unknown STORAGE_DRIVER %q, falling back to supabase", driver)
+		return NewSupabaseStorageConfig()
+	}
+}
+
+// objectName builds a unique object path in folder with the extension of contentType
+func objectName(folder, contentType string) string {
+	return fmt.Sprintf("%s/%s%s", folder, uuid.New().String(), extensions[contentType])
+}
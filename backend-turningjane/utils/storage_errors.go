@@ -0,0 +1,164 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Storage drivers wrap their failures in a *StorageError whose Kind is one of
+// these sentinels, so callers can check them with errors.Is
+var (
+	ErrObjectNotFound      = errors.New("object not found")
+	ErrStorageUnauthorized = errors.New("storage credentials rejected")
+	ErrStorageQuota        = errors.New("storage quota exceeded")
+	ErrStorageTransient    = errors.New("storage temporarily unavailable")
+)
+
+// Transient failures are retried storageMaxRetries times, waiting a random
+// duration up to storageRetryBase * 2^attempt (capped at storageRetryMax)
+var (
+	storageMaxRetries = 3
+	storageRetryBase  = 250 * time.Millisecond
+	storageRetryMax   = 5 * time.Second
+)
+
+// StorageError describes a failed storage operation
+type StorageError struct {
+	// Op is the operation that failed: upload, delete, stat or list
+	Op string
+	// StatusCode is the HTTP status returned by the backend, 0 if there was
+	// no response
+	StatusCode int
+	// Kind is one of the Err* sentinels, nil if the failure is not classified
+	Kind error
+	Err  error
+}
+
+func (e *StorageError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("%s failed with status %d: %v", e.Op, e.StatusCode, e.Err)
+	}
+	return fmt.Sprintf("%s failed: %v", e.Op, e.Err)
+}
+
+func (e *StorageError) Unwrap() []error {
+	if e.Kind == nil {
+		return []error{e.Err}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// responseError builds the error for an unexpected HTTP response
+func responseError(op string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+
+	message := strings.TrimSpace(string(body))
+	if message == "" {
+		message = http.StatusText(resp.StatusCode)
+	}
+
+	return &StorageError{
+		Op:         op,
+		StatusCode: resp.StatusCode,
+		Kind:       classifyStatus(resp.StatusCode, body),
+		Err:        errors.New(message),
+	}
+}
+
+// classifyStatus maps an HTTP status to an error kind
+func classifyStatus(status int, body []byte) error {
+	// Supabase answers 400 and puts the real status in the JSON body, e.g.
+	// {"statusCode":"404","error":"not_found","message":"Object not found"}
+	if status == http.StatusBadRequest {
+		var payload struct {
+			StatusCode string `json:"statusCode"`
+		}
+		if json.Unmarshal(body, &payload) == nil {
+			if code, err := strconv.Atoi(payload.StatusCode); err == nil {
+				status = code
+			}
+		}
+	}
+
+	switch {
+	case status == http.StatusNotFound:
+		return ErrObjectNotFound
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return ErrStorageUnauthorized
+	case status == http.StatusRequestEntityTooLarge || status == http.StatusInsufficientStorage:
+		return ErrStorageQuota
+	case status == http.StatusRequestTimeout || status == http.StatusTooManyRequests || status >= 500:
+		return ErrStorageTransient
+	}
+	return nil
+}
+
+// transportError wraps a failed HTTP round trip, which is always worth retrying
+func transportError(op string, err error) error {
+	return &StorageError{Op: op, Kind: ErrStorageTransient, Err: err}
+}
+
+// fileError wraps a local filesystem error
+func fileError(op string, err error) error {
+	var kind error
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		kind = ErrObjectNotFound
+	case errors.Is(err, os.ErrPermission):
+		kind = ErrStorageUnauthorized
+	case errors.Is(err, syscall.ENOSPC):
+		kind = ErrStorageQuota
+	}
+	return &StorageError{Op: op, Kind: kind, Err: err}
+}
+
+// withRetry runs fn until it succeeds, fails with a non-transient error or
+// runs out of retries. body is the request body fn sends, if any. It is
+// rewound before every retry; bodies that cannot seek are not retried.
+func withRetry(op string, body io.Reader, fn func() error) error {
+	var start int64
+	seeker, _ := body.(io.Seeker)
+	if seeker != nil {
+		offset, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			seeker = nil
+		}
+		start = offset
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || !errors.Is(err, ErrStorageTransient) || attempt >= storageMaxRetries {
+			return err
+		}
+		if body != nil {
+			if seeker == nil {
+				return err
+			}
+			if _, seekErr := seeker.Seek(start, io.SeekStart); seekErr != nil {
+				return err
+			}
+		}
+
+		delay := retryDelay(attempt)
+		log.Printf("Storage %s failed (attempt %d), retrying in %s: %v", op, attempt+1, delay.Round(time.Millisecond), err)
+		time.Sleep(delay)
+	}
+}
+
+// retryDelay returns the backoff before retry number attempt+1. Full jitter
+// keeps concurrent requests from retrying in lockstep.
+func retryDelay(attempt int) time.Duration {
+	backoff := min(storageRetryBase<<min(attempt, 16), storageRetryMax)
+	return time.Duration(rand.Int63n(int64(backoff))) + time.Millisecond
+}
@@ -0,0 +1,125 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base32"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// totpPeriod is the RFC 6238 time step in seconds
+	totpPeriod = 30
+	// totpSkew is the number of time steps accepted before and after the
+	// current one, to allow for clock drift on the phone
+	totpSkew = 1
+	// recoveryCodeBytes is the entropy of a recovery code, 10 base32 characters
+	recoveryCodeBytes = 6
+)
+
+// totpIssuer returns the issuer shown in authenticator apps, from TOTP_ISSUER
+func totpIssuer() string {
+	if issuer := os.Getenv("TOTP_ISSUER"); issuer != "" {
+		return issuer
+	}
+	return "Turning Jane"
+}
+
+// NewTOTPKey generates a new TOTP secret for the account
+func NewTOTPKey(accountName string) (*otp.Key, error) {
+	return totp.Generate(totp.GenerateOpts{
+		Issuer:      totpIssuer(),
+		AccountName: accountName,
+		Period:      totpPeriod,
+		Digits:      otp.DigitsSix,
+		Algorithm:   otp.AlgorithmSHA1,
+	})
+}
+
+// TOTPKey rebuilds the key of a stored base32 secret, e.g. to render its
+// otpauth:// URI or QR code again
+func TOTPKey(secret, accountName string) (*otp.Key, error) {
+	raw, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return nil, err
+	}
+
+	return totp.Generate(totp.GenerateOpts{
+		Issuer:      totpIssuer(),
+		AccountName: accountName,
+		Period:      totpPeriod,
+		Digits:      otp.DigitsSix,
+		Algorithm:   otp.AlgorithmSHA1,
+		Secret:      raw,
+	})
+}
+
+// TOTPStep checks a 6 digit code against the secret at time t and returns the
+// time step it belongs to. Callers store the step and reject codes of the same
+// or an earlier step, so a code cannot be used twice.
+func TOTPStep(secret, code string, t time.Time) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != 6 {
+		return 0, false
+	}
+
+	opts := totp.ValidateOpts{
+		Period:    totpPeriod,
+		Digits:    otp.DigitsSix,
+		Algorithm: otp.AlgorithmSHA1,
+	}
+	for skew := -totpSkew; skew <= totpSkew; skew++ {
+		at := t.Add(time.Duration(skew*totpPeriod) * time.Second)
+		expected, err := totp.GenerateCodeCustom(secret, at, opts)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return at.Unix() / totpPeriod, true
+		}
+	}
+	return 0, false
+}
+
+// NewRecoveryCodes returns n single-use recovery codes such as "abcde-fghij"
+func NewRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		raw := make([]byte, recoveryCodeBytes)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		code := slugEncoding.EncodeToString(raw)[:10]
+		codes = append(codes, code[:5]+"-"+code[5:])
+	}
+	return codes, nil
+}
+
+// NormalizeRecoveryCode lowercases a recovery code and strips the separator
+// and spaces, so "ABCDE FGHIJ" matches "abcde-fghij" before hashing
+func NormalizeRecoveryCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(strings.TrimSpace(code)))
+}
+
+// HashRecoveryCode hashes the normalized form of a recovery code with bcrypt
+// for storage
+func HashRecoveryCode(code string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(NormalizeRecoveryCode(code)), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// RecoveryCodeMatches reports whether code matches a hash from HashRecoveryCode
+func RecoveryCodeMatches(hash, code string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(NormalizeRecoveryCode(code))) == nil
+}
@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRecoveryCodeHash(t *testing.T) {
+	codes, err := NewRecoveryCodes(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := HashRecoveryCode(codes[0])
+	if err != nil {
+		t.Fatalf("HashRecoveryCode: %v", err)
+	}
+	if !strings.HasPrefix(hash, "$2") {
+		t.Fatalf("hash %q is not a bcrypt hash", hash)
+	}
+
+	// Codes may be typed in upper case with a space as the separator
+	typed := strings.ToUpper(strings.Replace(codes[0], "-", " ", 1))
+	if !RecoveryCodeMatches(hash, typed) {
+		t.Errorf("%q does not match the hash of %q", typed, codes[0])
+	}
+	if RecoveryCodeMatches(hash, codes[1]) {
+		t.Errorf("%q matches the hash of %q", codes[1], codes[0])
+	}
+
+	other, err := HashRecoveryCode(codes[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == hash {
+		t.Error("hashing the same code twice gives the same hash, bcrypt salt missing")
+	}
+}
@@ -0,0 +1,149 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// UploadBufferSize is the size of the buffer used when copying an upload to storage
+const UploadBufferSize = 64 * 1024
+
+var uploadBufferPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, UploadBufferSize)
+		return &buf
+	},
+}
+
+// UploadStats is a snapshot of the upload counters
+type UploadStats struct {
+	ActiveUploads   int64 `json:"active_uploads"`
+	BytesInFlight   int64 `json:"bytes_in_flight"`
+	TotalUploads    int64 `json:"total_uploads"`
+	FailedUploads   int64 `json:"failed_uploads"`
+	TotalBytes      int64 `json:"total_bytes"`
+	BufferSize      int64 `json:"buffer_size"`
+	MaxUploadSize   int64 `json:"max_upload_size"`
+	MultipartMemory int64 `json:"multipart_memory"`
+}
+
+var uploadCounters struct {
+	active   atomic.Int64
+	inFlight atomic.Int64
+	total    atomic.Int64
+	failed   atomic.Int64
+	bytes    atomic.Int64
+}
+
+// GetUploadStats returns the current upload counters
+func GetUploadStats() UploadStats {
+	return UploadStats{
+		ActiveUploads:   uploadCounters.active.Load(),
+		BytesInFlight:   uploadCounters.inFlight.Load(),
+		TotalUploads:    uploadCounters.total.Load(),
+		FailedUploads:   uploadCounters.failed.Load(),
+		TotalBytes:      uploadCounters.bytes.Load(),
+		BufferSize:      UploadBufferSize,
+		MaxUploadSize:   MaxUploadSize(),
+		MultipartMemory: MultipartMemory(),
+	}
+}
+
+// MaxUploadSize returns the maximum request body size for upload endpoints
+// in bytes, configured with MAX_UPLOAD_SIZE_MB (default 200 MB)
+func MaxUploadSize() int64 {
+	return envMegabytes("MAX_UPLOAD_SIZE_MB", 200)
+}
+
+// MultipartMemory returns how much of a multipart form is kept in memory
+// before file parts are spilled to temporary files, configured with
+// UPLOAD_MEMORY_MB (default 8 MB)
+func MultipartMemory() int64 {
+	return envMegabytes("UPLOAD_MEMORY_MB", 8)
+}
+
+func envMegabytes(name string, fallback int64) int64 {
+	if value := os.Getenv(name); value != "" {
+		if parsed, err := strconv.ParseInt(value, 10, 64); err == nil && parsed > 0 {
+			return parsed << 20
+		}
+	}
+	return fallback << 20
+}
+
+// copyBuffered copies r into w through a pooled, fixed-size buffer
+func copyBuffered(w io.Writer, r io.Reader) (int64, error) {
+	buf := uploadBufferPool.Get().(*[]byte)
+	defer uploadBufferPool.Put(buf)
+
+	// Hide WriterTo/ReaderFrom so io.CopyBuffer really uses our buffer
+	return io.CopyBuffer(struct{ io.Writer }{w}, struct{ io.Reader }{r}, *buf)
+}
+
+// uploadReader streams a multipart file and keeps the upload counters up to date
+type uploadReader struct {
+	file    multipart.File
+	name    string
+	read    int64
+	started time.Time
+}
+
+// openUpload opens a multipart file for streaming. The caller must call
+// finish with the result of the upload once the reader is no longer used.
+func openUpload(fileHeader *multipart.FileHeader) (*uploadReader, error) {
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %v", err)
+	}
+
+	uploadCounters.active.Add(1)
+	return &uploadReader{file: file, name: fileHeader.Filename, started: time.Now()}, nil
+}
+
+func (r *uploadReader) Read(p []byte) (int, error) {
+	n, err := r.file.Read(p)
+	r.read += int64(n)
+	uploadCounters.inFlight.Add(int64(n))
+	return n, err
+}
+
+// Seek rewinds the file when a transient storage error makes the upload retry
+func (r *uploadReader) Seek(offset int64, whence int) (int64, error) {
+	pos, err := r.file.Seek(offset, whence)
+	if err != nil {
+		return pos, err
+	}
+	uploadCounters.inFlight.Add(pos - r.read)
+	r.read = pos
+	return pos, nil
+}
+
+// finish closes the file and records the outcome of the upload
+func (r *uploadReader) finish(err error) {
+	r.file.Close()
+
+	uploadCounters.active.Add(-1)
+	uploadCounters.inFlight.Add(-r.read)
+	uploadCounters.total.Add(1)
+	if err != nil {
+		uploadCounters.failed.Add(1)
+		log.Printf("Upload of %s failed after %d bytes: %v", r.name, r.read, err)
+		return
+	}
+
+	uploadCounters.bytes.Add(r.read)
+	log.Printf("Uploaded %s (%d bytes) in %s", r.name, r.read, time.Since(r.started).Round(time.Millisecond))
+}
+
+// uploadTimeout scales the HTTP timeout with the file size so large masters
+// are not cut off, assuming at least 1 MB/s towards the storage backend
+func uploadTimeout(size int64) time.Duration {
+	return 30*time.Second + time.Duration(size>>20)*time.Second
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"mime/multipart"
@@ -34,19 +35,13 @@ func NewSupabaseStorageConfig() *SupabaseStorageConfig {
 	}
 }
 
-// UploadFile uploads a file to Supabase storage
-func (c *SupabaseStorageConfig) UploadFile(fileHeader *multipart.FileHeader, folder string) (string, error) {
-	file, err := fileHeader.Open()
+// UploadFile streams a file to Supabase storage without buffering it in memory
+func (c *SupabaseStorageConfig) UploadFile(fileHeader *multipart.FileHeader, folder string) (publicURL string, err error) {
+	file, err := openUpload(fileHeader)
 	if err != nil {
-		return "", fmt.Errorf("failed to open file: %v", err)
-	}
-	defer file.Close()
-
-	// Read file content
-	fileContent, err := io.ReadAll(file)
-	if err != nil {
-		return "", fmt.Errorf("failed to read file: %v", err)
+		return "", err
 	}
+	defer func() { file.finish(err) }()
 
 	// Get file extension
 	fileExt := filepath.Ext(fileHeader.Filename)
@@ -57,42 +52,58 @@ func (c *SupabaseStorageConfig) UploadFile(fileHeader *multipart.FileHeader, fol
 	// Create path
 	filePath := fmt.Sprintf("%s/%s", folder, uniqueFilename)
 
+	return c.PutObject(filePath, file, fileHeader.Size, fileHeader.Header.Get("Content-Type"))
+}
+
+// PutObject streams body to objectPath, replacing any existing object
+func (c *SupabaseStorageConfig) PutObject(objectPath string, body io.Reader, size int64, contentType string) (string, error) {
 	// Create URL for Supabase storage API
-	url := fmt.Sprintf("%s/storage/v1/object/%s/%s", c.SupabaseURL, c.StorageBucket, filePath)
+	url := fmt.Sprintf("%s/storage/v1/object/%s/%s", c.SupabaseURL, c.StorageBucket, objectPath)
 
-	// Create request
-	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(fileContent))
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %v", err)
-	}
+	err := withRetry("upload", body, func() error {
+		// Create request, the body is streamed without being buffered
+		req, err := http.NewRequest(http.MethodPost, url, body)
+		if err != nil {
+			return fmt.Errorf("failed to create request: %v", err)
+		}
+		req.ContentLength = size
 
-	// Add headers
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", c.SupabaseKey))
-	req.Header.Add("Content-Type", fileHeader.Header.Get("Content-Type"))
-	req.Header.Add("Cache-Control", "3600")
+		// Add headers
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", c.SupabaseKey))
+		req.Header.Add("Content-Type", contentType)
+		req.Header.Add("Cache-Control", "3600")
+		req.Header.Add("x-upsert", "true")
 
-	// Make request
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to upload file: %v", err)
-	}
-	defer resp.Body.Close()
+		// Make request
+		client := &http.Client{Timeout: uploadTimeout(size)}
+		resp, err := client.Do(req)
+		if err != nil {
+			return transportError("upload", err)
+		}
+		defer resp.Body.Close()
 
-	// Check response status
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("upload failed with status %d: %s", resp.StatusCode, string(bodyBytes))
+		// Check response status
+		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+			return responseError("upload", resp)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
 	}
 
 	// Return the file path that can be used to access the file
-	fullPath := fmt.Sprintf("%s/storage/v1/object/public/%s/%s", c.SupabaseURL, c.StorageBucket, filePath)
-	return fullPath, nil
+	return c.PublicURL(objectPath), nil
 }
 
-// UploadSongImage uploads a song image to Supabase storage
-func (c *SupabaseStorageConfig) UploadSongImage(fileHeader *multipart.FileHeader) (string, error) {
-	return c.UploadFile(fileHeader, c.ImageFolder)
+// UploadSongImage uploads a song image and its variants to Supabase storage
+func (c *SupabaseStorageConfig) UploadSongImage(fileHeader *multipart.FileHeader) (string, ImageVariants, error) {
+	return uploadSongImageFile(c, c.ImageFolder, fileHeader)
+}
+
+// UploadImage uploads an image and its variants into folder on Supabase storage
+func (c *SupabaseStorageConfig) UploadImage(fileHeader *multipart.FileHeader, folder string) (string, ImageVariants, error) {
+	return uploadSongImageFile(c, folder, fileHeader)
 }
 
 // UploadSongAudio uploads a song audio file to Supabase storage
@@ -100,8 +111,13 @@ func (c *SupabaseStorageConfig) UploadSongAudio(fileHeader *multipart.FileHeader
 	return c.UploadFile(fileHeader, c.AudioFolder)
 }
 
-// DeleteFile deletes a file from Supabase storage
-func (c *SupabaseStorageConfig) DeleteFile(filePath string) error {
+// UploadSongImageData uploads an in-memory song image, such as embedded cover art, and its variants
+func (c *SupabaseStorageConfig) UploadSongImageData(data []byte, contentType string) (string, ImageVariants, error) {
+	return uploadSongImage(c, c.ImageFolder, data, contentType)
+}
+
+// ObjectPath extracts the object path from a public Supabase URL
+func (c *SupabaseStorageConfig) ObjectPath(filePath string) (string, error) {
 	// Extract the path after the bucket/public part
 	// Example: https://your-project.supabase.co/storage/v1/object/public/bucket-name/folder/file.mp3
 	// We need: folder/file.mp3
@@ -119,33 +135,189 @@ func (c *SupabaseStorageConfig) DeleteFile(filePath string) error {
 	}
 
 	if publicIndex == -1 || publicIndex+2 >= len(parts) {
-		return fmt.Errorf("invalid file path format: %s", filePath)
+		return "", fmt.Errorf("invalid file path format: %s", filePath)
 	}
 
 	// Get everything after "public/bucket-name/"
 	relativeParts := parts[publicIndex+2:]
-	relativePath := strings.Join(relativeParts, "/")
+	return strings.Join(relativeParts, "/"), nil
+}
+
+// DeleteFile deletes a file from Supabase storage
+func (c *SupabaseStorageConfig) DeleteFile(filePath string) error {
+	relativePath, err := c.ObjectPath(filePath)
+	if err != nil {
+		return err
+	}
 
 	url := fmt.Sprintf("%s/storage/v1/object/%s/%s", c.SupabaseURL, c.StorageBucket, relativePath)
 
-	req, err := http.NewRequest(http.MethodDelete, url, nil)
+	return withRetry("delete", nil, func() error {
+		req, err := http.NewRequest(http.MethodDelete, url, nil)
+		if err != nil {
+			return fmt.Errorf("failed to create delete request: %v", err)
+		}
+
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", c.SupabaseKey))
+
+		client := &http.Client{Timeout: 10 * time.Second}
+		resp, err := client.Do(req)
+		if err != nil {
+			return transportError("delete", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+			return responseError("delete", resp)
+		}
+		return nil
+	})
+}
+
+// StatFile returns information about a file in Supabase storage
+func (c *SupabaseStorageConfig) StatFile(filePath string) (*FileInfo, error) {
+	relativePath, err := c.ObjectPath(filePath)
 	if err != nil {
-		return fmt.Errorf("failed to create delete request: %v", err)
+		return nil, err
 	}
 
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", c.SupabaseKey))
+	url := fmt.Sprintf("%s/storage/v1/object/authenticated/%s/%s", c.SupabaseURL, c.StorageBucket, relativePath)
+
+	var info *FileInfo
+	err = withRetry("stat", nil, func() error {
+		req, err := http.NewRequest(http.MethodHead, url, nil)
+		if err != nil {
+			return fmt.Errorf("failed to create stat request: %v", err)
+		}
+
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", c.SupabaseKey))
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
+		client := &http.Client{Timeout: 10 * time.Second}
+		resp, err := client.Do(req)
+		if err != nil {
+			return transportError("stat", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return responseError("stat", resp)
+		}
+
+		info = &FileInfo{
+			Path:        relativePath,
+			Size:        resp.ContentLength,
+			ContentType: resp.Header.Get("Content-Type"),
+		}
+		if lastModified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+			info.LastModified = lastModified
+		}
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("failed to delete file: %v", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("delete failed with status %d: %s", resp.StatusCode, string(bodyBytes))
+	return info, nil
+}
+
+// supabaseListPageSize is the number of entries requested per list call
+const supabaseListPageSize = 1000
+
+// supabaseObject is an entry returned by the Supabase list endpoint. Folders
+// have no id.
+type supabaseObject struct {
+	Name      string    `json:"name"`
+	ID        *string   `json:"id"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Metadata  struct {
+		Size     int64  `json:"size"`
+		MimeType string `json:"mimetype"`
+	} `json:"metadata"`
+}
+
+// ListObjects lists every file below prefix, descending into sub folders
+func (c *SupabaseStorageConfig) ListObjects(prefix string) ([]FileInfo, error) {
+	prefix = strings.Trim(prefix, "/")
+
+	var objects []FileInfo
+	for offset := 0; ; offset += supabaseListPageSize {
+		page, err := c.listPage(prefix, offset)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range page {
+			objectPath := prefix + "/" + entry.Name
+			if entry.ID == nil {
+				children, err := c.ListObjects(objectPath)
+				if err != nil {
+					return nil, err
+				}
+				objects = append(objects, children...)
+				continue
+			}
+
+			objects = append(objects, FileInfo{
+				Path:         objectPath,
+				Size:         entry.Metadata.Size,
+				ContentType:  entry.Metadata.MimeType,
+				LastModified: entry.UpdatedAt,
+			})
+		}
+
+		if len(page) < supabaseListPageSize {
+			return objects, nil
+		}
 	}
+}
+
+// listPage requests one page of the folder listing
+func (c *SupabaseStorageConfig) listPage(prefix string, offset int) ([]supabaseObject, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"prefix": prefix,
+		"limit":  supabaseListPageSize,
+		"offset": offset,
+		"sortBy": map[string]string{"column": "name", "order": "asc"},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf("%s/storage/v1/object/list/%s", c.SupabaseURL, c.StorageBucket)
+
+	var page []supabaseObject
+	err = withRetry("list", nil, func() error {
+		req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("failed to create list request: %v", err)
+		}
+
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", c.SupabaseKey))
+		req.Header.Add("Content-Type", "application/json")
+
+		client := &http.Client{Timeout: 30 * time.Second}
+		resp, err := client.Do(req)
+		if err != nil {
+			return transportError("list", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return responseError("list", resp)
+		}
+
+		if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+			return fmt.Errorf("failed to parse list response: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return page, nil
+}
 
-	return nil
+// PublicURL builds the public URL of an object in the Supabase bucket
+func (c *SupabaseStorageConfig) PublicURL(objectPath string) string {
+	return fmt.Sprintf("%s/storage/v1/object/public/%s/%s", c.SupabaseURL, c.StorageBucket, objectPath)
 }
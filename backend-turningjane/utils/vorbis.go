@@ -0,0 +1,319 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// === FLAC ===
+
+// readFLAC reads the STREAMINFO, VORBIS_COMMENT and PICTURE metadata blocks
+// of a FLAC stream starting at off
+func readFLAC(r io.ReaderAt, off int64, meta *AudioMetadata) error {
+	magic, err := readAt(r, off, 4)
+	if err != nil || string(magic) != "fLaC" {
+		return fmt.Errorf("invalid FLAC stream")
+	}
+	meta.Codec = "flac"
+
+	pos := off + 4
+	for {
+		header, err := readAt(r, pos, 4)
+		if err != nil {
+			return err
+		}
+		last := header[0]&0x80 != 0
+		blockType := header[0] & 0x7F
+		length := int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3])
+		body := pos + 4
+
+		switch blockType {
+		case 0: // STREAMINFO
+			info, err := readAt(r, body, 34)
+			if err != nil {
+				return err
+			}
+			readFLACStreamInfo(info, meta)
+		case 4: // VORBIS_COMMENT
+			block, err := readAt(r, body, length)
+			if err != nil {
+				return err
+			}
+			readVorbisComments(block, meta)
+		case 6: // PICTURE
+			if length <= maxPictureSize+1024 {
+				block, err := readAt(r, body, length)
+				if err != nil {
+					return err
+				}
+				readFLACPicture(block, meta)
+			}
+		}
+
+		if last {
+			return nil
+		}
+		pos = body + length
+	}
+}
+
+// readFLACStreamInfo decodes sample rate, channels and total samples
+func readFLACStreamInfo(info []byte, meta *AudioMetadata) {
+	packed := binary.BigEndian.Uint64(info[10:18])
+	sampleRate := int(packed >> 44)
+	channels := int((packed>>41)&0x07) + 1
+	totalSamples := packed & 0xFFFFFFFFF
+
+	meta.SampleRate = sampleRate
+	meta.Channels = channels
+	if sampleRate > 0 {
+		meta.DurationSeconds = float64(totalSamples) / float64(sampleRate)
+	}
+}
+
+// readFLACPicture decodes a FLAC PICTURE block, which is also the format of
+// the METADATA_BLOCK_PICTURE Vorbis comment
+func readFLACPicture(block []byte, meta *AudioMetadata) {
+	next := func(n uint32) ([]byte, bool) {
+		if uint64(n) > uint64(len(block)) {
+			return nil, false
+		}
+		out := block[:n]
+		block = block[n:]
+		return out, true
+	}
+	readUint := func() (uint32, bool) {
+		b, ok := next(4)
+		if !ok {
+			return 0, false
+		}
+		return binary.BigEndian.Uint32(b), true
+	}
+
+	pictureType, ok := readUint()
+	if !ok {
+		return
+	}
+	mimeLen, ok := readUint()
+	if !ok {
+		return
+	}
+	mimeType, ok := next(mimeLen)
+	if !ok {
+		return
+	}
+	descLen, ok := readUint()
+	if !ok {
+		return
+	}
+	// Description, then width, height, colour depth and palette size
+	if _, ok := next(descLen + 16); !ok {
+		return
+	}
+	dataLen, ok := readUint()
+	if !ok {
+		return
+	}
+	data, ok := next(dataLen)
+	if !ok {
+		return
+	}
+
+	meta.setPicture(strings.ToLower(string(mimeType)), data, pictureType == 3)
+}
+
+// readVorbisComments decodes a little-endian Vorbis comment block
+func readVorbisComments(block []byte, meta *AudioMetadata) {
+	if len(block) < 8 {
+		return
+	}
+	vendorLen := uint64(binary.LittleEndian.Uint32(block))
+	if 4+vendorLen+4 > uint64(len(block)) {
+		return
+	}
+	block = block[4+vendorLen:]
+	count := binary.LittleEndian.Uint32(block)
+	block = block[4:]
+
+	coverMIME := "image/jpeg"
+	var legacyCover string
+	for i := uint32(0); i < count && len(block) >= 4; i++ {
+		n := uint64(binary.LittleEndian.Uint32(block))
+		if 4+n > uint64(len(block)) {
+			return
+		}
+		comment := string(block[4 : 4+n])
+		block = block[4+n:]
+
+		key, value, found := strings.Cut(comment, "=")
+		if !found {
+			continue
+		}
+
+		switch strings.ToUpper(key) {
+		case "METADATA_BLOCK_PICTURE":
+			if data, err := base64.StdEncoding.DecodeString(value); err == nil {
+				readFLACPicture(data, meta)
+			}
+		case "COVERART":
+			legacyCover = value
+		case "COVERARTMIME":
+			coverMIME = value
+		default:
+			meta.setTag(key, string(bytes.ToValidUTF8([]byte(value), nil)))
+		}
+	}
+
+	if legacyCover != "" {
+		if data, err := base64.StdEncoding.DecodeString(legacyCover); err == nil {
+			meta.setPicture(coverMIME, data, false)
+		}
+	}
+}
+
+// === Ogg ===
+
+// oggPage is the header of an Ogg page
+type oggPage struct {
+	granule  int64
+	serial   uint32
+	segments []byte
+	bodyOff  int64
+}
+
+// readOggPage reads the page header at off
+func readOggPage(r io.ReaderAt, off int64) (*oggPage, error) {
+	header, err := readAt(r, off, 27)
+	if err != nil {
+		return nil, err
+	}
+	if string(header[:4]) != "OggS" {
+		return nil, fmt.Errorf("invalid Ogg page at %d", off)
+	}
+	segments, err := readAt(r, off+27, int64(header[26]))
+	if err != nil {
+		return nil, err
+	}
+	return &oggPage{
+		granule:  int64(binary.LittleEndian.Uint64(header[6:])),
+		serial:   binary.LittleEndian.Uint32(header[14:]),
+		segments: segments,
+		bodyOff:  off + 27 + int64(len(segments)),
+	}, nil
+}
+
+// readOggPackets reassembles the first n packets of the first logical stream
+func readOggPackets(r io.ReaderAt, size int64, n int) ([][]byte, uint32, error) {
+	var packets [][]byte
+	var current []byte
+	var serial uint32
+
+	for off := int64(0); off < size && len(packets) < n; {
+		page, err := readOggPage(r, off)
+		if err != nil {
+			return nil, 0, err
+		}
+		if off == 0 {
+			serial = page.serial
+		}
+
+		bodyLen := int64(0)
+		for _, s := range page.segments {
+			bodyLen += int64(s)
+		}
+
+		if page.serial == serial {
+			body, err := readAt(r, page.bodyOff, bodyLen)
+			if err != nil {
+				return nil, 0, err
+			}
+			for _, s := range page.segments {
+				current = append(current, body[:s]...)
+				body = body[s:]
+				if s < 255 {
+					packets = append(packets, current)
+					current = nil
+					if len(packets) == n {
+						break
+					}
+				}
+			}
+			if len(current) > maxPictureSize*2 {
+				return nil, 0, fmt.Errorf("Ogg header packet too large")
+			}
+		}
+
+		off = page.bodyOff + bodyLen
+	}
+
+	if len(packets) < n {
+		return nil, 0, fmt.Errorf("missing Ogg header packets")
+	}
+	return packets, serial, nil
+}
+
+// lastOggGranule finds the granule position of the last page of a stream
+func lastOggGranule(r io.ReaderAt, size int64, serial uint32) int64 {
+	start := max(0, size-64<<10)
+	tail, err := readAt(r, start, size-start)
+	if err != nil {
+		return 0
+	}
+
+	for i := bytes.LastIndex(tail, []byte("OggS")); i >= 0; i = bytes.LastIndex(tail[:i], []byte("OggS")) {
+		if page, err := readOggPage(r, start+int64(i)); err == nil && page.serial == serial && page.granule > 0 {
+			return page.granule
+		}
+	}
+	return 0
+}
+
+// readOgg reads Ogg Vorbis and Ogg Opus identification and comment headers
+func readOgg(r io.ReaderAt, size int64, meta *AudioMetadata) error {
+	packets, serial, err := readOggPackets(r, size, 2)
+	if err != nil {
+		return err
+	}
+	ident, comments := packets[0], packets[1]
+
+	var preSkip int64
+	switch {
+	case len(ident) >= 30 && bytes.HasPrefix(ident, []byte("\x01vorbis")):
+		meta.Codec = "vorbis"
+		meta.Channels = int(ident[11])
+		meta.SampleRate = int(binary.LittleEndian.Uint32(ident[12:]))
+		if nominal := int32(binary.LittleEndian.Uint32(ident[20:])); nominal > 0 {
+			meta.Bitrate = int(nominal / 1000)
+		}
+		if bytes.HasPrefix(comments, []byte("\x03vorbis")) {
+			readVorbisComments(comments[7:], meta)
+		}
+	case len(ident) >= 19 && bytes.HasPrefix(ident, []byte("OpusHead")):
+		meta.Codec = "opus"
+		meta.Channels = int(ident[9])
+		preSkip = int64(binary.LittleEndian.Uint16(ident[10:]))
+		// Opus granule positions always count 48 kHz samples
+		meta.SampleRate = 48000
+		if inputRate := int(binary.LittleEndian.Uint32(ident[12:])); inputRate > 0 {
+			meta.SampleRate = inputRate
+		}
+		if bytes.HasPrefix(comments, []byte("OpusTags")) {
+			readVorbisComments(comments[8:], meta)
+		}
+		if granule := lastOggGranule(r, size, serial); granule > preSkip {
+			meta.DurationSeconds = float64(granule-preSkip) / 48000
+		}
+		return nil
+	default:
+		return ErrUnsupportedAudio
+	}
+
+	if granule := lastOggGranule(r, size, serial); granule > 0 && meta.SampleRate > 0 {
+		meta.DurationSeconds = float64(granule) / float64(meta.SampleRate)
+	}
+	return nil
+}
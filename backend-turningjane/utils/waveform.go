@@ -0,0 +1,228 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"mime/multipart"
+
+	"github.com/hajimehoshi/go-mp3"
+)
+
+// WaveformResolution is the number of peaks stored for every song
+const WaveformResolution = 800
+
+// ComputeWaveformFromFile opens an uploaded file and computes its peaks
+func ComputeWaveformFromFile(fileHeader *multipart.FileHeader, resolution int) ([]float64, error) {
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %v", err)
+	}
+	defer file.Close()
+
+	return ComputeWaveform(file, fileHeader.Size, resolution)
+}
+
+// ComputeWaveform returns up to resolution peaks between 0 and 1 for a WAV or
+// MP3 file. Each peak is the loudest point of its slice of the track.
+func ComputeWaveform(r io.ReaderAt, size int64, resolution int) ([]float64, error) {
+	if resolution <= 0 {
+		return nil, fmt.Errorf("invalid waveform resolution %d", resolution)
+	}
+
+	head := make([]byte, sniffLength)
+	n, err := r.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read file: %v", err)
+	}
+
+	var peaks []float64
+	switch DetectContentType(head[:n]) {
+	case "audio/wav":
+		peaks, err = wavPeaks(r, size, resolution)
+	case "audio/mpeg":
+		peaks, err = mp3Peaks(r, size, resolution)
+	default:
+		return nil, ErrUnsupportedAudio
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Four decimals are plenty for drawing and keep the JSON small
+	for i, p := range peaks {
+		peaks[i] = math.Round(min(p, 1)*10000) / 10000
+	}
+	return peaks, nil
+}
+
+// peakBuckets folds a stream of levels into a fixed number of buckets
+type peakBuckets struct {
+	peaks []float64
+	total int64
+	index int64
+}
+
+func newPeakBuckets(total int64, resolution int) *peakBuckets {
+	if total < int64(resolution) {
+		resolution = int(total)
+	}
+	return &peakBuckets{peaks: make([]float64, resolution), total: total}
+}
+
+// add records the level of the next item of the stream
+func (b *peakBuckets) add(level float64) {
+	if b.index >= b.total || len(b.peaks) == 0 {
+		return
+	}
+	bucket := b.index * int64(len(b.peaks)) / b.total
+	if level > b.peaks[bucket] {
+		b.peaks[bucket] = level
+	}
+	b.index++
+}
+
+// === WAV ===
+
+// wavPeaks decodes the PCM samples of a RIFF WAVE file
+func wavPeaks(r io.ReaderAt, size int64, resolution int) ([]float64, error) {
+	var format, channels, bitsPerSample uint16
+	var dataOff, dataSize int64
+
+	for off := int64(12); off+8 <= size; {
+		header, err := readAt(r, off, 8)
+		if err != nil {
+			return nil, err
+		}
+		chunkSize := int64(binary.LittleEndian.Uint32(header[4:]))
+		body := off + 8
+
+		switch string(header[:4]) {
+		case "fmt ":
+			fmtChunk, err := readAt(r, body, min(chunkSize, 40))
+			if err != nil {
+				return nil, err
+			}
+			if len(fmtChunk) < 16 {
+				return nil, fmt.Errorf("invalid WAV fmt chunk")
+			}
+			format = binary.LittleEndian.Uint16(fmtChunk[0:])
+			channels = binary.LittleEndian.Uint16(fmtChunk[2:])
+			bitsPerSample = binary.LittleEndian.Uint16(fmtChunk[14:])
+			if format == 0xFFFE && len(fmtChunk) >= 26 {
+				format = binary.LittleEndian.Uint16(fmtChunk[24:])
+			}
+		case "data":
+			dataOff, dataSize = body, min(chunkSize, size-body)
+		}
+
+		off = body + chunkSize + chunkSize%2
+	}
+
+	if dataOff == 0 || channels == 0 {
+		return nil, fmt.Errorf("WAV file has no audio data")
+	}
+
+	var sample func(b []byte) float64
+	switch {
+	case format == 1 && bitsPerSample == 8:
+		sample = func(b []byte) float64 { return math.Abs(float64(int(b[0])-128)) / 128 }
+	case format == 1 && bitsPerSample == 16:
+		sample = func(b []byte) float64 { return math.Abs(float64(int16(binary.LittleEndian.Uint16(b)))) / (1 << 15) }
+	case format == 1 && bitsPerSample == 24:
+		sample = func(b []byte) float64 {
+			v := int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24) >> 8
+			return math.Abs(float64(v)) / (1 << 23)
+		}
+	case format == 1 && bitsPerSample == 32:
+		sample = func(b []byte) float64 { return math.Abs(float64(int32(binary.LittleEndian.Uint32(b)))) / (1 << 31) }
+	case format == 3 && bitsPerSample == 32:
+		sample = func(b []byte) float64 { return math.Abs(float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))) }
+	case format == 3 && bitsPerSample == 64:
+		sample = func(b []byte) float64 { return math.Abs(math.Float64frombits(binary.LittleEndian.Uint64(b))) }
+	default:
+		return nil, fmt.Errorf("unsupported WAV encoding %d with %d bits: %w", format, bitsPerSample, ErrUnsupportedAudio)
+	}
+
+	sampleSize := int(bitsPerSample / 8)
+	frameSize := sampleSize * int(channels)
+	buckets := newPeakBuckets(dataSize/int64(frameSize), resolution)
+
+	reader := bufio.NewReaderSize(io.NewSectionReader(r, dataOff, dataSize), UploadBufferSize)
+	frame := make([]byte, frameSize)
+	for {
+		if _, err := io.ReadFull(reader, frame); err != nil {
+			break
+		}
+		level := 0.0
+		for ch := 0; ch < frameSize; ch += sampleSize {
+			level = max(level, sample(frame[ch:ch+sampleSize]))
+		}
+		buckets.add(level)
+	}
+
+	return buckets.peaks, nil
+}
+
+// === MP3 ===
+
+// mp3Peaks decodes an MPEG Layer III stream to PCM with a pure Go decoder and
+// takes the peaks of the decoded samples, so they are on the same scale as
+// the peaks of a WAV file. The decoder indexes its tables without bounds
+// checks, so a panic on a malformed stream is returned as an error.
+func mp3Peaks(r io.ReaderAt, size int64, resolution int) (peaks []float64, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			peaks, err = nil, fmt.Errorf("failed to decode MP3: %v", p)
+		}
+	}()
+
+	audioStart, err := readID3v2(r, 0, &AudioMetadata{})
+	if err != nil {
+		return nil, err
+	}
+	audioEnd := size
+	if tag, err := readAt(r, size-128, 3); err == nil && string(tag) == "TAG" {
+		audioEnd -= 128
+	}
+
+	_, first, err := findMPEGFrame(r, audioStart, audioEnd)
+	if err != nil {
+		return nil, err
+	}
+	if first.layer != 3 {
+		return nil, fmt.Errorf("MPEG layer %d: %w", first.layer, ErrUnsupportedAudio)
+	}
+
+	decoder, err := mp3.NewDecoder(io.NewSectionReader(r, audioStart, audioEnd-audioStart))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode MP3: %v", err)
+	}
+
+	// The decoder always returns 16-bit little-endian stereo samples
+	const frameSize = 4
+	total := decoder.Length() / frameSize
+	if total <= 0 {
+		return nil, fmt.Errorf("no MPEG audio frames found")
+	}
+	buckets := newPeakBuckets(total, resolution)
+
+	reader := bufio.NewReaderSize(decoder, UploadBufferSize)
+	frame := make([]byte, frameSize)
+	for {
+		if _, err := io.ReadFull(reader, frame); err != nil {
+			// A damaged frame near the end still leaves a usable waveform
+			if buckets.index == 0 {
+				return nil, fmt.Errorf("failed to decode MP3: %v", err)
+			}
+			break
+		}
+		left := math.Abs(float64(int16(binary.LittleEndian.Uint16(frame[0:])))) / (1 << 15)
+		right := math.Abs(float64(int16(binary.LittleEndian.Uint16(frame[2:])))) / (1 << 15)
+		buckets.add(max(left, right))
+	}
+
+	return buckets.peaks, nil
+}
@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestComputeWaveformMalformedMP3(t *testing.T) {
+	// MPEG-2 Layer III, 64 kbps, 22.05 kHz, mono. The side info declares a
+	// mixed short block, which makes go-mp3 index past its scalefactor list.
+	frame := make([]byte, 72*64000/22050)
+	copy(frame, []byte{0xFF, 0xF3, 0x80, 0xC4})
+	copy(frame[4:], []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0xA0, 0x00, 0x00})
+	stream := bytes.Repeat(frame, 4)
+
+	peaks, err := ComputeWaveform(bytes.NewReader(stream), int64(len(stream)), WaveformResolution)
+	if err == nil {
+		t.Fatalf("ComputeWaveform returned %d peaks for a malformed stream, want an error", len(peaks))
+	}
+}
+
+func TestComputeWaveformMP3(t *testing.T) {
+	stream := mp3Stream(xingFrame(40), 40)
+	peaks, err := ComputeWaveform(bytes.NewReader(stream), int64(len(stream)), 100)
+	if err != nil {
+		t.Fatalf("ComputeWaveform: %v", err)
+	}
+	if len(peaks) != 100 {
+		t.Errorf("got %d peaks, want 100", len(peaks))
+	}
+}
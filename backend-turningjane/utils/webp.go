@@ -0,0 +1,613 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"sort"
+)
+
+// EncodeWebP writes img as a lossless WebP (VP8L) image. The encoder applies
+// the subtract-green and predictor transforms and LZ77 backward references,
+// which is enough to stay close to PNG sizes without any cgo dependency.
+func EncodeWebP(w io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width < 1 || height < 1 || width > 1<<14 || height > 1<<14 {
+		return fmt.Errorf("invalid WebP size %dx%d", width, height)
+	}
+
+	nrgba, ok := img.(*image.NRGBA)
+	if !ok || nrgba.Rect.Min != (image.Point{}) {
+		nrgba = image.NewNRGBA(image.Rect(0, 0, width, height))
+		draw.Draw(nrgba, nrgba.Bounds(), img, bounds.Min, draw.Src)
+	}
+
+	argb := make([]uint32, width*height)
+	hasAlpha := false
+	for y := 0; y < height; y++ {
+		row := nrgba.Pix[y*nrgba.Stride:]
+		for x := 0; x < width; x++ {
+			r, g, b, a := row[4*x], row[4*x+1], row[4*x+2], row[4*x+3]
+			if a != 0xFF {
+				hasAlpha = true
+			}
+			argb[y*width+x] = uint32(a)<<24 | uint32(r)<<16 | uint32(g)<<8 | uint32(b)
+		}
+	}
+
+	bw := &webpBitWriter{}
+	bw.writeBits(0x2F, 8)
+	bw.writeBits(uint32(width-1), 14)
+	bw.writeBits(uint32(height-1), 14)
+	if hasAlpha {
+		bw.writeBits(1, 1)
+	} else {
+		bw.writeBits(0, 1)
+	}
+	bw.writeBits(0, 3) // version
+
+	// Subtract green transform
+	bw.writeBits(1, 1)
+	bw.writeBits(2, 2)
+	for i, p := range argb {
+		g := (p >> 8) & 0xFF
+		r := ((p >> 16) - g) & 0xFF
+		b := (p - g) & 0xFF
+		argb[i] = p&0xFF00FF00 | r<<16 | b
+	}
+
+	// Predictor transform, one mode per tile
+	const tileBits = 5
+	bw.writeBits(1, 1)
+	bw.writeBits(0, 2)
+	bw.writeBits(tileBits-2, 3)
+	modes, tilesX, tilesY := choosePredictors(argb, width, height, tileBits)
+	modeImage := make([]uint32, len(modes))
+	for i, m := range modes {
+		modeImage[i] = 0xFF000000 | uint32(m)<<8
+	}
+	residuals := applyPredictors(argb, width, height, tileBits, modes)
+	writeWebPImage(bw, modeImage, tilesX, tilesY, false)
+
+	bw.writeBits(0, 1) // no more transforms
+	writeWebPImage(bw, residuals, width, height, true)
+
+	data := bw.bytes()
+	var header [20]byte
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(4+8+len(data)+len(data)%2))
+	copy(header[8:], "WEBPVP8L")
+	binary.LittleEndian.PutUint32(header[16:], uint32(len(data)))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	if len(data)%2 == 1 {
+		data = append(data, 0)
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// webpBitWriter packs bits least significant bit first
+type webpBitWriter struct {
+	buf   bytes.Buffer
+	acc   uint64
+	nbits uint
+}
+
+func (w *webpBitWriter) writeBits(v uint32, n uint) {
+	w.acc |= uint64(v) << w.nbits
+	w.nbits += n
+	for w.nbits >= 8 {
+		w.buf.WriteByte(byte(w.acc))
+		w.acc >>= 8
+		w.nbits -= 8
+	}
+}
+
+func (w *webpBitWriter) bytes() []byte {
+	if w.nbits > 0 {
+		w.buf.WriteByte(byte(w.acc))
+		w.acc, w.nbits = 0, 0
+	}
+	return w.buf.Bytes()
+}
+
+// === Predictor transform ===
+
+func webpAverage(a, b uint32) uint32 {
+	return (((a ^ b) & 0xFEFEFEFE) >> 1) + (a & b)
+}
+
+func webpSelect(l, t, tl uint32) uint32 {
+	var pl, pt int
+	for shift := 0; shift < 32; shift += 8 {
+		c := int(tl >> shift & 0xFF)
+		pl += webpAbs(c - int(t>>shift&0xFF))
+		pt += webpAbs(c - int(l>>shift&0xFF))
+	}
+	if pl < pt {
+		return l
+	}
+	return t
+}
+
+func webpClampFull(a, b, c uint32) uint32 {
+	var out uint32
+	for shift := 0; shift < 32; shift += 8 {
+		v := int(a>>shift&0xFF) + int(b>>shift&0xFF) - int(c>>shift&0xFF)
+		out |= uint32(webpClamp(v)) << shift
+	}
+	return out
+}
+
+func webpClampHalf(a, b uint32) uint32 {
+	var out uint32
+	for shift := 0; shift < 32; shift += 8 {
+		x := int(a >> shift & 0xFF)
+		v := x + (x-int(b>>shift&0xFF))/2
+		out |= uint32(webpClamp(v)) << shift
+	}
+	return out
+}
+
+func webpClamp(v int) int {
+	return min(max(v, 0), 255)
+}
+
+func webpAbs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// webpPredict returns the prediction of mode for the pixel at i, which is
+// neither on the first row nor in the first column
+func webpPredict(mode int, argb []uint32, i, width int) uint32 {
+	l, t, tl, tr := argb[i-1], argb[i-width], argb[i-width-1], argb[i-width+1]
+	switch mode {
+	case 0:
+		return 0xFF000000
+	case 1:
+		return l
+	case 2:
+		return t
+	case 3:
+		return tr
+	case 4:
+		return tl
+	case 5:
+		return webpAverage(webpAverage(l, tr), t)
+	case 6:
+		return webpAverage(l, tl)
+	case 7:
+		return webpAverage(l, t)
+	case 8:
+		return webpAverage(tl, t)
+	case 9:
+		return webpAverage(t, tr)
+	case 10:
+		return webpAverage(webpAverage(l, tl), webpAverage(t, tr))
+	case 11:
+		return webpSelect(l, t, tl)
+	case 12:
+		return webpClampFull(l, t, tl)
+	default:
+		return webpClampHalf(webpAverage(l, t), tl)
+	}
+}
+
+// webpSub subtracts every channel of b from a modulo 256
+func webpSub(a, b uint32) uint32 {
+	ag := (a | 0x00FF00FF) - (b & 0xFF00FF00)
+	rb := (a | 0xFF00FF00) - (b & 0x00FF00FF)
+	return ag&0xFF00FF00 | rb&0x00FF00FF
+}
+
+// webpResidualCost estimates how expensive a residual is to entropy code
+func webpResidualCost(r uint32) int {
+	cost := 0
+	for shift := 0; shift < 32; shift += 8 {
+		cost += webpAbs(int(int8(r >> shift)))
+	}
+	return cost
+}
+
+// choosePredictors picks, for every tile, the mode with the smallest residuals
+func choosePredictors(argb []uint32, width, height, bits int) ([]int, int, int) {
+	tileSize := 1 << bits
+	tilesX := (width + tileSize - 1) >> bits
+	tilesY := (height + tileSize - 1) >> bits
+	modes := make([]int, tilesX*tilesY)
+
+	for ty := 0; ty < tilesY; ty++ {
+		for tx := 0; tx < tilesX; tx++ {
+			best, bestCost := 11, -1
+			for mode := 0; mode < 14; mode++ {
+				cost := 0
+				for y := max(ty*tileSize, 1); y < min((ty+1)*tileSize, height); y++ {
+					for x := max(tx*tileSize, 1); x < min((tx+1)*tileSize, width); x++ {
+						i := y*width + x
+						cost += webpResidualCost(webpSub(argb[i], webpPredict(mode, argb, i, width)))
+					}
+				}
+				if bestCost < 0 || cost < bestCost {
+					best, bestCost = mode, cost
+				}
+			}
+			modes[ty*tilesX+tx] = best
+		}
+	}
+	return modes, tilesX, tilesY
+}
+
+// applyPredictors returns the residual image, the first row is always
+// predicted from the left and the first column from the top
+func applyPredictors(argb []uint32, width, height, bits int, modes []int) []uint32 {
+	tilesX := (width + (1 << bits) - 1) >> bits
+	out := make([]uint32, len(argb))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := y*width + x
+			var pred uint32
+			switch {
+			case x == 0 && y == 0:
+				pred = 0xFF000000
+			case y == 0:
+				pred = argb[i-1]
+			case x == 0:
+				pred = argb[i-width]
+			default:
+				pred = webpPredict(modes[(y>>bits)*tilesX+(x>>bits)], argb, i, width)
+			}
+			out[i] = webpSub(argb[i], pred)
+		}
+	}
+	return out
+}
+
+// === Entropy coding ===
+
+const (
+	webpLengthCodes   = 24
+	webpDistanceCodes = 40
+	webpMaxLength     = 4096
+	webpWindow        = 1 << 16
+	webpHashChain     = 16
+)
+
+// webpSymbol is either a literal pixel or a backward reference
+type webpSymbol struct {
+	argb     uint32
+	length   int
+	distance int
+}
+
+// webpPrefix splits a length or distance into its prefix code and extra bits
+func webpPrefix(v int) (code int, extraBits uint, extra uint32) {
+	x := v - 1
+	if x < 4 {
+		return x, 0, 0
+	}
+	h := 0
+	for 1<<(h+1) <= x {
+		h++
+	}
+	second := (x >> (h - 1)) & 1
+	extraBits = uint(h - 1)
+	return 2*h + second, extraBits, uint32(x & (1<<extraBits - 1))
+}
+
+// webpBackwardRefs finds LZ77 matches with a small hash chain
+func webpBackwardRefs(argb []uint32) []webpSymbol {
+	const hashBits = 16
+	head := make([]int, 1<<hashBits)
+	for i := range head {
+		head[i] = -1
+	}
+	prev := make([]int, len(argb))
+	hash := func(i int) uint32 {
+		return (argb[i]*0x9E3779B1 ^ argb[i+1]*0x85EBCA6B) >> (32 - hashBits)
+	}
+	insert := func(i int) {
+		if i+1 < len(argb) {
+			h := hash(i)
+			prev[i] = head[h]
+			head[h] = i
+		}
+	}
+
+	var symbols []webpSymbol
+	for i := 0; i < len(argb); {
+		bestLen, bestDist := 0, 0
+		if i+1 < len(argb) {
+			limit := min(len(argb)-i, webpMaxLength)
+			for cand, n := head[hash(i)], 0; cand >= 0 && i-cand <= webpWindow && n < webpHashChain; cand, n = prev[cand], n+1 {
+				l := 0
+				for l < limit && argb[cand+l] == argb[i+l] {
+					l++
+				}
+				if l > bestLen {
+					bestLen, bestDist = l, i-cand
+					if l == limit {
+						break
+					}
+				}
+			}
+		}
+
+		if bestLen >= 3 {
+			symbols = append(symbols, webpSymbol{length: bestLen, distance: bestDist})
+			for j := i; j < i+bestLen; j++ {
+				insert(j)
+			}
+			i += bestLen
+			continue
+		}
+
+		symbols = append(symbols, webpSymbol{argb: argb[i]})
+		insert(i)
+		i++
+	}
+	return symbols
+}
+
+// writeWebPImage entropy codes an image with a single group of prefix codes
+func writeWebPImage(bw *webpBitWriter, argb []uint32, width, height int, withMetaPrefix bool) {
+	symbols := webpBackwardRefs(argb)
+
+	green := make([]int, 256+webpLengthCodes)
+	red := make([]int, 256)
+	blue := make([]int, 256)
+	alpha := make([]int, 256)
+	dist := make([]int, webpDistanceCodes)
+	for _, s := range symbols {
+		if s.length == 0 {
+			green[s.argb>>8&0xFF]++
+			red[s.argb>>16&0xFF]++
+			blue[s.argb&0xFF]++
+			alpha[s.argb>>24]++
+			continue
+		}
+		code, _, _ := webpPrefix(s.length)
+		green[256+code]++
+		code, _, _ = webpPrefix(s.distance + 120)
+		dist[code]++
+	}
+
+	bw.writeBits(0, 1) // no color cache
+	if withMetaPrefix {
+		bw.writeBits(0, 1) // a single prefix code group
+	}
+
+	codes := make([]*webpHuffman, 5)
+	for i, counts := range [][]int{green, red, blue, alpha, dist} {
+		codes[i] = newWebPHuffman(counts, 15)
+		codes[i].write(bw)
+	}
+
+	for _, s := range symbols {
+		if s.length == 0 {
+			codes[0].writeSymbol(bw, int(s.argb>>8&0xFF))
+			codes[1].writeSymbol(bw, int(s.argb>>16&0xFF))
+			codes[2].writeSymbol(bw, int(s.argb&0xFF))
+			codes[3].writeSymbol(bw, int(s.argb>>24))
+			continue
+		}
+		code, n, extra := webpPrefix(s.length)
+		codes[0].writeSymbol(bw, 256+code)
+		bw.writeBits(extra, n)
+		code, n, extra = webpPrefix(s.distance + 120)
+		codes[4].writeSymbol(bw, code)
+		bw.writeBits(extra, n)
+	}
+}
+
+// webpHuffman is a canonical prefix code
+type webpHuffman struct {
+	lengths []int
+	codes   []uint32
+	// single is set when only one symbol is used, which takes zero bits
+	single bool
+}
+
+// newWebPHuffman builds code lengths no longer than maxLength from counts
+func newWebPHuffman(counts []int, maxLength int) *webpHuffman {
+	h := &webpHuffman{lengths: make([]int, len(counts)), codes: make([]uint32, len(counts))}
+
+	var used []int
+	for sym, c := range counts {
+		if c > 0 {
+			used = append(used, sym)
+		}
+	}
+	switch len(used) {
+	case 0:
+		h.single = true
+		return h
+	case 1:
+		h.single = true
+		h.lengths[used[0]] = 1
+		return h
+	}
+
+	// Flatten the histogram until the tree fits in maxLength
+	for minCount := 1; ; minCount *= 2 {
+		adjusted := make([]int, len(counts))
+		for _, sym := range used {
+			adjusted[sym] = max(counts[sym], minCount)
+		}
+		if huffmanLengths(adjusted, used, h.lengths) <= maxLength {
+			break
+		}
+	}
+
+	// Assign canonical codes ordered by length, then by symbol
+	var blCount [16]int
+	for _, l := range h.lengths {
+		if l > 0 {
+			blCount[l]++
+		}
+	}
+	var next [16]uint32
+	code := uint32(0)
+	for bits := 1; bits < 16; bits++ {
+		code = (code + uint32(blCount[bits-1])) << 1
+		next[bits] = code
+	}
+	for sym, l := range h.lengths {
+		if l > 0 {
+			h.codes[sym] = reverseBits(next[l], l)
+			next[l]++
+		}
+	}
+	return h
+}
+
+// huffmanLengths fills lengths with the Huffman code lengths of counts and
+// returns the longest one
+func huffmanLengths(counts []int, used []int, lengths []int) int {
+	type node struct {
+		count       int
+		left, right int
+		symbol      int
+	}
+	nodes := make([]node, 0, 2*len(used))
+	for _, sym := range used {
+		nodes = append(nodes, node{count: counts[sym], left: -1, right: -1, symbol: sym})
+	}
+
+	// Repeatedly merge the two lightest trees
+	queue := make([]int, len(nodes))
+	for i := range queue {
+		queue[i] = i
+	}
+	for len(queue) > 1 {
+		sort.Slice(queue, func(a, b int) bool {
+			if nodes[queue[a]].count != nodes[queue[b]].count {
+				return nodes[queue[a]].count < nodes[queue[b]].count
+			}
+			return queue[a] < queue[b]
+		})
+		a, b := queue[0], queue[1]
+		nodes = append(nodes, node{count: nodes[a].count + nodes[b].count, left: a, right: b, symbol: -1})
+		queue = append(queue[2:], len(nodes)-1)
+	}
+
+	for i := range lengths {
+		lengths[i] = 0
+	}
+	longest := 0
+	var walk func(n, depth int)
+	walk = func(n, depth int) {
+		if nodes[n].symbol >= 0 {
+			lengths[nodes[n].symbol] = depth
+			longest = max(longest, depth)
+			return
+		}
+		walk(nodes[n].left, depth+1)
+		walk(nodes[n].right, depth+1)
+	}
+	walk(queue[0], 0)
+	return longest
+}
+
+func reverseBits(v uint32, n int) uint32 {
+	var out uint32
+	for i := 0; i < n; i++ {
+		out = out<<1 | v&1
+		v >>= 1
+	}
+	return out
+}
+
+func (h *webpHuffman) writeSymbol(bw *webpBitWriter, sym int) {
+	if h.single {
+		return
+	}
+	bw.writeBits(h.codes[sym], uint(h.lengths[sym]))
+}
+
+// webpCodeLengthOrder is the order in which code length code lengths are sent
+var webpCodeLengthOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// write sends the code, using the simple form for one or two small symbols
+func (h *webpHuffman) write(bw *webpBitWriter) {
+	var used []int
+	for sym, l := range h.lengths {
+		if l > 0 {
+			used = append(used, sym)
+		}
+	}
+
+	if len(used) == 0 || (len(used) <= 2 && used[len(used)-1] < 256) {
+		bw.writeBits(1, 1) // simple code
+		if len(used) == 0 {
+			used = []int{0}
+		}
+		bw.writeBits(uint32(len(used)-1), 1)
+		if used[0] < 2 {
+			bw.writeBits(0, 1)
+			bw.writeBits(uint32(used[0]), 1)
+		} else {
+			bw.writeBits(1, 1)
+			bw.writeBits(uint32(used[0]), 8)
+		}
+		if len(used) == 2 {
+			bw.writeBits(uint32(used[1]), 8)
+		}
+		return
+	}
+
+	// Normal code: run-length encode the code lengths
+	type token struct{ symbol, extra, extraBits int }
+	var tokens []token
+	lengths := h.lengths
+	for i := 0; i < len(lengths); {
+		l := lengths[i]
+		run := 1
+		for i+run < len(lengths) && lengths[i+run] == l {
+			run++
+		}
+		switch {
+		case l == 0 && run >= 11:
+			run = min(run, 138)
+			tokens = append(tokens, token{18, run - 11, 7})
+		case l == 0 && run >= 3:
+			tokens = append(tokens, token{17, run - 3, 3})
+		case l != 0 && run >= 4:
+			run = min(run, 7)
+			tokens = append(tokens, token{l, 0, 0}, token{16, run - 4, 2})
+		default:
+			run = 1
+			tokens = append(tokens, token{l, 0, 0})
+		}
+		i += run
+	}
+
+	counts := make([]int, 19)
+	for _, t := range tokens {
+		counts[t.symbol]++
+	}
+	lengthCode := newWebPHuffman(counts, 7)
+
+	numCodes := 19
+	for numCodes > 4 && lengthCode.lengths[webpCodeLengthOrder[numCodes-1]] == 0 {
+		numCodes--
+	}
+	bw.writeBits(0, 1) // normal code
+	bw.writeBits(uint32(numCodes-4), 4)
+	for i := 0; i < numCodes; i++ {
+		bw.writeBits(uint32(lengthCode.lengths[webpCodeLengthOrder[i]]), 3)
+	}
+	bw.writeBits(0, 1) // code lengths for the whole alphabet follow
+	for _, t := range tokens {
+		lengthCode.writeSymbol(bw, t.symbol)
+		bw.writeBits(uint32(t.extra), uint(t.extraBits))
+	}
+}
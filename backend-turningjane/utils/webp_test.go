@@ -0,0 +1,198 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+// photoImage returns a noisy gradient that compresses like a photo
+func photoImage(width, height int) *image.NRGBA {
+	rng := rand.New(rand.NewSource(1))
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			noise := rng.Intn(48)
+			img.SetNRGBA(x, y, color.NRGBA{
+				R: uint8((x*200/width + noise) % 256),
+				G: uint8((y*200/height + noise) % 256),
+				B: uint8((x + y + noise) % 256),
+				A: 0xFF,
+			})
+		}
+	}
+	return img
+}
+
+// graphicImage returns flat color blocks, like a logo or poster
+func graphicImage(width, height int, alpha bool) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	palette := []color.NRGBA{{0xE5, 0x39, 0x35, 0xFF}, {0x1E, 0x88, 0xE5, 0xFF}, {0xFD, 0xD8, 0x35, 0xFF}, {0x21, 0x21, 0x21, 0xFF}}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := palette[(x/40+y/40)%len(palette)]
+			if alpha && x < width/3 {
+				c.A = uint8(y * 255 / height)
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestEncodeWebPRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		img  *image.NRGBA
+	}{
+		{"single pixel", graphicImage(1, 1, false)},
+		{"odd size", photoImage(37, 23)},
+		{"photo", photoImage(300, 200)},
+		{"graphic", graphicImage(256, 160, false)},
+		{"transparent", graphicImage(120, 90, true)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := EncodeWebP(&buf, tt.img); err != nil {
+				t.Fatalf("EncodeWebP: %v", err)
+			}
+
+			decoded, err := webp.Decode(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if decoded.Bounds() != tt.img.Bounds() {
+				t.Fatalf("bounds = %v, want %v", decoded.Bounds(), tt.img.Bounds())
+			}
+
+			// VP8L is lossless, every pixel must come back unchanged
+			for y := 0; y < tt.img.Bounds().Dy(); y++ {
+				for x := 0; x < tt.img.Bounds().Dx(); x++ {
+					want := tt.img.NRGBAAt(x, y)
+					if want.A == 0 {
+						continue
+					}
+					if got := color.NRGBAModel.Convert(decoded.At(x, y)).(color.NRGBA); got != want {
+						t.Fatalf("pixel (%d,%d) = %v, want %v", x, y, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeWebPSize(t *testing.T) {
+	img := graphicImage(600, 400, false)
+
+	var webpBuf, pngBuf bytes.Buffer
+	if err := EncodeWebP(&webpBuf, img); err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(&pngBuf, img); err != nil {
+		t.Fatal(err)
+	}
+	if webpBuf.Len() >= pngBuf.Len() {
+		t.Errorf("WebP of a flat graphic is %d bytes, PNG %d bytes", webpBuf.Len(), pngBuf.Len())
+	}
+}
+
+func TestImageVariantsSkipLargerWebP(t *testing.T) {
+	storage := &LocalStorageConfig{RootDir: t.TempDir(), BaseURL: "http://127.0.0.1:3000/media"}
+
+	tests := []struct {
+		name     string
+		img      image.Image
+		encode   func(*bytes.Buffer, image.Image) error
+		wantWebP bool
+	}{
+		{
+			name: "photo",
+			img:  photoImage(600, 411),
+			encode: func(buf *bytes.Buffer, img image.Image) error {
+				return jpeg.Encode(buf, img, &jpeg.Options{Quality: 95})
+			},
+			wantWebP: false,
+		},
+		{
+			name: "graphic",
+			img:  graphicImage(600, 400, false),
+			encode: func(buf *bytes.Buffer, img image.Image) error {
+				return png.Encode(buf, img)
+			},
+			wantWebP: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := tt.encode(&buf, tt.img); err != nil {
+				t.Fatal(err)
+			}
+
+			variants, err := uploadImageVariants(storage, "song_images/"+tt.name+".img", buf.Bytes())
+			if err != nil {
+				t.Fatalf("uploadImageVariants: %v", err)
+			}
+			if variants["600"] == "" {
+				t.Fatalf("missing 600 variant: %v", variants)
+			}
+
+			url, ok := variants["600_webp"]
+			if ok != tt.wantWebP {
+				t.Fatalf("600_webp present = %v, want %v (%v)", ok, tt.wantWebP, variants)
+			}
+			if !ok {
+				if _, err := os.Stat(filepath.Join(storage.RootDir, "song_images", tt.name+"_600.webp")); !os.IsNotExist(err) {
+					t.Errorf("WebP file was stored although it is not smaller: %v", err)
+				}
+				return
+			}
+
+			webpInfo, err := storage.StatFile(url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			originalInfo, err := storage.StatFile(variants["600"])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if webpInfo.Size >= originalInfo.Size {
+				t.Errorf("WebP variant is %d bytes, original %d bytes", webpInfo.Size, originalInfo.Size)
+			}
+		})
+	}
+}
+
+func TestImageVariantsRejectHugeDimensions(t *testing.T) {
+	storage := &LocalStorageConfig{RootDir: t.TempDir(), BaseURL: "http://127.0.0.1:3000/media"}
+
+	// A PNG of a few bytes whose header claims 20000x20000 pixels
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, graphicImage(1, 1, false)); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	binary.BigEndian.PutUint32(data[16:], 20000)
+	binary.BigEndian.PutUint32(data[20:], 20000)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+
+	if _, err := uploadImageVariants(storage, "song_images/huge.png", data); err == nil {
+		t.Fatal("uploadImageVariants accepted a 20000x20000 image")
+	}
+	if entries, _ := os.ReadDir(filepath.Join(storage.RootDir, "song_images")); len(entries) != 0 {
+		t.Errorf("variants were stored: %v", entries)
+	}
+}
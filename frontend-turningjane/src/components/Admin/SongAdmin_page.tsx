@@ -67,17 +67,28 @@ const SongAdmin: Component = () => {
 
   const fetchSongs = async () => {
     try {
-      const response = await fetch(`${getBackendUrl()}/songs`, {
-        credentials: 'include',
-      });
+      // Ambil semua halaman dengan mengikuti next_cursor
+      const allSongs: SongData[] = [];
+      let cursor: string | null = null;
+      do {
+        const params = new URLSearchParams({ limit: '100' });
+        if (cursor) params.set('cursor', cursor);
+
+        const response = await fetch(`${getBackendUrl()}/songs?${params}`, {
+          credentials: 'include',
+        });
 
-      if (!response.ok) {
-        throw new Error('Failed to fetch songs');
-      }
+        if (!response.ok) {
+          throw new Error('Failed to fetch songs');
+        }
 
-      const data = await response.json();
-      console.log('Fetched songs:', data);
-      setSongs(data || []);
+        const data = await response.json();
+        allSongs.push(...(data.songs || []));
+        cursor = data.next_cursor;
+      } while (cursor);
+
+      console.log('Fetched songs:', allSongs);
+      setSongs(allSongs);
     } catch (err) {
       console.error('Error fetching songs:', err);
       setError('Failed to load songs');
@@ -41,7 +41,7 @@ const MusicGrid: Component = () => {
       }
       
       const data = await response.json();
-      setSongs(data || []);
+      setSongs(data.songs || []);
     } catch (err: any) {
       setError(err.message);
       console.error('Error fetching songs:', err);
@@ -50,6 +50,24 @@ const MusicGrid: Component = () => {
     }
   };
 
+  // Report how long a song was listened to, repeated reports update the same play
+  const reportPlay = (songId: string, audio: HTMLAudioElement) => {
+    let listened = 0;
+    for (let i = 0; i < audio.played.length; i++) {
+      listened += audio.played.end(i) - audio.played.start(i);
+    }
+
+    fetch(`${getBackendUrl()}/songs/${songId}/plays`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({
+        listened_seconds: listened,
+        referrer: document.referrer,
+      }),
+      keepalive: true,
+    }).catch((err) => console.error('Error recording play:', err));
+  };
+
   const playAudio = (songId: string, audioPath: string) => {
     if (audioPlayer()) {
       audioPlayer()?.pause();
@@ -64,6 +82,7 @@ const MusicGrid: Component = () => {
     audio.addEventListener('ended', () => {
       setCurrentlyPlaying(null);
     });
+    audio.addEventListener('pause', () => reportPlay(songId, audio));
     audio.play();
     setAudioPlayer(audio);
     setCurrentlyPlaying(songId);
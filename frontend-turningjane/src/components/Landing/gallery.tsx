@@ -55,9 +55,54 @@ const Gallery: Component = () => {
     { src: "https://i.postimg.cc/tC1PhGrr/Screenshot-20250314-100741.png", alt: "Gen.Z Area 2024", gridClass: "div5" },
   ];
 
+  const gridClasses = ["div1", "div2", "div3", "div4", "div5"];
+
+  const getBackendUrl = () => {
+    const nodeEnv = import.meta.env.VITE_NODE_ENV;
+    if (nodeEnv === 'development') {
+      return import.meta.env.VITE_DEV_BACKEND_URL;
+    } else {
+      return import.meta.env.VITE_PROD_BACKEND_URL;
+    }
+  };
+
+  // Load album covers from the gallery API. The server resizes them and only
+  // adds a "1200_webp" variant when it is smaller than the JPEG/PNG (usually
+  // not for photos), so these images use the best variant the server has and
+  // skip the client-side conversion
+  const fetchAlbumImages = async () => {
+    try {
+      const response = await fetch(`${getBackendUrl()}/gallery`);
+      if (!response.ok) {
+        throw new Error(`HTTP error! Status: ${response.status}`);
+      }
+
+      const albums = await response.json();
+      return (albums || [])
+        .filter((album: any) => album.cover_photo)
+        .slice(0, gridClasses.length)
+        .map((album: any, index: number) => {
+          const variants = album.cover_photo.image_variants || {};
+          return {
+            src: variants["1200"] || album.cover_photo.image_path,
+            webpSrc: variants["1200_webp"] || variants["1200"] || album.cover_photo.image_path,
+            alt: album.title,
+            gridClass: gridClasses[index],
+          };
+        });
+    } catch (error) {
+      console.error("Error fetching gallery:", error);
+      return [];
+    }
+  };
+
   onMount(async () => {
+    const albumImages = await fetchAlbumImages();
+    const sourceImages: Array<{ src: string; webpSrc?: string; alt: string; gridClass: string }> =
+      albumImages.length > 0 ? albumImages : originalImages;
+
     // Initialize with original images first
-    setOptimizedImages(originalImages.map(img => ({ 
+    setOptimizedImages(sourceImages.map(img => ({ 
       ...img, 
       webpSrc: img.src,  // Initially set to original
       isWebpLoaded: false
@@ -66,8 +111,17 @@ const Gallery: Component = () => {
     // Process images in the background
     const processImages = async () => {
       const processedImages = await Promise.all(
-        originalImages.map(async (img) => {
+        sourceImages.map(async (img) => {
           try {
+            // Gallery API images are already optimized by the server
+            if (img.webpSrc) {
+              return { 
+                ...img, 
+                webpSrc: img.webpSrc, 
+                isWebpLoaded: true 
+              };
+            }
+            
             // Skip conversion for avif images as they're already optimized
             if (img.src.endsWith('.avif')) {
               return { 